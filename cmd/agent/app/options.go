@@ -58,8 +58,18 @@ func (opt *Options) AddFlags(fs *pflag.FlagSet) {
 	fs.StringVar(&opt.config.ManagerAddr, "manager-addr", opt.config.ManagerAddr, "manager server address")
 	fs.StringVar(&opt.config.PMPSecret, "pmp-secret", opt.config.PMPSecret, "pmp secret")
 	fs.StringVar(&opt.config.ManagerProviderAddress, "manager-provider-addr", opt.config.ManagerAddr, "manager provider address")
+	fs.StringVar(&opt.config.ManagerSRV, "manager-srv", opt.config.ManagerSRV, "dns srv name to discover manager servers, manager-addr is used if nothing discovered")
+	fs.StringVar(&opt.config.ManagerEndpointsFile, "manager-endpoints-file", opt.config.ManagerEndpointsFile, "yaml file of manager servers endpoints, reloaded when modified")
 	fs.StringVar(&opt.config.ManagerCert, "manager-cert", opt.config.ManagerCert, "manager server cert, must pkcs file")
 	fs.DurationVar(&opt.config.CacheTTL, "ttl", opt.config.CacheTTL, "cache ttl, device keepalive timeout, ")
+	fs.DurationVar(&opt.config.Reconnect.MaxInterval, "reconnect-max-interval", opt.config.Reconnect.MaxInterval, "max backoff interval to reconnect manager server")
+	fs.DurationVar(&opt.config.Reconnect.KeepaliveTime, "keepalive-time", opt.config.Reconnect.KeepaliveTime, "ping manager server after the time of no activity, 0 disables keepalive")
+	fs.BoolVar(&opt.config.Materialize.Enabled, "materialize-configs", opt.config.Materialize.Enabled, "write config namespaces into configmaps and secrets of opted-in kubernetes namespaces, requires the secrets permission of deploy-agent-materialize.yaml")
+	fs.BoolVar(&opt.config.HostWriter.Enabled, "host-writer", opt.config.HostWriter.Enabled, "write config namespaces onto host filesystem for legacy processes")
+	fs.StringVar(&opt.config.HostWriter.Root, "host-writer-root", opt.config.HostWriter.Root, "root directory of config namespaces written onto host")
+	fs.StringSliceVar(&opt.config.HostWriter.Namespaces, "host-writer-namespaces", opt.config.HostWriter.Namespaces, "config namespaces written onto host, globs are allowed")
+	fs.DurationVar(&opt.config.ShutdownTimeout, "shutdown-timeout", opt.config.ShutdownTimeout, "max time to finish the tasks in progress and drain the cmds when shutting down")
+	fs.StringVar(&opt.config.AdminBindAddr, "admin-bind-addr", opt.config.AdminBindAddr, "address of admin server to inspect internal state, empty disables it")
 }
 
 // Config build all configuration
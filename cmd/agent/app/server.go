@@ -4,6 +4,9 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"os/signal"
+	"sync"
+	"syscall"
 
 	"code.xxxxx.cn/platform/galaxy/pkg/agent"
 	"code.xxxxx.cn/platform/galaxy/pkg/util/alog"
@@ -47,10 +50,24 @@ func runCmd(cmd *cobra.Command, opt *Options) error {
 		return err
 	}
 	stopCh := make(chan struct{})
+	go handleSignals(stopCh)
 
 	return Run(cfg, stopCh)
 }
 
+// handleSignals close stopCh to shut down agent gracefully when received SIGTERM or SIGINT,
+// and exit immediately if received again
+func handleSignals(stopCh chan struct{}) {
+	sigCh := make(chan os.Signal, 2)
+	signal.Notify(sigCh, syscall.SIGTERM, syscall.SIGINT)
+	sig := <-sigCh
+	alog.Infof("Received signal %s, shutting down", sig)
+	close(stopCh)
+	sig = <-sigCh
+	alog.Warningf("Received signal %s again, exit immediately", sig)
+	os.Exit(1)
+}
+
 // Run start agent, start sync cache of informers and leader election
 func Run(c *Configuration, stopCh <-chan struct{}) error {
 	// set env MAYA_HOME
@@ -64,12 +81,29 @@ func Run(c *Configuration, stopCh <-chan struct{}) error {
 		return err
 	}
 
-	// TODO start up the healthz server.
-	// TODO start up the metrics server.
+	// start up the healthz server, metrics server and admin server
+	if c.Config.HealthzBindAddr != "" {
+		go a.ServeHealthz(c.Config.HealthzBindAddr)
+	}
+	if c.Config.MetricsBindAddr != "" {
+		go a.ServeMetrics(c.Config.MetricsBindAddr)
+	}
+	if c.Config.AdminBindAddr != "" {
+		go a.ServeAdmin(c.Config.AdminBindAddr)
+	}
 
 	// start informers and wait for syncing cache
 	c.InformerFactory.Start(stopCh)
-	c.InformerFactory.WaitForCacheSync(stopCh)
+	for informer, synced := range c.InformerFactory.WaitForCacheSync(stopCh) {
+		if !synced {
+			// never report informers synced if stopped before
+			if stopped(stopCh) {
+				return nil
+			}
+			return fmt.Errorf("wait for cache of informer %v synced failed", informer)
+		}
+	}
+	close(a.InformerSynced)
 	alog.Infof("Informers cache synced")
 
 	// build a context
@@ -84,18 +118,41 @@ func Run(c *Configuration, stopCh <-chan struct{}) error {
 		}
 	}()
 
-	// prepare a run func
+	// prepare a run func, wait for it to finish shutting down before exit, as leader elector starts it
+	// in another goroutine, it never starts once exiting so the wait never misses it
+	var (
+		running     sync.WaitGroup
+		runningLock sync.Mutex
+		exiting     bool
+	)
 	run := func(ctx context.Context) {
+		runningLock.Lock()
+		if exiting {
+			runningLock.Unlock()
+			return
+		}
+		running.Add(1)
+		runningLock.Unlock()
+		defer running.Done()
 		a.Run()
 		<-ctx.Done()
 	}
+	wait := func() {
+		runningLock.Lock()
+		exiting = true
+		runningLock.Unlock()
+		running.Wait()
+	}
 
 	// if enable leader election
 	if c.LeaderElection != nil {
 		c.LeaderElection.Callbacks = leaderelection.LeaderCallbacks{
 			OnStartedLeading: run,
 			OnStoppedLeading: func() {
-				runtime.HandleError(fmt.Errorf("lost master"))
+				// the lease is released when shutting down
+				if !stopped(stopCh) {
+					runtime.HandleError(fmt.Errorf("lost master"))
+				}
 			},
 		}
 		leaderElector, err := leaderelection.NewLeaderElector(*c.LeaderElection)
@@ -104,11 +161,28 @@ func Run(c *Configuration, stopCh <-chan struct{}) error {
 		}
 
 		leaderElector.Run(ctx)
+		if stopped(stopCh) {
+			wait()
+			return nil
+		}
 
 		return fmt.Errorf("lost lease")
 	}
 
 	// if disabled leader election
 	run(ctx)
+	if stopped(stopCh) {
+		return nil
+	}
 	return fmt.Errorf("exit without leader elect")
 }
+
+// stopped check if agent is shut down by stopCh
+func stopped(stopCh <-chan struct{}) bool {
+	select {
+	case <-stopCh:
+		return true
+	default:
+		return false
+	}
+}
@@ -27,6 +27,9 @@ func (opt *Options) AddFlags(fs *pflag.FlagSet) {
 	fs.StringVar(&opt.config.DataDir, "storage-dir", config.DefaultDataDir, "data dir")
 	fs.StringVar(&opt.config.GRPCServerAddr, "rpc-addr", opt.config.GRPCServerAddr, "rpc server bind address")
 	fs.BoolVar(&opt.config.GRPCInsecure, "rpc-insecure", opt.config.GRPCInsecure, "if use insecure grpc server without tls")
+	fs.DurationVar(&opt.config.GRPCKeepaliveMinTime, "rpc-keepalive-min-time", opt.config.GRPCKeepaliveMinTime, "min interval of pings allowed from agents, must be less than keepalive time of agents")
+	fs.DurationVar(&opt.config.GRPCKeepaliveTime, "rpc-keepalive-time", opt.config.GRPCKeepaliveTime, "ping agents after the time of no activity")
+	fs.DurationVar(&opt.config.GRPCKeepaliveTimeout, "rpc-keepalive-timeout", opt.config.GRPCKeepaliveTimeout, "time to wait for ping ack before closing connection of agent")
 	fs.StringVar(&opt.config.WebServerAddr, "web-addr", opt.config.WebServerAddr, "web server bind address")
 	fs.StringVar(&opt.config.MetricServerAddr, "metric-addr", opt.config.MetricServerAddr, "metric server bind address")
 	fs.BoolVar(&opt.config.WebInsecure, "web-insecure", opt.config.WebInsecure, "if true use http web server instead of https")
@@ -34,6 +37,7 @@ func (opt *Options) AddFlags(fs *pflag.FlagSet) {
 	fs.StringVar(&opt.config.KeyFile, "key", opt.config.KeyFile, "server key file path")
 	fs.StringVar(&opt.config.CAFile, "ca", opt.config.CAFile, "server ca file path")
 	fs.StringVar(&opt.config.DBConfig, "db", opt.config.DBConfig, "database config file path")
+	fs.StringVar(&opt.config.SiteIdentityFile, "site-identity-file", opt.config.SiteIdentityFile, "yaml file maps CN or SAN of agent certificates to site ids allowed to register")
 
 	fs.StringVar(&opt.config.AuthAddr, "auth-addr", opt.config.AuthAddr, "auth platform address")
 	fs.Int64Var(&opt.config.AuthClientID, "auth-client-id", opt.config.AuthClientID, "client-id to access auth")
@@ -46,6 +50,7 @@ func (opt *Options) AddFlags(fs *pflag.FlagSet) {
 	fs.StringVar(&opt.config.PrometheusAddr, "prom-url", opt.config.PrometheusAddr, "prometheus url for monitoring self metrics")
 	fs.StringVar(&opt.config.ResourceManagerAPI, "resource-manager-api", opt.config.ResourceManagerAPI, "api address of resource managerment system")
 	fs.StringVar(&opt.config.ResourceManagerSecret, "resource-manager-secret", opt.config.ResourceManagerSecret, "api secret of resource managerment system")
+	fs.DurationVar(&opt.config.OutboxTTL, "outbox-ttl", opt.config.OutboxTTL, "max time to keep a cmd in outbox before delivered to agent")
 }
 
 // hideFlags hide some help cmdline flags
@@ -0,0 +1,152 @@
+package agent
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"code.xxxxx.cn/platform/galaxy/pkg/agent/syncer"
+	"code.xxxxx.cn/platform/galaxy/pkg/agent/vm"
+	"code.xxxxx.cn/platform/galaxy/pkg/util/alog"
+)
+
+// appsView is the apps registered to agent and their subscriptions
+type appsView struct {
+	Apps []*syncer.AppDescribe `json:"apps"`
+	// Files is the apps subscribed to every file, key is namespace/name
+	Files map[string][]string `json:"files"`
+	// Namespaces is the apps subscribed to every namespace
+	Namespaces map[string][]string `json:"namespaces"`
+}
+
+// downloadsView is the download tasks of version manager
+type downloadsView struct {
+	Downloads []vm.DownloadTask `json:"downloads"`
+	Failures  []vm.DownloadTask `json:"failures"`
+}
+
+// ServeAdmin start the admin server on addr to inspect the internal state of agent and trigger repairs,
+// requests are allowed from localhost, or with the bearer token of AdminToken
+func (ca *Agent) ServeAdmin(addr string) {
+	alog.Infof("Admin server is listening at: %s", addr)
+	alog.Fatal(http.ListenAndServe(addr, ca.adminHandler()))
+}
+
+// adminHandler build the handler of all admin apis
+func (ca *Agent) adminHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/admin/filemapper", ca.adminMethod(http.MethodGet, ca.getFileMapper))
+	mux.HandleFunc("/admin/apps", ca.adminMethod(http.MethodGet, ca.getApps))
+	mux.HandleFunc("/admin/apps/renotify", ca.adminMethod(http.MethodPost, ca.renotifyApp))
+	mux.HandleFunc("/admin/downloads", ca.adminMethod(http.MethodGet, ca.getDownloads))
+	mux.HandleFunc("/admin/downloads/retry", ca.adminMethod(http.MethodPost, ca.retryDownloads))
+	mux.HandleFunc("/admin/notifies", ca.adminMethod(http.MethodGet, ca.getNotifies))
+	mux.HandleFunc("/admin/sync", ca.adminMethod(http.MethodPost, ca.syncLocal))
+	return mux
+}
+
+// adminMethod wrap handler to check method and access of request
+func (ca *Agent) adminMethod(method string, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if err := ca.authorizeAdmin(req); err != nil {
+			alog.Warningf("Refused admin request %s %s from %s: %v", req.Method, req.URL.Path, req.RemoteAddr, err)
+			writeJSON(w, http.StatusForbidden, map[string]string{"error": err.Error()})
+			return
+		}
+		if req.Method != method {
+			writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+			return
+		}
+		alog.V(4).Infof("Admin request %s %s from %s", req.Method, req.URL.String(), req.RemoteAddr)
+		handler(w, req)
+	}
+}
+
+// bearerPrefix is the scheme prefix of Authorization header
+const bearerPrefix = "Bearer "
+
+// authorizeAdmin allow requests from localhost, or with the bearer token of AdminToken
+func (ca *Agent) authorizeAdmin(req *http.Request) error {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err == nil {
+		if ip := net.ParseIP(host); ip != nil && ip.IsLoopback() {
+			return nil
+		}
+	}
+	if ca.config.AdminToken == "" {
+		return fmt.Errorf("only localhost is allowed")
+	}
+	auth := req.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, bearerPrefix) {
+		return fmt.Errorf("bearer token required")
+	}
+	if subtle.ConstantTimeCompare([]byte(auth[len(bearerPrefix):]), []byte(ca.config.AdminToken)) != 1 {
+		return fmt.Errorf("invalid token")
+	}
+	return nil
+}
+
+// getFileMapper response digests of all files recorded by file mapper
+func (ca *Agent) getFileMapper(w http.ResponseWriter, req *http.Request) {
+	writeJSON(w, http.StatusOK, ca.fm.Copy())
+}
+
+// getApps response apps registered and their subscriptions
+func (ca *Agent) getApps(w http.ResponseWriter, req *http.Request) {
+	files, namespaces := ca.syncer.Subscriptions()
+	writeJSON(w, http.StatusOK, &appsView{
+		Apps:       ca.syncer.GetAllAppsCopy(),
+		Files:      files,
+		Namespaces: namespaces,
+	})
+}
+
+// getDownloads response download queue and failure queue of version manager
+func (ca *Agent) getDownloads(w http.ResponseWriter, req *http.Request) {
+	downloads, failures := ca.vm.Queues()
+	writeJSON(w, http.StatusOK, &downloadsView{Downloads: downloads, Failures: failures})
+}
+
+// getNotifies response failed notifies waiting to retry
+func (ca *Agent) getNotifies(w http.ResponseWriter, req *http.Request) {
+	writeJSON(w, http.StatusOK, ca.syncer.NotifyTasks())
+}
+
+// retryDownloads retry the failed download tasks of query key now, all failed tasks if key is empty
+func (ca *Agent) retryDownloads(w http.ResponseWriter, req *http.Request) {
+	n := ca.vm.RetryFailure(req.URL.Query().Get("key"))
+	writeJSON(w, http.StatusOK, map[string]int{"retried": n})
+}
+
+// renotifyApp notify the app of query conn its subscribed files of query namespace again
+func (ca *Agent) renotifyApp(w http.ResponseWriter, req *http.Request) {
+	conn := req.URL.Query().Get("conn")
+	if conn == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "conn is required"})
+		return
+	}
+	if err := ca.syncer.Renotify(conn, req.URL.Query().Get("namespace")); err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"result": "notified"})
+}
+
+// syncLocal queue a full reconciliation of local data with manager, it runs once the tunnel is ready
+func (ca *Agent) syncLocal(w http.ResponseWriter, req *http.Request) {
+	alog.Infof("Full sync of local data triggered by admin")
+	ca.requestReconcile()
+	writeJSON(w, http.StatusAccepted, map[string]string{"result": "sync queued"})
+}
+
+// writeJSON write v as json response with status code
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		alog.Warningf("Write admin response failed: %v", err)
+	}
+}
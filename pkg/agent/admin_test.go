@@ -0,0 +1,82 @@
+package agent
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"code.xxxxx.cn/platform/galaxy/pkg/agent/config"
+	"code.xxxxx.cn/platform/galaxy/pkg/agent/syncer"
+	"code.xxxxx.cn/platform/galaxy/pkg/agent/updater"
+	"code.xxxxx.cn/platform/galaxy/pkg/agent/vm"
+	"code.xxxxx.cn/platform/galaxy/pkg/component/storage/filedb"
+)
+
+func TestAdminAPI(t *testing.T) {
+	dir, err := ioutil.TempDir("", "admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fdb, err := filedb.NewFileDB(&filedb.Config{Workdir: dir, CasDisable: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fm := updater.NewFileMapper(fdb)
+	fm.Set("ns1", "a.yaml", "digest-a")
+	ca := &Agent{
+		config: &config.AgentConfiguration{AdminToken: "secret"},
+		fm:     fm,
+		syncer: syncer.NewSyncer(syncer.Config{}),
+		vm:     vm.NewVersionManager(vm.Config{ProviderAddress: "http://127.0.0.1:1", Fdb: fdb}),
+	}
+	handler := ca.adminHandler()
+
+	do := func(method, path, remote, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.RemoteAddr = remote
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// remote requests require the token
+	if rec := do(http.MethodGet, "/admin/filemapper", "10.0.0.1:5000", ""); rec.Code != http.StatusForbidden {
+		t.Errorf("expect remote request without token forbidden, got %d", rec.Code)
+	}
+	if rec := do(http.MethodGet, "/admin/filemapper", "10.0.0.1:5000", "wrong"); rec.Code != http.StatusForbidden {
+		t.Errorf("expect remote request with wrong token forbidden, got %d", rec.Code)
+	}
+	req := httptest.NewRequest(http.MethodGet, "/admin/filemapper", nil)
+	req.RemoteAddr = "10.0.0.1:5000"
+	req.Header.Set("Authorization", "secret")
+	raw := httptest.NewRecorder()
+	if handler.ServeHTTP(raw, req); raw.Code != http.StatusForbidden {
+		t.Errorf("expect remote request with token not bearer forbidden, got %d", raw.Code)
+	}
+	rec := do(http.MethodGet, "/admin/filemapper", "10.0.0.1:5000", "secret")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expect remote request with token allowed, got %d", rec.Code)
+	}
+	content := map[string]map[string]string{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &content); err != nil || content["ns1"]["a.yaml"] != "digest-a" {
+		t.Errorf("expect digests of file mapper, got %s %v", rec.Body.String(), err)
+	}
+
+	// localhost is always allowed, actions require POST
+	if rec := do(http.MethodGet, "/admin/downloads/retry", "127.0.0.1:5000", ""); rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expect action by GET not allowed, got %d", rec.Code)
+	}
+	if rec := do(http.MethodPost, "/admin/downloads/retry", "127.0.0.1:5000", ""); rec.Code != http.StatusOK {
+		t.Errorf("expect retry downloads succeed, got %d %s", rec.Code, rec.Body.String())
+	}
+	if rec := do(http.MethodPost, "/admin/apps/renotify?conn=unknown", "127.0.0.1:5000", ""); rec.Code != http.StatusInternalServerError {
+		t.Errorf("expect renotify unknown app failed, got %d %s", rec.Code, rec.Body.String())
+	}
+}
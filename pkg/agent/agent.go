@@ -5,6 +5,7 @@ import (
 	"net"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"code.xxxxx.cn/platform/galaxy/pkg/apis"
@@ -16,6 +17,8 @@ import (
 	corelisters "k8s.io/client-go/listers/core/v1"
 
 	"code.xxxxx.cn/platform/galaxy/pkg/agent/config"
+	"code.xxxxx.cn/platform/galaxy/pkg/agent/hostwriter"
+	"code.xxxxx.cn/platform/galaxy/pkg/agent/materializer"
 	"code.xxxxx.cn/platform/galaxy/pkg/agent/syncer"
 	"code.xxxxx.cn/platform/galaxy/pkg/agent/updater"
 	"code.xxxxx.cn/platform/galaxy/pkg/agent/vm"
@@ -41,12 +44,27 @@ type Agent struct {
 	fm         *updater.FileMapper
 	updateHub  *updater.UpdateHub
 	syncer     *syncer.Syncer
+	// materializer is nil if materializing configs into kubernetes objects is disabled
+	materializer *materializer.Materializer
+	// hostWriter is nil if writing configs onto host is disabled
+	hostWriter *hostwriter.Writer
+	tunnel     tunnelState
+	syncState  syncState
+	// reconcileCh queue reconciliation of local data with manager
+	reconcileCh chan struct{}
 
 	podLister corelisters.PodLister
 
 	InformerSynced       chan struct{}
 	ClusterStatusSynced  bool
 	afterSendRegisterCmd chan struct{}
+	// inventoryCh notify to report inventory after resources changed
+	inventoryCh chan struct{}
+	// workers is the download, update and notify workers, their queues are dumped after they stopped
+	workers     sync.WaitGroup
+	workersLock sync.Mutex
+	// tunnelStop is closed after tunnels of manager and apps drained when shutting down
+	tunnelStop chan struct{}
 	// Close this to shut down the world.
 	stopEverything <-chan struct{}
 }
@@ -61,11 +79,25 @@ func New(cfg *config.AgentConfiguration,
 	if err != nil {
 		return nil, err
 	}
+	// reload the cert when rotated, new connections use the new one
+	go clientCfg.Reloader.Watch(conns.DefaultCertReloadPeriod, stopCh)
+	clientCfg.Reconnect = conns.ReconnectPolicy{
+		InitialInterval:  cfg.Reconnect.InitialInterval,
+		MaxInterval:      cfg.Reconnect.MaxInterval,
+		Multiplier:       cfg.Reconnect.Multiplier,
+		Jitter:           cfg.Reconnect.Jitter,
+		KeepaliveTime:    cfg.Reconnect.KeepaliveTime,
+		KeepaliveTimeout: cfg.Reconnect.KeepaliveTimeout,
+	}
 	conn := conns.NewGlobalConn(clientCfg)
 
+	// tunnels are kept until drained when shutting down
+	tunnelStop := make(chan struct{})
 	connectID := strings.Join([]string{cfg.ID, strconv.Itoa(int(time.Now().Unix()))}, apis.ConnectionSplit)
-	cmdClient := cmd.NewCmdClient(connectID, conn, stopCh)
-	cmdServer := cmd.NewCmdServer(stopCh)
+	// heartbeat only the tunnel to manager, as the apps connected to agent are on the same host
+	cmdClient := cmd.NewCmdClient(connectID, conn, tunnelStop, cmd.WithInterceptors(cmd.DefaultInterceptors()...),
+		cmd.WithHeartbeat(cmd.DefaultHeartbeatInterval, cmd.DefaultHeartbeatMaxMisses))
+	cmdServer := cmd.NewCmdServer(tunnelStop, cmd.WithInterceptors(cmd.DefaultInterceptors()...))
 
 	grpcServer := newGRPCServer()
 	fdb, err := filedb.NewFileDB(&filedb.Config{Workdir: cfg.WorkDir, CasDisable: true})
@@ -74,7 +106,7 @@ func New(cfg *config.AgentConfiguration,
 	}
 
 	fileMapper := updater.NewFileMapper(fdb)
-	appSyncer := syncer.NewSyncer(syncer.Config{CmdServer: cmdServer})
+	appSyncer := syncer.NewSyncer(syncer.Config{CmdServer: cmdServer, FDB: fdb})
 	updateHub := updater.NewUpdateHub(updater.Config{FDB: fdb, FM: fileMapper, SiteID: cfg.ID, Syncer: appSyncer})
 
 	vmins := vm.NewVersionManager(vm.Config{
@@ -83,6 +115,7 @@ func New(cfg *config.AgentConfiguration,
 		PmpSecret:       cfg.PMPSecret,
 		ProviderAddress: cfg.ManagerProviderAddress,
 		UpdateHub:       updateHub,
+		CmdClient:       cmdClient,
 	})
 
 	ca := &Agent{
@@ -103,17 +136,15 @@ func New(cfg *config.AgentConfiguration,
 
 		InformerSynced:       make(chan struct{}),
 		afterSendRegisterCmd: make(chan struct{}),
+		inventoryCh:          make(chan struct{}, 1),
+		reconcileCh:          make(chan struct{}, 1),
+		tunnelStop:           tunnelStop,
 		stopEverything:       stopCh,
 	}
 
 	cmdServer.GetConnManager().OnReady(func(conn *conns.Conn) {
-		files := map[string]struct{}{}
-		for _, file := range strings.Split(conn.Info["files"], ",") {
-			if file == "" {
-				continue
-			}
-			files[file] = struct{}{}
-		}
+		// apps subscribe files by names or globs, ns/* subscribes all files of ns
+		files, patterns := syncer.ParseSubscriptions(conn.Info["files"])
 
 		ca.syncer.RegisterApp(&syncer.AppDescribe{
 			AppID:      conn.Info["appName"],
@@ -121,6 +152,7 @@ func New(cfg *config.AgentConfiguration,
 			PodIP:      conn.Info["ip"],
 			Namespaces: strings.Split(conn.Info["namespaces"], ","),
 			Files:      files,
+			Patterns:   patterns,
 		}, conn.Key)
 		alog.Infof("Registered App of %q, info: %v", conn.Info["appName"], conn.Info)
 	})
@@ -134,20 +166,33 @@ func New(cfg *config.AgentConfiguration,
 		alog.Infof("App:%v cancel, hostname: %v", app.AppID, app.Hostname)
 
 		appSyncer.CancelApp(conn.Key)
-		_, err := cmdClient.SendSync(cmdClient.NewCmdReq("appcancel", cmd.Args{
-			"site":     cfg.ID,
-			"app":      app.AppID,
-			"hostname": app.Hostname,
-			"ip":       app.PodIP,
-		}), DefaultServerTimeout)
+		req := cmdClient.NewCmdReq(cmd.AppCancelHandler, nil)
+		if err := cmd.SetAppCancelPayload(req, &pb.AppCancelPayload{
+			Site:     cfg.ID,
+			App:      app.AppID,
+			Hostname: app.Hostname,
+			IP:       app.PodIP,
+		}); err != nil {
+			alog.Errorf(" Cancel failed: %v ", err)
+			return
+		}
+		_, err := cmdClient.SendSync(req, DefaultServerTimeout)
 		if err != nil {
 			alog.Errorf(" Cancel failed: %v ", err)
 		}
 	})
 
+	ca.loadSyncState()
+
+	// record tunnel state first, as the following callbacks may block long
+	ca.cmdClient.OnReady(func() { ca.tunnel.set(true) })
+	ca.cmdClient.OnNotReady(func() {
+		ca.tunnel.set(false)
+		ca.syncState.setReconciled(false, time.Time{})
+	})
 	ca.cmdClient.OnReady(func() {
 		alog.Info("Agent to server is Ready!!!")
-		ca.syncLocalData()
+		ca.requestReconcile()
 
 		for _, app := range ca.syncer.GetAllAppsCopy() {
 			filesMap := map[string]map[string]string{}
@@ -172,6 +217,9 @@ func New(cfg *config.AgentConfiguration,
 		}
 	})
 
+	ca.addInventoryHandlers()
+	ca.setupMaterializer()
+	ca.setupHostWriter()
 	go ca.syncClusterStatus()
 	ca.addCmdHandlers()
 	ca.RegisterService()
@@ -184,43 +232,62 @@ func (ca *Agent) Run() {
 	defer runtime.HandleCrash()
 	alog.Infof("Starting galaxy agent")
 	defer alog.Infof("Shutting down galaxy agent")
+	ca.tunnel.set(false)
 
-	// start to connect manager server
-	alog.Infof("Starting connect to galaxy server")
-	// will block until got a active conn
-	ca.conn.PollConn()
-
-	// start command tunnel of manager
-	go ca.updateHub.Start()
-	go ca.vm.Start()
-	go ca.fm.Run()
-	go ca.syncer.Run()
-	go ca.cmdClient.StartListen(ca.afterSendRegisterCmd)
+	// discover manager servers and fail back to the preferred one
+	if d := newDiscovery(ca.config); d != nil {
+		go ca.conn.WatchDiscovery(d, ca.config.DiscoveryPeriod, ca.stopEverything)
+		go ca.conn.ConnMonitor(ca.stopEverything)
+	}
+
+	// serve apps with local data first, it is reconciled with manager once the tunnel ready
+	ca.startWorkers()
+	go ca.runReconcile()
+	go ca.runMaterializer()
+	go ca.runHostWriter()
 	go ca.StartListen()
 
+	go func() {
+		// start to connect manager server
+		alog.Infof("Starting connect to galaxy server")
+		// will block until got a active conn
+		ca.conn.PollConn()
+
+		// start command tunnel of manager
+		ca.goWorker(ca.vm.Start)
+		go ca.cmdClient.StartListen(ca.afterSendRegisterCmd)
+	}()
+
 	<-ca.stopEverything
+	ca.shutdown()
+}
+
+// newDiscovery build discovery of manager servers by config, nil if not configured
+func newDiscovery(cfg *config.AgentConfiguration) conns.Discovery {
+	switch {
+	case cfg.ManagerSRV != "":
+		return conns.NewSRVDiscovery(cfg.ManagerSRV)
+	case cfg.ManagerEndpointsFile != "":
+		return conns.NewFileDiscovery(cfg.ManagerEndpointsFile)
+	default:
+		return nil
+	}
 }
 
-func (ca *Agent) syncLocalData() {
-	err := ca.refreshAgentFDBFromRemote(ca.fm.GetAll(), true)
-	for err != nil {
-		alog.Errorf("refresh failed: %v", err)
-		time.Sleep(time.Second)
-		err = ca.refreshAgentFDBFromRemote(ca.fm.GetAll(), true)
+// syncLocalData refresh all files from manager and the ones inconsistent with file mapper on disk,
+// it returns on the first failure and is retried by reconciliation
+func (ca *Agent) syncLocalData() error {
+	if err := ca.refreshAgentFDBFromRemote(ca.fm.GetAll(), true); err != nil {
+		return err
 	}
 
 	local := ca.refreshFilemapperFromLocal()
 	if len(local) != 0 {
 		alog.Infof("Local Disk Scan Over, exist %v ns not correct, start refresh", len(local))
-		err := ca.refreshAgentFDBFromRemote(local, false)
-		for err != nil {
-			alog.Errorf("refresh failed: %v", err)
-			time.Sleep(time.Second)
-			err = ca.refreshAgentFDBFromRemote(local, false)
-		}
-	} else {
-		alog.Info("Local Disk Scan Over, no inconsistency file mapper")
+		return ca.refreshAgentFDBFromRemote(local, false)
 	}
+	alog.Info("Local Disk Scan Over, no inconsistency file mapper")
+	return nil
 }
 
 // RegisterService register service
@@ -241,7 +308,10 @@ func (ca *Agent) ListenGRPC() {
 	}
 	alog.Infof("GRPC server is listening at: %s", ":"+ca.config.GRPCPort)
 
-	alog.Fatal(ca.grpcServer.Serve(lis))
+	// Serve returns nil after the server stopped when shutting down
+	if err := ca.grpcServer.Serve(lis); err != nil && err != grpc.ErrServerStopped {
+		alog.Fatal(err)
+	}
 }
 
 func newGRPCServer() *grpc.Server {
@@ -12,6 +12,7 @@ import (
 
 	"code.xxxxx.cn/platform/galaxy/pkg/agent/utils"
 	"code.xxxxx.cn/platform/galaxy/pkg/component/cmd"
+	pb "code.xxxxx.cn/platform/galaxy/pkg/component/cmd/v1"
 	"code.xxxxx.cn/platform/galaxy/pkg/util/alog"
 )
 
@@ -33,21 +34,12 @@ type FileMetadataInfo struct {
 	Extends map[string]string `extends`
 }
 
-// configInstanceUpdateInfo .
-type configInstanceUpdateInfo struct {
-	SiteID    string            `json:"site_id"`
-	App       string            `json:"app"`
-	Hostname  string            `json:"hostname"`
-	IP        string            `json:"ip"`
-	Namespace string            `json:"namespace"`
-	Filenames map[string]string `json:"filenames"`
-}
-
 func (ca *Agent) addCmdHandlers() {
 	ca.cmdClient.AddCmdHandler(cmd.HelloWorld, ca.CmdHelloWorldHandler)
 
-	ca.cmdClient.AddCmdHandler(cmd.CmdNSPackageHandler, ca.CmdPackageHandler)
+	ca.cmdClient.AddCmdHandler(cmd.CmdNSPackageHandler, cmd.HandleNSPackage(ca.CmdPackageHandler))
 	ca.cmdClient.AddCmdHandler(cmd.CmdNSFileHandler, ca.CmdNSFileHandler)
+	ca.cmdClient.AddCmdHandler(cmd.GetContainerLog, ca.CmdContainerLogHandler)
 
 	ca.cmdServer.AddCmdHandler(cmd.CmdFileRefreshHandler, ca.CmdFileRefreshHandler)
 	ca.cmdServer.AddCmdHandler(cmd.CmdContentHandler, ca.CmdContentHandler)
@@ -66,11 +58,8 @@ func (ca *Agent) CmdHelloWorldHandler(req *cmd.Req) (*cmd.Resp, cmd.OnComplete)
 }
 
 // CmdPackageHandler .
-func (ca *Agent) CmdPackageHandler(req *cmd.Req) (*cmd.Resp, cmd.OnComplete) {
-	namespace := req.Args.Get("namespace")
-	digest := req.Args.Get("digest")
-
-	ca.vm.AddDownloadPackageTask(namespace, digest)
+func (ca *Agent) CmdPackageHandler(req *cmd.Req, p *pb.NSPackagePayload) (*cmd.Resp, cmd.OnComplete) {
+	ca.vm.AddDownloadPackageTask(p.Namespace, p.Digest)
 
 	return cmd.RespSucceed(""), nil
 }
@@ -94,15 +83,14 @@ func (ca *Agent) CmdNSFileHandler(req *cmd.Req) (*cmd.Resp, cmd.OnComplete) {
 
 // CmdFileRefreshHandler .
 func (ca *Agent) CmdFileRefreshHandler(req *cmd.Req) (*cmd.Resp, cmd.OnComplete) {
-	fileContents := req.Args.Get("filecontents")
-
-	infos := map[string]map[string]string{}
-	if err := json.Unmarshal([]byte(fileContents), &infos); err != nil {
+	p, err := cmd.GetFileRefreshPayload(req)
+	if err != nil {
 		return &cmd.Resp{
 			Code: http.StatusBadRequest,
 			Msg:  err.Error(),
 		}, nil
 	}
+	infos := cmd.FileDigestsMap(p.Files)
 
 	differentFiles := map[string][]string{}
 	missedFiles := map[string][]string{}
@@ -190,25 +178,21 @@ func (ca *Agent) refreshFilemapperFromLocal() map[string]map[string]string {
 }
 
 func (ca *Agent) refreshAgentFDBFromRemote(required map[string]map[string]string, full bool) error {
-	filesData, err := json.Marshal(required)
-	if err != nil {
-		alog.Warningf("Marshal miss failed:%v", err)
-		return err
-	}
-
-	var resp *cmd.Resp
+	var req *cmd.Req
 	if full {
-		resp, err = ca.cmdClient.SendSync(ca.cmdClient.NewCmdReq(cmd.FileSyncHandler, map[string]string{
-			"siteid":       ca.config.ID,
-			"filecontents": string(filesData),
-		}), DefaultServerTimeout)
+		req = ca.cmdClient.NewCmdReq(cmd.FileSyncHandler, nil)
 	} else {
-		resp, err = ca.cmdClient.SendSync(ca.cmdClient.NewCmdReq(cmd.CmdFileRefreshHandler, map[string]string{
-			"siteid":       ca.config.ID,
-			"filecontents": string(filesData),
-		}), DefaultServerTimeout)
+		req = ca.cmdClient.NewCmdReq(cmd.CmdFileRefreshHandler, nil)
+	}
+	if err := cmd.SetFileRefreshPayload(req, &pb.FileRefreshPayload{
+		SiteID: ca.config.ID,
+		Files:  cmd.NewFileDigests(required),
+	}); err != nil {
+		alog.Warningf("Set refresh payload failed:%v", err)
+		return err
 	}
 
+	resp, err := ca.cmdClient.SendSync(req, DefaultServerTimeout)
 	if err != nil {
 		alog.Errorf("request upstream failed: %v", err)
 		return err
@@ -255,7 +239,16 @@ func (ca *Agent) refreshAgentFDBFromRemote(required map[string]map[string]string
 }
 
 func (ca *Agent) reportUpdatedInfoToRemote(app *syncer.AppDescribe, ns string, diffed map[string]string) {
-	data, err := json.Marshal(configInstanceUpdateInfo{
+	ca.reportInstanceToRemote(app, ns, diffed, nil)
+}
+
+// reportInstanceToRemote report digests of files in effect of the instance, and the failure of applying them if any
+func (ca *Agent) reportInstanceToRemote(app *syncer.AppDescribe, ns string, diffed map[string]string, updateErr error) {
+	reportReq := ca.cmdClient.NewCmdReq(cmd.CmdUpdatedHandler, nil)
+	if updateErr != nil {
+		reportReq.Args = cmd.Args{cmd.ArgUpdateError: updateErr.Error()}
+	}
+	err := cmd.SetFileUpdatedPayload(reportReq, &pb.FileUpdatedPayload{
 		SiteID:    ca.config.ID,
 		App:       app.AppID,
 		IP:        app.PodIP,
@@ -263,14 +256,10 @@ func (ca *Agent) reportUpdatedInfoToRemote(app *syncer.AppDescribe, ns string, d
 		Namespace: ns,
 		Filenames: diffed,
 	})
-
 	if err != nil {
-		alog.Error("marshal update info failed, when refresh")
+		alog.Error("set update info payload failed, when refresh")
 		return
 	}
-	reportReq := ca.cmdClient.NewCmdReq(cmd.CmdUpdatedHandler, cmd.Args{
-		"updateinfo": string(data),
-	})
 
 	_, err = ca.cmdClient.SendSync(reportReq, DefaultServerTimeout)
 	if err != nil {
@@ -286,7 +275,8 @@ type FileContent struct {
 	Digest  string            `json:"digest"`
 }
 
-// CmdContentHandler provide file content in response data
+// CmdContentHandler provide file content in response data, if caller accepts chunks the content
+// is sent as raw chunks and the response data only contains the metadata
 func (ca *Agent) CmdContentHandler(req *cmd.Req) (*cmd.Resp, cmd.OnComplete) {
 	namespace := req.Args.Get("namespace")
 	filename := req.Args.Get("filename")
@@ -298,26 +288,72 @@ func (ca *Agent) CmdContentHandler(req *cmd.Req) (*cmd.Resp, cmd.OnComplete) {
 	if err != nil {
 		alog.Errorf("Config Visited Failed:%v", err)
 
+		// refresh it when reconciled if offline, not to block the app
+		if _, ready, _ := ca.tunnel.get(); !ready {
+			ca.syncState.addMissed(namespace, filename, digest)
+			return &cmd.Resp{
+				Code: 204,
+				Msg:  "agent is offline, content is queued to refresh",
+			}, nil
+		}
 		if err := ca.refreshAgentFDBFromRemote(map[string]map[string]string{namespace: {filename: digest}}, false); err != nil {
 			alog.Errorf("Refresh Agent FDB Failed when content not exist:%v", err)
+			ca.syncState.addMissed(namespace, filename, digest)
+			ca.requestReconcile()
 		}
 		return &cmd.Resp{
 			Code: 204,
 		}, nil
 	}
-	defer r.Close()
+	// the content is served even if agent is offline, tell apps how fresh it is
+	extend = ca.stalenessExtend(extend)
 	if status, ok := extend["_status"]; ok && status == strconv.Itoa(http.StatusNotFound) {
+		r.Close()
 		return &cmd.Resp{
 			Code: http.StatusNotFound,
 		}, nil
 	}
 
 	if localDigest, ok := extend["digest"]; ok && localDigest == digest {
+		r.Close()
 		return &cmd.Resp{
 			Code: http.StatusNotModified,
 		}, nil
 	}
 
+	onComplete := func(err error) {
+		if err != nil {
+			alog.Errorf("Content Download failed: %v", err)
+			return
+		}
+
+		describe := ca.syncer.GetAppByConn(req.Caller)
+		if describe == nil {
+			return
+		}
+
+		ca.reportUpdatedInfoToRemote(describe, namespace, map[string]string{
+			filename: extend["digest"],
+		})
+	}
+
+	// send the content as raw chunks after the metadata, the reader is closed with the stream
+	if req.AcceptChunked {
+		metadata, err := json.Marshal(FileContent{
+			Extend: extend,
+			Digest: extend["digest"],
+		})
+		if err != nil {
+			r.Close()
+			alog.Errorf("marshal content metadata failed: %v", err)
+			return &cmd.Resp{
+				Code: 501,
+			}, nil
+		}
+		return cmd.RespChunked(string(metadata), r), onComplete
+	}
+
+	defer r.Close()
 	fileData, err := ioutil.ReadAll(r)
 	if err != nil {
 		alog.Errorf("read content failed: %v", err)
@@ -332,25 +368,11 @@ func (ca *Agent) CmdContentHandler(req *cmd.Req) (*cmd.Resp, cmd.OnComplete) {
 		Digest:  extend["digest"],
 	})
 	if err != nil {
-		alog.Error("marshal content failed: %v", err)
+		alog.Errorf("marshal content failed: %v", err)
 		return &cmd.Resp{
 			Code: 501,
 		}, nil
 	}
 
-	return cmd.RespSucceed(string(rtnData)), func(err error) {
-		if err != nil {
-			alog.Errorf("Content Download failed: %v", err)
-			return
-		}
-
-		describe := ca.syncer.GetAppByConn(req.Caller)
-		if describe == nil {
-			return
-		}
-
-		ca.reportUpdatedInfoToRemote(describe, namespace, map[string]string{
-			filename: extend["digest"],
-		})
-	}
+	return cmd.RespSucceed(string(rtnData)), onComplete
 }
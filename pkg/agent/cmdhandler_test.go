@@ -0,0 +1,49 @@
+package agent
+
+import (
+	"testing"
+
+	"code.xxxxx.cn/platform/galaxy/pkg/agent/config"
+	"code.xxxxx.cn/platform/galaxy/pkg/component/cmd"
+	"code.xxxxx.cn/platform/galaxy/pkg/component/cmd/cmdtest"
+)
+
+func TestCmdHelloWorldHandler(t *testing.T) {
+	h := cmdtest.New(t)
+	defer h.Close()
+
+	ca := &Agent{config: &config.AgentConfiguration{ID: "site1"}, cmdClient: h.Client}
+	ca.cmdClient.AddCmdHandler(cmd.HelloWorld, ca.CmdHelloWorldHandler)
+
+	resp, err := h.Server.SendSync(h.Server.NewCmdReq(cmd.HelloWorld, cmd.Args{"name": "manager"}, cmdtest.DefaultClientName), 5)
+	if err != nil {
+		t.Fatalf("send hello failed: %v", err)
+	}
+	if resp.Code != cmd.SuccessCode || resp.Data != "hello manager, i am site1" {
+		t.Errorf("unexpected resp: code=%d data=%q", resp.Code, resp.Data)
+	}
+
+	resp, err = h.Server.SendSync(h.Server.NewCmdReq(cmd.HelloWorld, nil, cmdtest.DefaultClientName), 5)
+	if err != nil {
+		t.Fatalf("send hello failed: %v", err)
+	}
+	if resp.Code != cmd.FailCode {
+		t.Errorf("expect failed resp without name, got code %d", resp.Code)
+	}
+}
+
+func TestCmdNSFileHandlerInvalidArgs(t *testing.T) {
+	h := cmdtest.New(t)
+	defer h.Close()
+
+	ca := &Agent{cmdClient: h.Client}
+	ca.cmdClient.AddCmdHandler(cmd.CmdNSFileHandler, ca.CmdNSFileHandler)
+
+	resp, err := h.Server.SendSync(h.Server.NewCmdReq(cmd.CmdNSFileHandler, cmd.Args{"namespace": "ns"}, cmdtest.DefaultClientName), 5)
+	if err != nil {
+		t.Fatalf("send nsfile failed: %v", err)
+	}
+	if resp.Code != 400 {
+		t.Errorf("expect code 400 of invalid args, got %d", resp.Code)
+	}
+}
@@ -13,6 +13,7 @@ const (
 	DefaultCacheTTL              = 120 * time.Second
 	DefaultHealthzBindAddr       = "0.0.0.0:50066"
 	DefaultMetricsBindAddr       = "0.0.0.0:50077"
+	DefaultAdminBindAddr         = "127.0.0.1:50088"
 	DefaultKubeConnContentType   = "application/vnd.kubernetes.protobuf"
 	DefaultKubeConnectionQPS     = 50
 	DefaultKubeConnectionBurst   = 100
@@ -22,6 +23,17 @@ const (
 	DefaultElectionRenewDeadline = 10 * time.Second
 	DefaultElectionRetryPeriod   = 2 * time.Second
 	DefaultCacheCleanPeriod      = 10 * time.Second
+	DefaultReconnectInitial      = time.Second
+	DefaultReconnectMaxInterval  = 2 * time.Minute
+	DefaultReconnectMultiplier   = 2.0
+	DefaultReconnectJitter       = 0.2
+	DefaultKeepaliveTime         = 30 * time.Second
+	DefaultKeepaliveTimeout      = 10 * time.Second
+	DefaultDiscoveryPeriod       = 30 * time.Second
+	DefaultInventoryPeriod       = 5 * time.Minute
+	DefaultMaterializePeriod     = 5 * time.Minute
+	DefaultHostWriterRoot        = "/data/galaxy"
+	DefaultShutdownTimeout       = 20 * time.Second
 )
 
 // AgentConfiguration is the config file for agent
@@ -34,6 +46,19 @@ type AgentConfiguration struct {
 	ManagerAddr string `yaml:"managerAddr,omitempty"`
 	// ManagerCert is the cert file path provide to manager server connection
 	ManagerCert string `yaml:"managerCert,omitempty"`
+	// ManagerSRV is the DNS SRV name to discover manager servers, eg. _galaxy._tcp.m.xxxxx.cn
+	ManagerSRV string `yaml:"managerSRV,omitempty"`
+	// ManagerEndpointsFile is the yaml file of manager servers endpoints, it is reloaded when modified
+	ManagerEndpointsFile string `yaml:"managerEndpointsFile,omitempty"`
+	// DiscoveryPeriod is the period to discover manager servers by ManagerSRV or ManagerEndpointsFile
+	DiscoveryPeriod time.Duration `yaml:"discoveryPeriod,omitempty"`
+	// InventoryPeriod is the period to report kubernetes workload inventory to manager server
+	InventoryPeriod time.Duration `yaml:"inventoryPeriod,omitempty"`
+	// ShutdownTimeout is the max time to finish the tasks in progress and drain the cmds when shutting down,
+	// keep it less than terminationGracePeriodSeconds of the pod
+	ShutdownTimeout time.Duration `yaml:"shutdownTimeout,omitempty"`
+	// Reconnect defines the backoff and keepalive of connection to manager server
+	Reconnect ReconnectConfig `yaml:"reconnect,omitempty"`
 	// CacheTTL is the expire time of cache
 	CacheTTL         time.Duration `yaml:"cacheTTL,omitempty"`
 	CacheCleanPeriod time.Duration `yaml:"cacheCleanPeriod,omitempty"`
@@ -59,6 +84,16 @@ type AgentConfiguration struct {
 	// MetricsBindAddr is the IP address and port for the metrics server to
 	// serve on, defaulting to 0.0.0.0:60052.
 	MetricsBindAddr string `yaml:"metricsBindAddr,omitempty"`
+	// AdminBindAddr is the IP address and port for the admin server to serve on, defaulting to
+	// 127.0.0.1:50088, empty disables the admin server
+	AdminBindAddr string `yaml:"adminBindAddr,omitempty"`
+	// Materialize defines writing config namespaces into ConfigMaps and Secrets of opted-in kubernetes namespaces
+	Materialize MaterializeConfig `yaml:"materialize,omitempty"`
+	// HostWriter defines projecting config namespaces onto host filesystem for legacy processes
+	HostWriter HostWriterConfig `yaml:"hostWriter,omitempty"`
+	// AdminToken is the bearer token required by admin requests not from localhost,
+	// only localhost is allowed if empty
+	AdminToken string `yaml:"adminToken,omitempty"`
 }
 
 // LeaderElectionConfig is config for leader election
@@ -72,6 +107,34 @@ type LeaderElectionConfig struct {
 	ResourceNamespace string        `yaml:"resourceNamespace"`
 }
 
+// ReconnectConfig is config for reconnecting to manager server and keeping connection alive
+type ReconnectConfig struct {
+	InitialInterval  time.Duration `yaml:"initialInterval"`
+	MaxInterval      time.Duration `yaml:"maxInterval"`
+	Multiplier       float64       `yaml:"multiplier"`
+	Jitter           float64       `yaml:"jitter"`
+	KeepaliveTime    time.Duration `yaml:"keepaliveTime"`
+	KeepaliveTimeout time.Duration `yaml:"keepaliveTimeout"`
+}
+
+// MaterializeConfig is config for materializing config namespaces as kubernetes ConfigMaps and Secrets
+type MaterializeConfig struct {
+	Enabled bool          `yaml:"enabled"`
+	Period  time.Duration `yaml:"period"`
+}
+
+// HostWriterConfig is config for writing config namespaces onto host filesystem
+type HostWriterConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Root is the root directory, files of namespace ns are in <root>/<ns>/current
+	Root string `yaml:"root"`
+	// Namespaces are the config namespaces to write, globs are allowed
+	Namespaces []string `yaml:"namespaces"`
+	// ReloadCmd is the bash command run after files of a namespace written,
+	// GALAXY_NAMESPACE and GALAXY_DIR are exported to it
+	ReloadCmd string `yaml:"reloadCmd"`
+}
+
 // ClientConnectionConfig is config for kubernetes connection
 type ClientConnectionConfig struct {
 	Kubeconfig         string  `yaml:"kubeconfig"`
@@ -102,10 +165,28 @@ func NewDefaultConfig() *AgentConfiguration {
 			QPS:                DefaultKubeConnectionQPS,
 			Burst:              DefaultKubeConnectionBurst,
 		},
-		GRPCPort: DefaultGRPCListenPort,
+		Reconnect: ReconnectConfig{
+			InitialInterval:  DefaultReconnectInitial,
+			MaxInterval:      DefaultReconnectMaxInterval,
+			Multiplier:       DefaultReconnectMultiplier,
+			Jitter:           DefaultReconnectJitter,
+			KeepaliveTime:    DefaultKeepaliveTime,
+			KeepaliveTimeout: DefaultKeepaliveTimeout,
+		},
+		GRPCPort:        DefaultGRPCListenPort,
+		DiscoveryPeriod: DefaultDiscoveryPeriod,
+		InventoryPeriod: DefaultInventoryPeriod,
+		ShutdownTimeout: DefaultShutdownTimeout,
 
 		HealthzBindAddr: DefaultHealthzBindAddr,
 		MetricsBindAddr: DefaultMetricsBindAddr,
+		AdminBindAddr:   DefaultAdminBindAddr,
+		Materialize: MaterializeConfig{
+			Period: DefaultMaterializePeriod,
+		},
+		HostWriter: HostWriterConfig{
+			Root: DefaultHostWriterRoot,
+		},
 
 		CacheCleanPeriod: DefaultCacheCleanPeriod,
 	}
@@ -0,0 +1,108 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clientset "k8s.io/client-go/kubernetes"
+
+	"code.xxxxx.cn/platform/galaxy/pkg/component/cmd"
+	"code.xxxxx.cn/platform/galaxy/pkg/util/alog"
+)
+
+// followLogsCreditTimeout is the max time a follow log stream waits for the caller paused consuming it
+const followLogsCreditTimeout = time.Hour
+
+// openPodLogs open the log stream of pod by kubernetes api, it is replaced in tests
+// as the request returned by GetLogs of the fake clientset can not be streamed
+var openPodLogs = func(ctx context.Context, client clientset.Interface, namespace, pod string, opts *corev1.PodLogOptions) (io.ReadCloser, error) {
+	return client.CoreV1().Pods(namespace).GetLogs(pod, opts).Stream(ctx)
+}
+
+// CmdContainerLogHandler stream the logs of container in pod, the stream is closed when CloseStream cmd received
+func (ca *Agent) CmdContainerLogHandler(req *cmd.Req) (*cmd.Resp, cmd.OnComplete) {
+	namespace := req.Args.Get("namespace")
+	podName := req.Args.Get("pod_name")
+	if namespace == "" || podName == "" {
+		return cmd.RespError(fmt.Errorf("invalid args: namespace: %q, pod: %q", namespace, podName)), nil
+	}
+	opts, err := podLogOptions(req.Args)
+	if err != nil {
+		return cmd.RespError(err), nil
+	}
+
+	pod, err := ca.kubeClient.CoreV1().Pods(namespace).Get(req.Context(), podName, metav1.GetOptions{})
+	if err != nil {
+		return cmd.RespError(fmt.Errorf("get pod %s/%s failed: %v", namespace, podName, err)), nil
+	}
+	// default to the first container as kubernetes requires container name if the pod has several
+	if opts.Container == "" && len(pod.Spec.Containers) > 0 {
+		opts.Container = pod.Spec.Containers[0].Name
+	}
+
+	// the context of req is cancelled when the stream finished or cancelled by caller
+	stream, err := openPodLogs(req.Context(), ca.kubeClient, namespace, podName, opts)
+	if err != nil {
+		return cmd.RespError(fmt.Errorf("get logs of %s/%s/%s failed: %v", namespace, podName, opts.Container, err)), nil
+	}
+	alog.Infof("Streaming logs of %s/%s/%s to %s, follow: %v", namespace, podName, opts.Container, req.Caller, opts.Follow)
+	resp := cmd.RespStream(stream)
+	if opts.Follow {
+		// a follow stream is paused as long as the user pauses to read it, never abort it by the default timeout
+		resp.WithCreditTimeout(followLogsCreditTimeout)
+	}
+	return resp, nil
+}
+
+// podLogOptions build the options of pod logs by cmd args follow, previous, timestamps, since and tail,
+// since is a duration such as 10m or a RFC3339 time
+func podLogOptions(args cmd.Args) (*corev1.PodLogOptions, error) {
+	opts := &corev1.PodLogOptions{Container: args.Get("container")}
+	var err error
+	if opts.Follow, err = parseBoolArg(args, "follow"); err != nil {
+		return nil, err
+	}
+	if opts.Previous, err = parseBoolArg(args, "previous"); err != nil {
+		return nil, err
+	}
+	if opts.Timestamps, err = parseBoolArg(args, "timestamps"); err != nil {
+		return nil, err
+	}
+	if since := args.Get("since"); since != "" {
+		if d, err := time.ParseDuration(since); err == nil {
+			seconds := int64(d.Seconds())
+			opts.SinceSeconds = &seconds
+		} else if t, err := time.Parse(time.RFC3339, since); err == nil {
+			sinceTime := metav1.NewTime(t)
+			opts.SinceTime = &sinceTime
+		} else {
+			return nil, fmt.Errorf("invalid since %q, must be a duration or RFC3339 time", since)
+		}
+	}
+	if tail := args.Get("tail"); tail != "" {
+		lines, err := strconv.ParseInt(tail, 10, 64)
+		if err != nil || lines < 0 {
+			return nil, fmt.Errorf("invalid tail %q, must be a non-negative number", tail)
+		}
+		opts.TailLines = &lines
+	}
+	return opts, nil
+}
+
+// parseBoolArg parse bool arg of key, empty means false
+func parseBoolArg(args cmd.Args, key string) (bool, error) {
+	value := args.Get(key)
+	if value == "" {
+		return false, nil
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("invalid %s %q, must be a bool", key, value)
+	}
+	return b, nil
+}
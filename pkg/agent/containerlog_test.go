@@ -0,0 +1,107 @@
+package agent
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clientset "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"code.xxxxx.cn/platform/galaxy/pkg/component/cmd"
+	"code.xxxxx.cn/platform/galaxy/pkg/component/cmd/cmdtest"
+)
+
+// closeNotifier is a log stream records if closed
+type closeNotifier struct {
+	io.Reader
+	closed chan struct{}
+}
+
+func (c *closeNotifier) Close() error {
+	close(c.closed)
+	return nil
+}
+
+func TestCmdContainerLogHandler(t *testing.T) {
+	h := cmdtest.New(t)
+	defer h.Close()
+
+	client := fake.NewSimpleClientset(&corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "pod"},
+		Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "app"}, {Name: "sidecar"}}},
+	})
+	ca := &Agent{kubeClient: client, cmdClient: h.Client}
+	ca.cmdClient.AddCmdHandler(cmd.GetContainerLog, ca.CmdContainerLogHandler)
+
+	// follow logs never end until closed by caller
+	pr, pw := io.Pipe()
+	defer pw.Close()
+	stream := &closeNotifier{Reader: pr, closed: make(chan struct{})}
+	var got *corev1.PodLogOptions
+	old := openPodLogs
+	defer func() { openPodLogs = old }()
+	openPodLogs = func(ctx context.Context, c clientset.Interface, namespace, pod string, opts *corev1.PodLogOptions) (io.ReadCloser, error) {
+		got = opts
+		return stream, nil
+	}
+
+	// the first response is sent with the first lines of logs
+	go func() {
+		_, _ = pw.Write([]byte("line 1\n"))
+	}()
+	args := cmd.Args{"namespace": "ns", "pod_name": "pod", "follow": "true", "timestamps": "true", "since": "10m", "tail": "100"}
+	resp, err := h.Server.SendSync(h.Server.NewCmdReq(cmd.GetContainerLog, args, cmdtest.DefaultClientName), 5)
+	if err != nil {
+		t.Fatalf("send get log failed: %v", err)
+	}
+	if resp.Code != cmd.SuccessCode {
+		t.Fatalf("expect succeed, got %d %s", resp.Code, resp.Msg)
+	}
+	if got.Container != "app" || !got.Follow || !got.Timestamps || got.Previous ||
+		got.SinceSeconds == nil || *got.SinceSeconds != 600 || got.TailLines == nil || *got.TailLines != 100 {
+		t.Errorf("unexpected log options: %+v", got)
+	}
+
+	line := make([]byte, len("line 1\n"))
+	if _, err := io.ReadFull(resp, line); err != nil || string(line) != "line 1\n" {
+		t.Fatalf("expect log line received, got %q %v", line, err)
+	}
+
+	// closing the resp sends CloseStream cmd to close the log stream
+	if err := resp.Close(); err != nil {
+		t.Fatalf("close resp failed: %v", err)
+	}
+	select {
+	case <-stream.closed:
+	case <-time.After(5 * time.Second):
+		t.Errorf("expect log stream closed by CloseStream cmd")
+	}
+}
+
+func TestCmdContainerLogHandlerInvalid(t *testing.T) {
+	h := cmdtest.New(t)
+	defer h.Close()
+
+	ca := &Agent{kubeClient: fake.NewSimpleClientset(), cmdClient: h.Client}
+	ca.cmdClient.AddCmdHandler(cmd.GetContainerLog, ca.CmdContainerLogHandler)
+
+	for _, args := range []cmd.Args{
+		{"namespace": "ns"},
+		{"namespace": "ns", "pod_name": "pod", "tail": "-1"},
+		{"namespace": "ns", "pod_name": "pod", "since": "yesterday"},
+		// pod not found
+		{"namespace": "ns", "pod_name": "pod"},
+	} {
+		resp, err := h.Server.SendSync(h.Server.NewCmdReq(cmd.GetContainerLog, args, cmdtest.DefaultClientName), 5)
+		if err != nil {
+			t.Fatalf("send get log failed: %v", err)
+		}
+		if resp.Code != cmd.FailCode {
+			t.Errorf("expect failed of args %v, got %d", args, resp.Code)
+		}
+	}
+}
@@ -1,16 +1,38 @@
 package agent
 
-import "code.xxxxx.cn/platform/galaxy/pkg/util/alog"
+import (
+	"time"
 
-//syncClusterStatus .
+	"code.xxxxx.cn/platform/galaxy/pkg/agent/config"
+)
+
+// syncClusterStatus report kubernetes workload inventory to manager after registered, periodically
+// and after resources changed
 func (ca *Agent) syncClusterStatus() {
+	period := ca.config.InventoryPeriod
+	if period <= 0 {
+		period = config.DefaultInventoryPeriod
+	}
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+
+	var debounce <-chan time.Time
 	for {
 		select {
+		case <-ca.stopEverything:
+			return
 		case <-ca.afterSendRegisterCmd:
-			//只需通知一次
-			//同步集群内k8s资源状态到resourcemanager
-			// TODO: sync resource to server
-			alog.Infof("sync all resource success!")
+			// report the whole inventory once connected, as manager may miss the changes while disconnected
+			ca.reportInventory()
+		case <-ticker.C:
+			ca.reportInventory()
+		case <-ca.inventoryCh:
+			if debounce == nil {
+				debounce = time.After(DefaultInventoryDebounce)
+			}
+		case <-debounce:
+			debounce = nil
+			ca.reportInventory()
 		}
 	}
 }
@@ -0,0 +1,129 @@
+package agent
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"code.xxxxx.cn/platform/galaxy/pkg/util/alog"
+)
+
+const (
+	// DefaultTunnelDownTimeout is the max time the tunnel to manager may be down before agent is unhealthy,
+	// it should be longer than the max reconnect interval
+	DefaultTunnelDownTimeout = 5 * time.Minute
+	// healthzProbeFile is the raw file written to check if filedb is writable
+	healthzProbeFile = "healthz/probe"
+)
+
+// tunnelState record the state of the cmd tunnel to manager
+type tunnelState struct {
+	lock    sync.RWMutex
+	running bool
+	ready   bool
+	since   time.Time
+}
+
+// set record the tunnel ready or not since now
+func (t *tunnelState) set(ready bool) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.running, t.ready, t.since = true, ready, time.Now()
+}
+
+// get return if agent running, tunnel ready and the time of last state change
+func (t *tunnelState) get() (bool, bool, time.Time) {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+	return t.running, t.ready, t.since
+}
+
+// healthCheck is a named check, return error if failed
+type healthCheck struct {
+	name  string
+	check func() error
+}
+
+// ServeHealthz start the health check server on addr, /healthz fails if agent is wedged and should be
+// restarted, /readyz fails if agent can not serve apps now
+func (ca *Agent) ServeHealthz(addr string) {
+	mux := http.NewServeMux()
+	mux.Handle("/healthz", healthHandler([]healthCheck{
+		{"filedb", ca.checkFileDB},
+		{"tunnel", ca.checkTunnelAlive},
+	}))
+	mux.Handle("/readyz", healthHandler([]healthCheck{
+		{"filedb", ca.checkFileDB},
+		{"informers", ca.checkInformers},
+		{"tunnel", ca.checkTunnelReady},
+	}))
+	alog.Infof("Healthz server is listening at: %s", addr)
+	alog.Fatal(http.ListenAndServe(addr, mux))
+}
+
+// healthHandler run all checks, response 200 if all passed, or 500 with the failed ones
+func healthHandler(checks []healthCheck) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		failed := false
+		out := bytes.Buffer{}
+		for _, c := range checks {
+			if err := c.check(); err != nil {
+				failed = true
+				fmt.Fprintf(&out, "[-]%s failed: %v\n", c.name, err)
+				continue
+			}
+			fmt.Fprintf(&out, "[+]%s ok\n", c.name)
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		if failed {
+			alog.V(4).Infof("Health check %s failed:\n%s", req.URL.Path, out.String())
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		_, _ = w.Write(out.Bytes())
+	})
+}
+
+// checkFileDB write a probe file to check if filedb is writable
+func (ca *Agent) checkFileDB() error {
+	now := strconv.FormatInt(time.Now().UnixNano(), 10)
+	_, err := ca.fdb.StoreRawFile(healthzProbeFile, nil, bytes.NewReader([]byte(now)))
+	return err
+}
+
+// checkInformers check if the cache of informers synced
+func (ca *Agent) checkInformers() error {
+	select {
+	case <-ca.InformerSynced:
+		return nil
+	default:
+		return fmt.Errorf("informers cache not synced")
+	}
+}
+
+// checkTunnelReady check if the tunnel to manager is ready
+func (ca *Agent) checkTunnelReady() error {
+	running, ready, since := ca.tunnel.get()
+	if !running {
+		return fmt.Errorf("agent not running")
+	}
+	if !ready {
+		return fmt.Errorf("tunnel down since %s", since.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// checkTunnelAlive check if the tunnel to manager is down too long, agent not running such as
+// waiting for leader election is alive
+func (ca *Agent) checkTunnelAlive() error {
+	running, ready, since := ca.tunnel.get()
+	if !running || ready {
+		return nil
+	}
+	if down := time.Since(since); down > DefaultTunnelDownTimeout {
+		return fmt.Errorf("tunnel down for %s since %s", down.Truncate(time.Second), since.Format(time.RFC3339))
+	}
+	return nil
+}
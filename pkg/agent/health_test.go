@@ -0,0 +1,57 @@
+package agent
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"code.xxxxx.cn/platform/galaxy/pkg/component/storage/filedb"
+)
+
+func TestHealthz(t *testing.T) {
+	dir, err := ioutil.TempDir("", "healthz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fdb, err := filedb.NewFileDB(&filedb.Config{Workdir: dir, CasDisable: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca := &Agent{fdb: fdb, InformerSynced: make(chan struct{})}
+
+	probe := func(checks []healthCheck) (int, string) {
+		rec := httptest.NewRecorder()
+		healthHandler(checks).ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+		return rec.Code, rec.Body.String()
+	}
+	healthz := []healthCheck{{"filedb", ca.checkFileDB}, {"tunnel", ca.checkTunnelAlive}}
+	readyz := []healthCheck{{"filedb", ca.checkFileDB}, {"informers", ca.checkInformers}, {"tunnel", ca.checkTunnelReady}}
+
+	// waiting for leader election, alive but not ready
+	if code, body := probe(healthz); code != 200 {
+		t.Errorf("expect healthy before running, got %d %s", code, body)
+	}
+	if code, body := probe(readyz); code != 500 || !strings.Contains(body, "[-]informers") {
+		t.Errorf("expect not ready before informers synced, got %d %s", code, body)
+	}
+
+	close(ca.InformerSynced)
+	ca.tunnel.set(true)
+	if code, body := probe(readyz); code != 200 {
+		t.Errorf("expect ready, got %d %s", code, body)
+	}
+
+	// tunnel down for a short time is alive, too long is wedged
+	ca.tunnel.set(false)
+	if code, body := probe(healthz); code != 200 {
+		t.Errorf("expect healthy when tunnel just down, got %d %s", code, body)
+	}
+	ca.tunnel.since = time.Now().Add(-DefaultTunnelDownTimeout - time.Second)
+	if code, body := probe(healthz); code != 500 || !strings.Contains(body, "[-]tunnel") {
+		t.Errorf("expect unhealthy when tunnel down too long, got %d %s", code, body)
+	}
+}
@@ -0,0 +1,49 @@
+package agent
+
+import (
+	"os"
+
+	"code.xxxxx.cn/platform/galaxy/pkg/agent/hostwriter"
+	"code.xxxxx.cn/platform/galaxy/pkg/agent/syncer"
+	"code.xxxxx.cn/platform/galaxy/pkg/util/alog"
+)
+
+// hostWrittenApp is the app name of config instances written onto host
+const hostWrittenApp = "host"
+
+// setupHostWriter build host writer to write config namespaces onto host filesystem if enabled
+func (ca *Agent) setupHostWriter() {
+	if !ca.config.HostWriter.Enabled {
+		return
+	}
+	ca.hostWriter = hostwriter.New(hostwriter.Config{
+		Root:       ca.config.HostWriter.Root,
+		Namespaces: ca.config.HostWriter.Namespaces,
+		ReloadCmd:  ca.config.HostWriter.ReloadCmd,
+		FDB:        ca.fdb,
+		FM:         ca.fm,
+		Report:     ca.reportHostWritten,
+	})
+	ca.updateHub.OnUpdated(ca.hostWriter.NamespaceUpdated)
+	// instances are deleted by manager when tunnel broken, report all of them again
+	ca.cmdClient.OnReady(func() { ca.hostWriter.SyncAll(true) })
+}
+
+// runHostWriter write the namespaces already in local filedb when started, and resync them periodically
+func (ca *Agent) runHostWriter() {
+	if ca.hostWriter == nil {
+		return
+	}
+	alog.Infof("Starting write config namespaces onto host %s", ca.config.HostWriter.Root)
+	ca.hostWriter.Run(ca.stopEverything)
+}
+
+// reportHostWritten report the files in effect of namespace written onto host as a config instance
+func (ca *Agent) reportHostWritten(res *hostwriter.Result) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		alog.Errorf("Get hostname failed: %v", err)
+	}
+	app := &syncer.AppDescribe{AppID: hostWrittenApp, Hostname: hostname + ":" + res.Dir}
+	ca.reportInstanceToRemote(app, res.Namespace, res.Files, res.Err)
+}
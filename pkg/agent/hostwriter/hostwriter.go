@@ -0,0 +1,285 @@
+package hostwriter
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"code.xxxxx.cn/platform/galaxy/pkg/agent/updater"
+	"code.xxxxx.cn/platform/galaxy/pkg/agent/utils"
+	"code.xxxxx.cn/platform/galaxy/pkg/component/storage/filedb"
+	"code.xxxxx.cn/platform/galaxy/pkg/util/alog"
+	"code.xxxxx.cn/platform/galaxy/pkg/util/cmd"
+)
+
+/* layout of namespace directory, <root>/<namespace>/current links to the versioned directory ..<digest> */
+const (
+	// CurrentLink is the symlink to the directory of files in effect
+	CurrentLink = "current"
+	// versionPrefix is the prefix of versioned directories, hidden from legacy processes listing the namespace directory
+	versionPrefix = ".."
+	// tmpLink is the symlink created before renamed to CurrentLink
+	tmpLink = ".current.tmp"
+)
+
+// DefaultPeriod is the period to resync namespaces, which retries the failed writes and reloads
+const DefaultPeriod = time.Minute
+
+// Result is the result of writing a namespace onto host
+type Result struct {
+	Namespace string
+	// Dir is the path of CurrentLink
+	Dir string
+	// Files is the digests of files in effect by filename
+	Files map[string]string
+	// Err is the failure of writing files or running reload cmd
+	Err error
+}
+
+// Config of Writer
+type Config struct {
+	// Root is the root directory of namespaces
+	Root string
+	// Namespaces are the config namespaces to write, globs are allowed
+	Namespaces []string
+	// ReloadCmd is the bash command run after files of namespace written, GALAXY_NAMESPACE and GALAXY_DIR are exported
+	ReloadCmd string
+	FDB       *filedb.FileDB
+	FM        *updater.FileMapper
+	// Report is called after namespace written or failed, or for every namespace when resync forced
+	Report func(res *Result)
+}
+
+// Writer project config namespaces in filedb onto host filesystem for legacy processes, files are written into
+// a new versioned directory and switched by renaming a symlink atomically, like the atomic writer of kubelet
+type Writer struct {
+	cfg  Config
+	lock sync.Mutex
+	// applied is the digests of files in effect by namespace, recorded after reloaded
+	applied map[string]map[string]string
+	// unreloaded is the namespaces written but failed to reload, retried by the next write
+	unreloaded map[string]struct{}
+}
+
+// New build a Writer
+func New(cfg Config) *Writer {
+	return &Writer{
+		cfg:        cfg,
+		applied:    map[string]map[string]string{},
+		unreloaded: map[string]struct{}{},
+	}
+}
+
+// Run write all selected namespaces, and resync them periodically until stopCh closed
+func (w *Writer) Run(stopCh <-chan struct{}) {
+	w.SyncAll(false)
+	ticker := time.NewTicker(DefaultPeriod)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C:
+			w.SyncAll(false)
+		}
+	}
+}
+
+// NamespaceUpdated write the namespace if it is selected, it is registered as callback of UpdateHub
+func (w *Writer) NamespaceUpdated(namespace string, files []string) {
+	if !w.selected(namespace) {
+		return
+	}
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	w.write(namespace, false)
+}
+
+// SyncAll write all selected namespaces, report all of them if report is true
+func (w *Writer) SyncAll(report bool) {
+	namespaces := make([]string, 0)
+	for ns := range w.cfg.FM.Copy() {
+		if w.selected(ns) {
+			namespaces = append(namespaces, ns)
+		}
+	}
+	sort.Strings(namespaces)
+
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	for _, ns := range namespaces {
+		w.write(ns, report)
+	}
+}
+
+// selected check if namespace matched by any glob of config
+func (w *Writer) selected(namespace string) bool {
+	for _, pattern := range w.cfg.Namespaces {
+		if ok, _ := path.Match(pattern, namespace); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// write write files of namespace and run reload cmd if changed or failed to reload before, and report the result
+func (w *Writer) write(namespace string, report bool) {
+	files := w.cfg.FM.Copy()[namespace]
+	res := &Result{Namespace: namespace, Dir: filepath.Join(w.cfg.Root, namespace, CurrentLink), Files: w.applied[namespace]}
+
+	changed, err := w.writeNamespace(namespace, files)
+	_, unreloaded := w.unreloaded[namespace]
+	switch {
+	case err != nil:
+		res.Err = err
+		alog.Errorf("Write namespace %s onto host failed: %v", namespace, err)
+	case changed || unreloaded:
+		if changed {
+			alog.Infof("Wrote namespace %s onto host %s", namespace, res.Dir)
+		}
+		if res.Err = w.reload(namespace, res.Dir); res.Err != nil {
+			w.unreloaded[namespace] = struct{}{}
+			alog.Errorf("Reload namespace %s failed: %v", namespace, res.Err)
+			break
+		}
+		delete(w.unreloaded, namespace)
+		res.Files = files
+		w.applied[namespace] = files
+	default:
+		res.Files = files
+		w.applied[namespace] = files
+		if !report {
+			return
+		}
+	}
+	if res.Files == nil {
+		// nothing in effect, report the files failed to write without digest
+		res.Files = map[string]string{}
+		for filename := range files {
+			res.Files[filename] = ""
+		}
+	}
+	if w.cfg.Report != nil {
+		w.cfg.Report(res)
+	}
+}
+
+// writeNamespace write files into a new versioned directory and switch current link to it, return false
+// if the current one has the same files
+func (w *Writer) writeNamespace(namespace string, files map[string]string) (bool, error) {
+	if !validName(namespace) {
+		return false, fmt.Errorf("invalid namespace name %q", namespace)
+	}
+	nsDir := filepath.Join(w.cfg.Root, namespace)
+	if err := os.MkdirAll(nsDir, 0755); err != nil {
+		return false, err
+	}
+	version := versionPrefix + filesDigest(files)[:16]
+	if current, err := os.Readlink(filepath.Join(nsDir, CurrentLink)); err == nil && current == version {
+		return false, nil
+	}
+
+	// a directory of the same version may be left by a failed write
+	versionDir := filepath.Join(nsDir, version)
+	if err := os.RemoveAll(versionDir); err != nil {
+		return false, err
+	}
+	if err := os.Mkdir(versionDir, 0755); err != nil {
+		return false, err
+	}
+	for filename := range files {
+		if err := w.writeFile(versionDir, namespace, filename); err != nil {
+			_ = os.RemoveAll(versionDir)
+			return false, err
+		}
+	}
+
+	// rename is atomic, readers always see either the old or the new directory
+	link := filepath.Join(nsDir, tmpLink)
+	if err := os.Remove(link); err != nil && !os.IsNotExist(err) {
+		return false, err
+	}
+	if err := os.Symlink(version, link); err != nil {
+		return false, err
+	}
+	if err := os.Rename(link, filepath.Join(nsDir, CurrentLink)); err != nil {
+		return false, err
+	}
+
+	// remove the old versions, processes still reading them keep the opened files
+	entries, err := ioutil.ReadDir(nsDir)
+	if err != nil {
+		return true, nil
+	}
+	for _, entry := range entries {
+		if entry.IsDir() && strings.HasPrefix(entry.Name(), versionPrefix) && entry.Name() != version {
+			if err := os.RemoveAll(filepath.Join(nsDir, entry.Name())); err != nil {
+				alog.Warningf("Remove old version %s of namespace %s failed: %v", entry.Name(), namespace, err)
+			}
+		}
+	}
+	return true, nil
+}
+
+// writeFile copy the config file from filedb into dir
+func (w *Writer) writeFile(dir, namespace, filename string) error {
+	if !validName(filename) {
+		return fmt.Errorf("invalid file name %q", filename)
+	}
+	_, r, err := w.cfg.FDB.VisitConfig(utils.FdbSite, namespace, filename, utils.FdbVersion)
+	if err != nil {
+		return fmt.Errorf("visit config %s/%s failed: %v", namespace, filename, err)
+	}
+	defer r.Close()
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("read config %s/%s failed: %v", namespace, filename, err)
+	}
+	return ioutil.WriteFile(filepath.Join(dir, filename), data, 0644)
+}
+
+// reload run the reload cmd of namespace if configured
+func (w *Writer) reload(namespace, dir string) error {
+	if w.cfg.ReloadCmd == "" {
+		return nil
+	}
+	sh := fmt.Sprintf("export GALAXY_NAMESPACE=%s GALAXY_DIR=%s; %s", quote(namespace), quote(dir), w.cfg.ReloadCmd)
+	out, err := cmd.RunBash(sh)
+	if err != nil {
+		return err
+	}
+	alog.Infof("Reloaded namespace %s: %s", namespace, out)
+	return nil
+}
+
+// validName check if name is a plain name of file or directory, which could not escape the parent directory
+func validName(name string) bool {
+	return name != "" && name != "." && name != ".." && !strings.ContainsAny(name, `/\`)
+}
+
+// quote quote s as a single word of bash
+func quote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+// filesDigest build the digest of files by their names and digests
+func filesDigest(files map[string]string) string {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	h := sha256.New()
+	for _, name := range names {
+		fmt.Fprintf(h, "%s=%s\n", name, files[name])
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,125 @@
+package hostwriter
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"code.xxxxx.cn/platform/galaxy/pkg/agent/updater"
+	"code.xxxxx.cn/platform/galaxy/pkg/agent/utils"
+	"code.xxxxx.cn/platform/galaxy/pkg/component/storage/filedb"
+)
+
+func TestWriter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hostwriter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fdb, err := filedb.NewFileDB(&filedb.Config{Workdir: filepath.Join(dir, "fdb"), CasDisable: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fm := updater.NewFileMapper(fdb)
+	store := func(namespace, filename, content string) {
+		digest, err := fdb.StoreConfig(utils.FdbSite, namespace, filename, utils.FdbVersion, nil, strings.NewReader(content))
+		if err != nil {
+			t.Fatal(err)
+		}
+		fm.Update(namespace, map[string]string{filename: digest})
+	}
+	store("app", "app.yaml", "port: 80")
+	store("other", "other.yaml", "other")
+
+	root := filepath.Join(dir, "root")
+	reloaded := filepath.Join(dir, "reloaded")
+	var results []*Result
+	w := New(Config{
+		Root:       root,
+		Namespaces: []string{"app*"},
+		ReloadCmd:  "echo $GALAXY_NAMESPACE $GALAXY_DIR >> " + reloaded,
+		FDB:        fdb,
+		FM:         fm,
+		Report:     func(res *Result) { results = append(results, res) },
+	})
+	readCurrent := func(filename string) string {
+		data, err := ioutil.ReadFile(filepath.Join(root, "app", CurrentLink, filename))
+		if err != nil {
+			t.Fatalf("read %s failed: %v", filename, err)
+		}
+		return string(data)
+	}
+
+	w.SyncAll(false)
+	if got := readCurrent("app.yaml"); got != "port: 80" {
+		t.Errorf("expect file written, got %q", got)
+	}
+	if _, err := os.Stat(filepath.Join(root, "other")); !os.IsNotExist(err) {
+		t.Errorf("expect namespace not selected not written")
+	}
+	data, _ := ioutil.ReadFile(reloaded)
+	if string(data) != "app "+filepath.Join(root, "app", CurrentLink)+"\n" {
+		t.Errorf("expect reload cmd run with namespace and dir, got %q", data)
+	}
+	if len(results) != 1 || results[0].Err != nil || results[0].Files["app.yaml"] != fm.Get("app", "app.yaml") {
+		t.Fatalf("expect written reported, got %+v", results)
+	}
+
+	// nothing written or reported if not changed, unless report forced
+	results = nil
+	w.SyncAll(false)
+	if len(results) != 0 {
+		t.Errorf("expect nothing reported, got %+v", results)
+	}
+	w.SyncAll(true)
+	if len(results) != 1 {
+		t.Errorf("expect reported when forced, got %+v", results)
+	}
+
+	// the current link is switched to the new version, and the old one removed
+	results = nil
+	old, _ := os.Readlink(filepath.Join(root, "app", CurrentLink))
+	store("app", "app.yaml", "port: 8080")
+	w.NamespaceUpdated("app", []string{"app.yaml"})
+	if got := readCurrent("app.yaml"); got != "port: 8080" {
+		t.Errorf("expect file updated, got %q", got)
+	}
+	if _, err := os.Stat(filepath.Join(root, "app", old)); !os.IsNotExist(err) {
+		t.Errorf("expect old version %s removed", old)
+	}
+	if len(results) != 1 || results[0].Files["app.yaml"] != fm.Get("app", "app.yaml") {
+		t.Errorf("expect update reported, got %+v", results)
+	}
+
+	// reload failure is reported with the files of former version in effect, and retried until succeed
+	results = nil
+	w.cfg.ReloadCmd = "exit 1"
+	reloadedDigest := fm.Get("app", "app.yaml")
+	store("app", "app.yaml", "port: 9090")
+	w.NamespaceUpdated("app", []string{"app.yaml"})
+	w.SyncAll(false)
+	if len(results) != 2 || results[0].Err == nil || results[1].Err == nil || results[1].Files["app.yaml"] != reloadedDigest {
+		t.Errorf("expect reload failure reported and retried, got %+v", results)
+	}
+	results = nil
+	w.cfg.ReloadCmd = "true"
+	w.SyncAll(false)
+	w.SyncAll(false)
+	if len(results) != 1 || results[0].Err != nil || results[0].Files["app.yaml"] != fm.Get("app", "app.yaml") {
+		t.Errorf("expect reload retried once succeed, got %+v", results)
+	}
+
+	// write failure is reported with the files of former version in effect
+	results = nil
+	applied := fm.Get("app", "app.yaml")
+	fm.Update("app", map[string]string{"../escape": "digest"})
+	w.NamespaceUpdated("app", []string{"../escape"})
+	if len(results) != 1 || results[0].Err == nil || results[0].Files["app.yaml"] != applied {
+		t.Errorf("expect write failure reported, got %+v", results)
+	}
+	if got := readCurrent("app.yaml"); got != "port: 9090" {
+		t.Errorf("expect current version kept, got %q", got)
+	}
+}
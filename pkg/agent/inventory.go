@@ -0,0 +1,183 @@
+package agent
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/tools/cache"
+
+	"code.xxxxx.cn/platform/galaxy/pkg/agent/utils"
+	"code.xxxxx.cn/platform/galaxy/pkg/apis"
+	"code.xxxxx.cn/platform/galaxy/pkg/component/cmd"
+	"code.xxxxx.cn/platform/galaxy/pkg/util/alog"
+)
+
+// DefaultInventoryDebounce is the delay to report inventory after resources changed, changes in it are merged
+const DefaultInventoryDebounce = 10 * time.Second
+
+// addInventoryHandlers watch the resources of inventory, and notify to report when any of them changed
+func (ca *Agent) addInventoryHandlers() {
+	handler := cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(interface{}) { ca.inventoryChanged() },
+		UpdateFunc: func(interface{}, interface{}) { ca.inventoryChanged() },
+		DeleteFunc: func(interface{}) { ca.inventoryChanged() },
+	}
+	ca.informers.Core().V1().Nodes().Informer().AddEventHandler(handler)
+	ca.informers.Core().V1().Namespaces().Informer().AddEventHandler(handler)
+	ca.informers.Apps().V1().Deployments().Informer().AddEventHandler(handler)
+	ca.informers.Core().V1().Pods().Informer().AddEventHandler(handler)
+}
+
+// inventoryChanged notify to report inventory without blocking, notifies not consumed yet are merged
+func (ca *Agent) inventoryChanged() {
+	select {
+	case ca.inventoryCh <- struct{}{}:
+	default:
+	}
+}
+
+// reportInventory send inventory built from informer caches to manager, skipped before caches synced
+func (ca *Agent) reportInventory() {
+	select {
+	case <-ca.InformerSynced:
+	default:
+		alog.V(4).Infof("Informers not synced, skip reporting inventory")
+		return
+	}
+	inventory, err := ca.buildInventory()
+	if err != nil {
+		alog.Errorf("Build inventory failed: %v", err)
+		return
+	}
+	req := ca.cmdClient.NewCmdReq(cmd.ReportInventory, nil)
+	if err := cmd.SetInventoryArgs(req, inventory); err != nil {
+		alog.Errorf("Report inventory failed: %v", err)
+		return
+	}
+	if _, err := ca.cmdClient.SendSync(req, DefaultServerTimeout); err != nil {
+		alog.Errorf("Report inventory failed: %v", err)
+		return
+	}
+	ca.ClusterStatusSynced = true
+	alog.V(4).Infof("Reported inventory: %d nodes, %d namespaces, %d deployments, %d pods",
+		len(inventory.Nodes), len(inventory.Namespaces), len(inventory.Deployments), len(inventory.Pods))
+}
+
+// buildInventory build the summary of nodes, namespaces, deployments and pods from informer caches
+func (ca *Agent) buildInventory() (*apis.ClusterInventory, error) {
+	inventory := &apis.ClusterInventory{
+		SiteID:      ca.config.ID,
+		ReportedAt:  time.Now(),
+		Nodes:       []apis.NodeSummary{},
+		Namespaces:  []apis.NamespaceSummary{},
+		Deployments: []apis.DeploymentSummary{},
+		Pods:        []apis.PodSummary{},
+	}
+
+	nodes, err := ca.informers.Core().V1().Nodes().Lister().List(labels.Everything())
+	if err != nil {
+		return nil, fmt.Errorf("list nodes failed: %v", err)
+	}
+	for _, node := range nodes {
+		inventory.Nodes = append(inventory.Nodes, apis.NodeSummary{
+			Name:           node.Name,
+			Ready:          nodeReady(node),
+			Unschedulable:  node.Spec.Unschedulable,
+			KubeletVersion: node.Status.NodeInfo.KubeletVersion,
+		})
+	}
+	sort.Slice(inventory.Nodes, func(i, j int) bool { return inventory.Nodes[i].Name < inventory.Nodes[j].Name })
+
+	namespaces, err := ca.informers.Core().V1().Namespaces().Lister().List(labels.Everything())
+	if err != nil {
+		return nil, fmt.Errorf("list namespaces failed: %v", err)
+	}
+	for _, ns := range namespaces {
+		inventory.Namespaces = append(inventory.Namespaces, apis.NamespaceSummary{
+			Name:  ns.Name,
+			Phase: string(ns.Status.Phase),
+		})
+	}
+	sort.Slice(inventory.Namespaces, func(i, j int) bool { return inventory.Namespaces[i].Name < inventory.Namespaces[j].Name })
+
+	deployments, err := ca.informers.Apps().V1().Deployments().Lister().List(labels.Everything())
+	if err != nil {
+		return nil, fmt.Errorf("list deployments failed: %v", err)
+	}
+	for _, deploy := range deployments {
+		inventory.Deployments = append(inventory.Deployments, deploymentSummary(deploy))
+	}
+	sort.Slice(inventory.Deployments, func(i, j int) bool {
+		a, b := inventory.Deployments[i], inventory.Deployments[j]
+		return a.Namespace < b.Namespace || a.Namespace == b.Namespace && a.Name < b.Name
+	})
+
+	pods, err := ca.podLister.List(labels.Everything())
+	if err != nil {
+		return nil, fmt.Errorf("list pods failed: %v", err)
+	}
+	for _, pod := range pods {
+		inventory.Pods = append(inventory.Pods, podSummary(pod))
+	}
+	sort.Slice(inventory.Pods, func(i, j int) bool {
+		a, b := inventory.Pods[i], inventory.Pods[j]
+		return a.Namespace < b.Namespace || a.Namespace == b.Namespace && a.Name < b.Name
+	})
+	return inventory, nil
+}
+
+// nodeReady check if the Ready condition of node is true
+func nodeReady(node *v1.Node) bool {
+	for _, c := range node.Status.Conditions {
+		if c.Type == v1.NodeReady {
+			return c.Status == v1.ConditionTrue
+		}
+	}
+	return false
+}
+
+func deploymentSummary(deploy *appsv1.Deployment) apis.DeploymentSummary {
+	s := apis.DeploymentSummary{
+		Namespace:         deploy.Namespace,
+		Name:              deploy.Name,
+		Replicas:          1,
+		ReadyReplicas:     deploy.Status.ReadyReplicas,
+		UpdatedReplicas:   deploy.Status.UpdatedReplicas,
+		AvailableReplicas: deploy.Status.AvailableReplicas,
+	}
+	// replicas defaults to 1 if not specified
+	if deploy.Spec.Replicas != nil {
+		s.Replicas = *deploy.Spec.Replicas
+	}
+	for _, c := range deploy.Spec.Template.Spec.Containers {
+		s.Images = append(s.Images, c.Image)
+	}
+	return s
+}
+
+func podSummary(pod *v1.Pod) apis.PodSummary {
+	s := apis.PodSummary{
+		Namespace: pod.Namespace,
+		Name:      pod.Name,
+		Node:      pod.Spec.NodeName,
+		IP:        pod.Status.PodIP,
+		Phase:     string(pod.Status.Phase),
+		MayaApp:   utils.IsMayaApplicationPod(pod),
+	}
+	for _, c := range pod.Status.Conditions {
+		if c.Type == v1.PodReady {
+			s.Ready = c.Status == v1.ConditionTrue
+		}
+	}
+	for _, c := range pod.Spec.Containers {
+		s.Images = append(s.Images, c.Image)
+	}
+	for _, cs := range pod.Status.ContainerStatuses {
+		s.Restarts += cs.RestartCount
+	}
+	return s
+}
@@ -0,0 +1,111 @@
+package agent
+
+import (
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"code.xxxxx.cn/platform/galaxy/pkg/agent/config"
+	"code.xxxxx.cn/platform/galaxy/pkg/apis"
+	"code.xxxxx.cn/platform/galaxy/pkg/component/cmd"
+	"code.xxxxx.cn/platform/galaxy/pkg/component/cmd/cmdtest"
+)
+
+func TestReportInventory(t *testing.T) {
+	h := cmdtest.New(t)
+	defer h.Close()
+
+	replicas := int32(2)
+	client := fake.NewSimpleClientset(
+		&corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: "node-1"},
+			Status: corev1.NodeStatus{
+				Conditions: []corev1.NodeCondition{{Type: corev1.NodeReady, Status: corev1.ConditionTrue}},
+				NodeInfo:   corev1.NodeSystemInfo{KubeletVersion: "v1.18.6"},
+			},
+		},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "ns"}, Status: corev1.NamespaceStatus{Phase: corev1.NamespaceActive}},
+		&appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "app"},
+			Spec: appsv1.DeploymentSpec{
+				Replicas: &replicas,
+				Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{Containers: []corev1.Container{{Image: "app:v1"}}}},
+			},
+			Status: appsv1.DeploymentStatus{ReadyReplicas: 1},
+		},
+		&corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "app-b", Labels: map[string]string{"maya": "app"}},
+			Spec:       corev1.PodSpec{NodeName: "node-1", Containers: []corev1.Container{{Image: "app:v1"}}},
+			Status: corev1.PodStatus{
+				Phase:             corev1.PodRunning,
+				Conditions:        []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}},
+				ContainerStatuses: []corev1.ContainerStatus{{RestartCount: 3}},
+			},
+		},
+		&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "app-a"}},
+	)
+	factory := informers.NewSharedInformerFactory(client, 0)
+	ca := &Agent{
+		config:         &config.AgentConfiguration{ID: "site"},
+		informers:      factory,
+		cmdClient:      h.Client,
+		podLister:      factory.Core().V1().Pods().Lister(),
+		InformerSynced: make(chan struct{}),
+		inventoryCh:    make(chan struct{}, 1),
+	}
+	ca.addInventoryHandlers()
+
+	got := make(chan *apis.ClusterInventory, 1)
+	h.Server.AddCmdHandler(cmd.ReportInventory, cmd.HandleReportInventory(func(req *cmd.Req, inventory *apis.ClusterInventory) (*cmd.Resp, cmd.OnComplete) {
+		got <- inventory
+		return cmd.RespSucceed("success"), nil
+	}))
+
+	// nothing reported before informers synced
+	ca.reportInventory()
+	if ca.ClusterStatusSynced {
+		t.Fatalf("expect not reported before informers synced")
+	}
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	factory.Start(stopCh)
+	factory.WaitForCacheSync(stopCh)
+	close(ca.InformerSynced)
+	select {
+	case <-ca.inventoryCh:
+	default:
+		t.Errorf("expect inventory changed notified by informers")
+	}
+
+	ca.reportInventory()
+	var inventory *apis.ClusterInventory
+	select {
+	case inventory = <-got:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expect inventory reported")
+	}
+	if inventory.SiteID != "site" || len(inventory.Nodes) != 1 || !inventory.Nodes[0].Ready || inventory.Nodes[0].KubeletVersion != "v1.18.6" {
+		t.Errorf("unexpected nodes: %+v", inventory.Nodes)
+	}
+	if len(inventory.Namespaces) != 1 || inventory.Namespaces[0].Phase != "Active" {
+		t.Errorf("unexpected namespaces: %+v", inventory.Namespaces)
+	}
+	if len(inventory.Deployments) != 1 || inventory.Deployments[0].Replicas != 2 || inventory.Deployments[0].ReadyReplicas != 1 {
+		t.Errorf("unexpected deployments: %+v", inventory.Deployments)
+	}
+	if len(inventory.Pods) != 2 || inventory.Pods[0].Name != "app-a" || inventory.Pods[0].MayaApp {
+		t.Fatalf("unexpected pods: %+v", inventory.Pods)
+	}
+	if p := inventory.Pods[1]; !p.MayaApp || !p.Ready || p.Restarts != 3 || p.Node != "node-1" || p.Images[0] != "app:v1" {
+		t.Errorf("unexpected maya pod: %+v", p)
+	}
+	if !ca.ClusterStatusSynced {
+		t.Errorf("expect cluster status synced after reported")
+	}
+}
@@ -0,0 +1,83 @@
+package agent
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/client-go/tools/cache"
+
+	"code.xxxxx.cn/platform/galaxy/pkg/agent/materializer"
+	"code.xxxxx.cn/platform/galaxy/pkg/agent/syncer"
+	"code.xxxxx.cn/platform/galaxy/pkg/component/cmd"
+	pb "code.xxxxx.cn/platform/galaxy/pkg/component/cmd/v1"
+	"code.xxxxx.cn/platform/galaxy/pkg/util/alog"
+)
+
+// materializedApp is the app name of config instances materialized as kubernetes objects
+const materializedApp = "kubernetes"
+
+// setupMaterializer build materializer to write config namespaces into kubernetes objects if enabled
+func (ca *Agent) setupMaterializer() {
+	if !ca.config.Materialize.Enabled {
+		return
+	}
+	ca.materializer = materializer.New(materializer.Config{
+		Client:          ca.kubeClient,
+		NamespaceLister: ca.informers.Core().V1().Namespaces().Lister(),
+		FDB:             ca.fdb,
+		FM:              ca.fm,
+		Report:          ca.reportMaterialized,
+		Cancel:          ca.cancelMaterialized,
+	})
+	ca.updateHub.OnUpdated(ca.materializer.NamespaceUpdated)
+	// resync when namespaces opt in or out
+	ca.informers.Core().V1().Namespaces().Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(interface{}) { ca.materializer.Trigger(false) },
+		UpdateFunc: func(interface{}, interface{}) { ca.materializer.Trigger(false) },
+		DeleteFunc: func(interface{}) { ca.materializer.Trigger(false) },
+	})
+	// instances are deleted by manager when tunnel broken, report all of them again
+	ca.cmdClient.OnReady(func() { ca.materializer.Trigger(true) })
+}
+
+// runMaterializer run materializer after informers synced
+func (ca *Agent) runMaterializer() {
+	if ca.materializer == nil {
+		return
+	}
+	select {
+	case <-ca.InformerSynced:
+	case <-ca.stopEverything:
+		return
+	}
+	alog.Infof("Starting materialize config namespaces into kubernetes objects")
+	ca.materializer.Trigger(true)
+	ca.materializer.Run(ca.config.Materialize.Period, ca.stopEverything)
+}
+
+// materializedHostname is the hostname of config instance of the object materialized
+func materializedHostname(ins *materializer.Instance) string {
+	return fmt.Sprintf("%s/%s/%s", strings.ToLower(ins.Kind), ins.Namespace, ins.Name)
+}
+
+// reportMaterialized report digests of files in the object materialized as a config instance
+func (ca *Agent) reportMaterialized(ins *materializer.Instance) {
+	app := &syncer.AppDescribe{AppID: materializedApp, Hostname: materializedHostname(ins)}
+	ca.reportUpdatedInfoToRemote(app, ins.ConfigNamespace, ins.Files)
+}
+
+// cancelMaterialized cancel the config instance of the object deleted
+func (ca *Agent) cancelMaterialized(ins *materializer.Instance) {
+	req := ca.cmdClient.NewCmdReq(cmd.AppCancelHandler, nil)
+	if err := cmd.SetAppCancelPayload(req, &pb.AppCancelPayload{
+		Site:     ca.config.ID,
+		App:      materializedApp,
+		Hostname: materializedHostname(ins),
+	}); err != nil {
+		alog.Errorf("Cancel materialized %s %s/%s failed: %v", ins.Kind, ins.Namespace, ins.Name, err)
+		return
+	}
+	if _, err := ca.cmdClient.SendSync(req, DefaultServerTimeout); err != nil {
+		alog.Errorf("Cancel materialized %s %s/%s failed: %v", ins.Kind, ins.Namespace, ins.Name, err)
+	}
+}
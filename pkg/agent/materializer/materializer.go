@@ -0,0 +1,496 @@
+package materializer
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	clientset "k8s.io/client-go/kubernetes"
+	corelisters "k8s.io/client-go/listers/core/v1"
+
+	"code.xxxxx.cn/platform/galaxy/pkg/agent/updater"
+	"code.xxxxx.cn/platform/galaxy/pkg/agent/utils"
+	"code.xxxxx.cn/platform/galaxy/pkg/component/storage/filedb"
+	"code.xxxxx.cn/platform/galaxy/pkg/util/alog"
+)
+
+/* labels and annotations of kubernetes namespaces to opt in, and of the objects materialized */
+const (
+	// LabelMaterialize opt in the kubernetes namespace if it is "true"
+	LabelMaterialize = "galaxy.xxxxx.cn/materialize"
+	// AnnotationConfigNamespaces is the comma separated config namespaces to materialize, globs are allowed, eg. "app-*"
+	AnnotationConfigNamespaces = "galaxy.xxxxx.cn/config-namespaces"
+	// AnnotationSecretFiles is the comma separated files written into Secret instead of ConfigMap,
+	// in format namespace/filename, globs are allowed, eg. "app/*.key"
+	AnnotationSecretFiles = "galaxy.xxxxx.cn/secret-files"
+
+	// LabelManagedBy mark the objects materialized by agent
+	LabelManagedBy = "app.kubernetes.io/managed-by"
+	// ManagedByAgent is the value of LabelManagedBy
+	ManagedByAgent = "galaxy-agent"
+	// LabelConfigNamespace is the config namespace of the object materialized, the label value is sanitized
+	// and the annotation of the same key keeps the original one
+	LabelConfigNamespace = "galaxy.xxxxx.cn/config-namespace"
+	// AnnotationDigest is the digest of files in the object materialized
+	AnnotationDigest = "galaxy.xxxxx.cn/digest"
+
+	// KindConfigMap kind of object materialized as ConfigMap
+	KindConfigMap = "ConfigMap"
+	// KindSecret kind of object materialized as Secret
+	KindSecret = "Secret"
+
+	// DefaultPeriod default period to resync all objects
+	DefaultPeriod = 5 * time.Minute
+	// maxObjectSize is the max size of data of ConfigMap and Secret limited by apiserver
+	maxObjectSize = 1 << 20
+)
+
+// Instance is an object materialized from a config namespace
+type Instance struct {
+	Kind            string
+	Namespace       string
+	Name            string
+	ConfigNamespace string
+	// Files is the digests of files in the object by filename
+	Files  map[string]string
+	Digest string
+}
+
+// Config of Materializer
+type Config struct {
+	Client          clientset.Interface
+	NamespaceLister corelisters.NamespaceLister
+	FDB             *filedb.FileDB
+	FM              *updater.FileMapper
+	// Report is called after an object written, or for every object when resync forced
+	Report func(ins *Instance)
+	// Cancel is called after an object deleted
+	Cancel func(ins *Instance)
+}
+
+// Materializer write config namespaces in filedb into ConfigMaps and Secrets of opted-in kubernetes namespaces,
+// so that workloads without sdk could mount the configs
+type Materializer struct {
+	cfg     Config
+	lock    sync.Mutex
+	trigger chan bool
+}
+
+// New build a Materializer
+func New(cfg Config) *Materializer {
+	return &Materializer{
+		cfg:     cfg,
+		trigger: make(chan bool, 1),
+	}
+}
+
+// Run resync all objects every period, or when triggered, until stopCh closed
+func (m *Materializer) Run(period time.Duration, stopCh <-chan struct{}) {
+	if period <= 0 {
+		period = DefaultPeriod
+	}
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+	for {
+		report := false
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C:
+		case report = <-m.trigger:
+		}
+		if err := m.SyncAll(report); err != nil {
+			alog.Errorf("Materialize configs failed: %v", err)
+		}
+	}
+}
+
+// Trigger resync all objects without blocking, report all of them if report is true
+func (m *Materializer) Trigger(report bool) {
+	select {
+	case m.trigger <- report:
+	default:
+		if report {
+			// replace the pending one to not lose the report
+			select {
+			case <-m.trigger:
+			default:
+			}
+			m.trigger <- report
+		}
+	}
+}
+
+// NamespaceUpdated resync the objects of config namespace in all opted-in kubernetes namespaces,
+// it is registered as callback of UpdateHub
+func (m *Materializer) NamespaceUpdated(namespace string, files []string) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	namespaces, err := m.optedInNamespaces()
+	if err != nil {
+		alog.Errorf("Materialize config namespace %s failed: %v", namespace, err)
+		return
+	}
+	for _, ns := range namespaces {
+		if !matchAny(splitList(ns.Annotations[AnnotationConfigNamespaces]), namespace) {
+			continue
+		}
+		if err := m.sync(ns, namespace, false, nil); err != nil {
+			alog.Errorf("Materialize config namespace %s into %s failed: %v", namespace, ns.Name, err)
+		}
+	}
+}
+
+// SyncAll write objects of all opted-in kubernetes namespaces, and delete the ones not desired any more
+func (m *Materializer) SyncAll(report bool) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	namespaces, err := m.optedInNamespaces()
+	if err != nil {
+		return err
+	}
+	configNamespaces := make([]string, 0)
+	for ns := range m.cfg.FM.Copy() {
+		configNamespaces = append(configNamespaces, ns)
+	}
+	sort.Strings(configNamespaces)
+
+	desired := map[string]bool{}
+	var errs []string
+	for _, ns := range namespaces {
+		patterns := splitList(ns.Annotations[AnnotationConfigNamespaces])
+		for _, configNs := range configNamespaces {
+			if !matchAny(patterns, configNs) {
+				continue
+			}
+			if err := m.sync(ns, configNs, report, desired); err != nil {
+				errs = append(errs, fmt.Sprintf("%s/%s: %v", ns.Name, configNs, err))
+			}
+		}
+	}
+	if err := m.cleanup(desired); err != nil {
+		errs = append(errs, err.Error())
+	}
+	if len(errs) != 0 {
+		return fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// optedInNamespaces list the kubernetes namespaces opted in
+func (m *Materializer) optedInNamespaces() ([]*v1.Namespace, error) {
+	selector := labels.SelectorFromSet(labels.Set{LabelMaterialize: "true"})
+	namespaces, err := m.cfg.NamespaceLister.List(selector)
+	if err != nil {
+		return nil, fmt.Errorf("list namespaces failed: %v", err)
+	}
+	return namespaces, nil
+}
+
+// sync write the ConfigMap and Secret of config namespace into kubernetes namespace ns, the object without files
+// is deleted, desired records the objects written if not nil
+func (m *Materializer) sync(ns *v1.Namespace, configNs string, report bool, desired map[string]bool) error {
+	secretPatterns := splitList(ns.Annotations[AnnotationSecretFiles])
+	files := map[string]map[string]string{KindConfigMap: {}, KindSecret: {}}
+	for filename, digest := range m.cfg.FM.Copy()[configNs] {
+		kind := KindConfigMap
+		if matchAny(secretPatterns, configNs+"/"+filename) {
+			kind = KindSecret
+		}
+		files[kind][filename] = digest
+	}
+
+	name := objectName(configNs)
+	for _, kind := range []string{KindConfigMap, KindSecret} {
+		ins := &Instance{Kind: kind, Namespace: ns.Name, Name: name, ConfigNamespace: configNs, Files: files[kind]}
+		if len(ins.Files) == 0 {
+			if err := m.delete(ins); err != nil {
+				return err
+			}
+			continue
+		}
+		if desired != nil {
+			desired[objectKey(kind, ns.Name, name)] = true
+		}
+		if err := m.write(ins, report); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// write create or update the object of ins if its digest changed
+func (m *Materializer) write(ins *Instance, report bool) error {
+	ins.Digest = filesDigest(ins.Files)
+	data := map[string][]byte{}
+	size := 0
+	for filename := range ins.Files {
+		content, err := m.readFile(ins.ConfigNamespace, filename)
+		if err != nil {
+			return err
+		}
+		data[dataKey(filename)] = content
+		size += len(content)
+	}
+	if size > maxObjectSize {
+		return fmt.Errorf("size %d of files exceeds the limit of %s", size, ins.Kind)
+	}
+
+	meta := metav1.ObjectMeta{
+		Namespace: ins.Namespace,
+		Name:      ins.Name,
+		Labels: map[string]string{
+			LabelManagedBy:       ManagedByAgent,
+			LabelConfigNamespace: objectName(ins.ConfigNamespace),
+		},
+		Annotations: map[string]string{
+			AnnotationDigest:     ins.Digest,
+			LabelConfigNamespace: ins.ConfigNamespace,
+		},
+	}
+	var (
+		written bool
+		err     error
+	)
+	switch ins.Kind {
+	case KindConfigMap:
+		written, err = m.writeConfigMap(meta, data)
+	case KindSecret:
+		written, err = m.writeSecret(meta, data)
+	}
+	if err != nil {
+		return fmt.Errorf("write %s %s/%s failed: %v", ins.Kind, ins.Namespace, ins.Name, err)
+	}
+	if written {
+		alog.Infof("Materialized config namespace %s as %s %s/%s, digest: %s", ins.ConfigNamespace, ins.Kind, ins.Namespace, ins.Name, ins.Digest)
+	}
+	if (written || report) && m.cfg.Report != nil {
+		m.cfg.Report(ins)
+	}
+	return nil
+}
+
+func (m *Materializer) writeConfigMap(meta metav1.ObjectMeta, data map[string][]byte) (bool, error) {
+	cm := &v1.ConfigMap{ObjectMeta: meta, Data: map[string]string{}, BinaryData: map[string][]byte{}}
+	for k, v := range data {
+		if utf8.Valid(v) {
+			cm.Data[k] = string(v)
+		} else {
+			cm.BinaryData[k] = v
+		}
+	}
+	client := m.cfg.Client.CoreV1().ConfigMaps(meta.Namespace)
+	old, err := client.Get(context.TODO(), meta.Name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		_, err = client.Create(context.TODO(), cm, metav1.CreateOptions{})
+		return err == nil, err
+	}
+	if err != nil {
+		return false, err
+	}
+	if old.Labels[LabelManagedBy] != ManagedByAgent {
+		return false, fmt.Errorf("the existing one is not managed by %s", ManagedByAgent)
+	}
+	if old.Annotations[AnnotationDigest] == meta.Annotations[AnnotationDigest] {
+		return false, nil
+	}
+	cm.ResourceVersion = old.ResourceVersion
+	_, err = client.Update(context.TODO(), cm, metav1.UpdateOptions{})
+	return err == nil, err
+}
+
+func (m *Materializer) writeSecret(meta metav1.ObjectMeta, data map[string][]byte) (bool, error) {
+	secret := &v1.Secret{ObjectMeta: meta, Type: v1.SecretTypeOpaque, Data: data}
+	client := m.cfg.Client.CoreV1().Secrets(meta.Namespace)
+	old, err := client.Get(context.TODO(), meta.Name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		_, err = client.Create(context.TODO(), secret, metav1.CreateOptions{})
+		return err == nil, err
+	}
+	if err != nil {
+		return false, err
+	}
+	if old.Labels[LabelManagedBy] != ManagedByAgent {
+		return false, fmt.Errorf("the existing one is not managed by %s", ManagedByAgent)
+	}
+	if old.Annotations[AnnotationDigest] == meta.Annotations[AnnotationDigest] {
+		return false, nil
+	}
+	secret.ResourceVersion = old.ResourceVersion
+	_, err = client.Update(context.TODO(), secret, metav1.UpdateOptions{})
+	return err == nil, err
+}
+
+// delete delete the object of ins if it exists and is managed by agent
+func (m *Materializer) delete(ins *Instance) error {
+	var (
+		meta *metav1.ObjectMeta
+		err  error
+	)
+	switch ins.Kind {
+	case KindConfigMap:
+		var cm *v1.ConfigMap
+		if cm, err = m.cfg.Client.CoreV1().ConfigMaps(ins.Namespace).Get(context.TODO(), ins.Name, metav1.GetOptions{}); err == nil {
+			meta = &cm.ObjectMeta
+		}
+	case KindSecret:
+		var secret *v1.Secret
+		if secret, err = m.cfg.Client.CoreV1().Secrets(ins.Namespace).Get(context.TODO(), ins.Name, metav1.GetOptions{}); err == nil {
+			meta = &secret.ObjectMeta
+		}
+	}
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if meta.Labels[LabelManagedBy] != ManagedByAgent {
+		return nil
+	}
+	return m.deleteObject(ins)
+}
+
+// cleanup delete the objects managed by agent but not desired
+func (m *Materializer) cleanup(desired map[string]bool) error {
+	selector := labels.SelectorFromSet(labels.Set{LabelManagedBy: ManagedByAgent}).String()
+	var obsolete []*Instance
+
+	cms, err := m.cfg.Client.CoreV1().ConfigMaps(metav1.NamespaceAll).List(context.TODO(), metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return fmt.Errorf("list configmaps failed: %v", err)
+	}
+	for _, cm := range cms.Items {
+		if !desired[objectKey(KindConfigMap, cm.Namespace, cm.Name)] {
+			obsolete = append(obsolete, instanceOf(KindConfigMap, &cm.ObjectMeta))
+		}
+	}
+	secrets, err := m.cfg.Client.CoreV1().Secrets(metav1.NamespaceAll).List(context.TODO(), metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return fmt.Errorf("list secrets failed: %v", err)
+	}
+	for _, secret := range secrets.Items {
+		if !desired[objectKey(KindSecret, secret.Namespace, secret.Name)] {
+			obsolete = append(obsolete, instanceOf(KindSecret, &secret.ObjectMeta))
+		}
+	}
+
+	for _, ins := range obsolete {
+		if err := m.deleteObject(ins); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteObject delete the object of ins and cancel its report
+func (m *Materializer) deleteObject(ins *Instance) error {
+	var err error
+	switch ins.Kind {
+	case KindConfigMap:
+		err = m.cfg.Client.CoreV1().ConfigMaps(ins.Namespace).Delete(context.TODO(), ins.Name, metav1.DeleteOptions{})
+	case KindSecret:
+		err = m.cfg.Client.CoreV1().Secrets(ins.Namespace).Delete(context.TODO(), ins.Name, metav1.DeleteOptions{})
+	}
+	if err != nil && !errors.IsNotFound(err) {
+		return fmt.Errorf("delete %s %s/%s failed: %v", ins.Kind, ins.Namespace, ins.Name, err)
+	}
+	alog.Infof("Deleted materialized %s %s/%s", ins.Kind, ins.Namespace, ins.Name)
+	if m.cfg.Cancel != nil {
+		m.cfg.Cancel(ins)
+	}
+	return nil
+}
+
+// readFile read the content of config file from filedb
+func (m *Materializer) readFile(namespace, filename string) ([]byte, error) {
+	_, r, err := m.cfg.FDB.VisitConfig(utils.FdbSite, namespace, filename, utils.FdbVersion)
+	if err != nil {
+		return nil, fmt.Errorf("visit config %s/%s failed: %v", namespace, filename, err)
+	}
+	defer r.Close()
+	return ioutil.ReadAll(r)
+}
+
+func instanceOf(kind string, meta *metav1.ObjectMeta) *Instance {
+	return &Instance{
+		Kind:            kind,
+		Namespace:       meta.Namespace,
+		Name:            meta.Name,
+		ConfigNamespace: meta.Annotations[LabelConfigNamespace],
+		Digest:          meta.Annotations[AnnotationDigest],
+	}
+}
+
+func objectKey(kind, namespace, name string) string {
+	return kind + "/" + namespace + "/" + name
+}
+
+var (
+	invalidNameChars = regexp.MustCompile(`[^a-z0-9.-]+`)
+	invalidKeyChars  = regexp.MustCompile(`[^-._a-zA-Z0-9]+`)
+)
+
+// objectName build a valid name of ConfigMap and Secret by config namespace
+func objectName(configNs string) string {
+	name := "galaxy-" + strings.Trim(invalidNameChars.ReplaceAllString(strings.ToLower(configNs), "-"), "-.")
+	if len(name) > 63 {
+		name = strings.TrimRight(name[:63], "-.")
+	}
+	return name
+}
+
+// dataKey build a valid key of ConfigMap and Secret data by filename
+func dataKey(filename string) string {
+	return invalidKeyChars.ReplaceAllString(filename, "_")
+}
+
+// filesDigest build the digest of files by their names and digests
+func filesDigest(files map[string]string) string {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	h := sha256.New()
+	for _, name := range names {
+		fmt.Fprintf(h, "%s=%s\n", name, files[name])
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// splitList split comma separated value, empty items are dropped
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// matchAny check if name matched by any glob pattern
+func matchAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
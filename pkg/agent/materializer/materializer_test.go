@@ -0,0 +1,175 @@
+package materializer
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"code.xxxxx.cn/platform/galaxy/pkg/agent/updater"
+	"code.xxxxx.cn/platform/galaxy/pkg/agent/utils"
+	"code.xxxxx.cn/platform/galaxy/pkg/component/storage/filedb"
+)
+
+// recorder record the instances reported and canceled
+type recorder struct {
+	lock     sync.Mutex
+	reported []*Instance
+	canceled []*Instance
+}
+
+func (r *recorder) report(ins *Instance) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.reported = append(r.reported, ins)
+}
+
+func (r *recorder) cancel(ins *Instance) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.canceled = append(r.canceled, ins)
+}
+
+func (r *recorder) reset() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.reported, r.canceled = nil, nil
+}
+
+func TestMaterializer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "materializer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fdb, err := filedb.NewFileDB(&filedb.Config{Workdir: dir, CasDisable: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fm := updater.NewFileMapper(fdb)
+	store := func(namespace, filename, content string) {
+		digest, err := fdb.StoreConfig(utils.FdbSite, namespace, filename, utils.FdbVersion, nil, strings.NewReader(content))
+		if err != nil {
+			t.Fatal(err)
+		}
+		fm.Update(namespace, map[string]string{filename: digest})
+	}
+	store("app", "app.yaml", "port: 80")
+	store("app", "tls.key", "private")
+	store("other", "other.yaml", "other")
+
+	client := fake.NewSimpleClientset(
+		&v1.Namespace{ObjectMeta: metav1.ObjectMeta{
+			Name:   "web",
+			Labels: map[string]string{LabelMaterialize: "true"},
+			Annotations: map[string]string{
+				AnnotationConfigNamespaces: "app",
+				AnnotationSecretFiles:      "app/*.key",
+			},
+		}},
+		&v1.Namespace{ObjectMeta: metav1.ObjectMeta{
+			Name:        "not-opted-in",
+			Annotations: map[string]string{AnnotationConfigNamespaces: "*"},
+		}},
+	)
+	factory := informers.NewSharedInformerFactory(client, 0)
+	lister := factory.Core().V1().Namespaces().Lister()
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	factory.Start(stopCh)
+	factory.WaitForCacheSync(stopCh)
+
+	r := &recorder{}
+	m := New(Config{Client: client, NamespaceLister: lister, FDB: fdb, FM: fm, Report: r.report, Cancel: r.cancel})
+	if err := m.SyncAll(false); err != nil {
+		t.Fatal(err)
+	}
+
+	cm, err := client.CoreV1().ConfigMaps("web").Get(context.TODO(), "galaxy-app", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("expect configmap written: %v", err)
+	}
+	if cm.Data["app.yaml"] != "port: 80" || len(cm.Data) != 1 || cm.Labels[LabelManagedBy] != ManagedByAgent {
+		t.Errorf("unexpected configmap: %+v", cm)
+	}
+	secret, err := client.CoreV1().Secrets("web").Get(context.TODO(), "galaxy-app", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("expect secret written: %v", err)
+	}
+	if string(secret.Data["tls.key"]) != "private" || len(secret.Data) != 1 {
+		t.Errorf("unexpected secret: %+v", secret)
+	}
+	if len(r.reported) != 2 || r.reported[0].Files["app.yaml"] == "" || r.reported[0].Digest != cm.Annotations[AnnotationDigest] {
+		t.Errorf("expect configmap and secret reported, got %+v", r.reported)
+	}
+	if list, _ := client.CoreV1().ConfigMaps("not-opted-in").List(context.TODO(), metav1.ListOptions{}); len(list.Items) != 0 {
+		t.Errorf("expect nothing written into namespace not opted in")
+	}
+
+	// nothing written or reported if not changed, unless report forced
+	r.reset()
+	if err := m.SyncAll(false); err != nil || len(r.reported) != 0 {
+		t.Errorf("expect nothing reported, got %+v %v", r.reported, err)
+	}
+	if err := m.SyncAll(true); err != nil || len(r.reported) != 2 {
+		t.Errorf("expect all reported when forced, got %+v %v", r.reported, err)
+	}
+
+	// updated files are written and reported
+	r.reset()
+	store("app", "app.yaml", "port: 8080")
+	store("other", "other.yaml", "updated")
+	m.NamespaceUpdated("app", []string{"app.yaml"})
+	m.NamespaceUpdated("other", []string{"other.yaml"})
+	cm, _ = client.CoreV1().ConfigMaps("web").Get(context.TODO(), "galaxy-app", metav1.GetOptions{})
+	if cm.Data["app.yaml"] != "port: 8080" {
+		t.Errorf("expect configmap updated, got %+v", cm.Data)
+	}
+	if len(r.reported) != 1 || r.reported[0].Kind != KindConfigMap || r.reported[0].Digest != cm.Annotations[AnnotationDigest] {
+		t.Errorf("expect only configmap reported, got %+v", r.reported)
+	}
+
+	// the objects are deleted and canceled when namespace opted out
+	r.reset()
+	ns, _ := client.CoreV1().Namespaces().Get(context.TODO(), "web", metav1.GetOptions{})
+	ns.Labels = nil
+	if _, err := client.CoreV1().Namespaces().Update(context.TODO(), ns, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	for {
+		if ns, _ := lister.Get("web"); len(ns.Labels) == 0 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := m.SyncAll(false); err != nil {
+		t.Fatal(err)
+	}
+	if list, _ := client.CoreV1().ConfigMaps("web").List(context.TODO(), metav1.ListOptions{}); len(list.Items) != 0 {
+		t.Errorf("expect configmap deleted, got %+v", list.Items)
+	}
+	if len(r.canceled) != 2 || r.canceled[0].ConfigNamespace != "app" {
+		t.Errorf("expect configmap and secret canceled, got %+v", r.canceled)
+	}
+}
+
+func TestObjectName(t *testing.T) {
+	for configNs, name := range map[string]string{
+		"app":                   "galaxy-app",
+		"App_Config.yaml":       "galaxy-app-config.yaml",
+		"/team/app/":            "galaxy-team-app",
+		strings.Repeat("a", 80): "galaxy-" + strings.Repeat("a", 56),
+	} {
+		if got := objectName(configNs); got != name {
+			t.Errorf("expect name of %q is %q, got %q", configNs, name, got)
+		}
+	}
+}
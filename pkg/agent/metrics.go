@@ -0,0 +1,112 @@
+package agent
+
+import (
+	"net/http"
+
+	grpc_prometheus "github.com/grpc-ecosystem/go-grpc-prometheus"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"code.xxxxx.cn/platform/galaxy/pkg/util/alog"
+)
+
+const (
+	// GalaxySubsystem metric prefix name
+	GalaxySubsystem = "galaxy"
+)
+
+var (
+	// ConnectedApps metric of the number of app connections registered to agent
+	ConnectedApps = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Subsystem: GalaxySubsystem,
+			Name:      "agent_connected_apps",
+			Help:      "Number of app connections registered to agent",
+		},
+	)
+	// DownloadQueueDepth metric of the number of tasks in download queue of version manager
+	DownloadQueueDepth = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Subsystem: GalaxySubsystem,
+			Name:      "agent_download_queue_depth",
+			Help:      "Number of packages and files waiting to download",
+		},
+	)
+	// FailureQueueSize metric of the number of tasks in failure queue of version manager
+	FailureQueueSize = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Subsystem: GalaxySubsystem,
+			Name:      "agent_failure_queue_size",
+			Help:      "Number of packages and files failed to download waiting to retry",
+		},
+	)
+	// UpdateQueueDepth metric of the number of packages and files waiting to update
+	UpdateQueueDepth = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Subsystem: GalaxySubsystem,
+			Name:      "agent_update_queue_depth",
+			Help:      "Number of packages and files waiting to update",
+		},
+		[]string{"queue"},
+	)
+	// NotifyRetryQueueSize metric of the number of notify tasks waiting to retry
+	NotifyRetryQueueSize = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Subsystem: GalaxySubsystem,
+			Name:      "agent_notify_retry_queue_size",
+			Help:      "Number of notifies to apps waiting to retry",
+		},
+	)
+	// FileMapperFiles metric of the number of files recorded by file mapper of every namespace
+	FileMapperFiles = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Subsystem: GalaxySubsystem,
+			Name:      "agent_filemapper_files",
+			Help:      "Number of files recorded by file mapper of namespace",
+		},
+		[]string{"namespace"},
+	)
+)
+
+// Register all metrics
+func init() {
+	prometheus.MustRegister(ConnectedApps)
+	prometheus.MustRegister(DownloadQueueDepth)
+	prometheus.MustRegister(FailureQueueSize)
+	prometheus.MustRegister(UpdateQueueDepth)
+	prometheus.MustRegister(NotifyRetryQueueSize)
+	prometheus.MustRegister(FileMapperFiles)
+}
+
+// ServeMetrics start the metrics server on addr, serve /metrics with grpc and agent metrics
+func (ca *Agent) ServeMetrics(addr string) {
+	grpc_prometheus.Register(ca.grpcServer)
+
+	handler := promhttp.Handler()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, req *http.Request) {
+		ca.collectMetrics()
+		handler.ServeHTTP(w, req)
+	})
+	alog.Infof("Metric server is listening at: %s", addr)
+	alog.Fatal(http.ListenAndServe(addr, mux))
+}
+
+// collectMetrics update the agent metrics by the current status
+func (ca *Agent) collectMetrics() {
+	ConnectedApps.Set(float64(ca.syncer.AppsCount()))
+	NotifyRetryQueueSize.Set(float64(ca.syncer.NotifyQueueLen()))
+
+	downloads, failures := ca.vm.Queues()
+	DownloadQueueDepth.Set(float64(len(downloads)))
+	FailureQueueSize.Set(float64(len(failures)))
+
+	packages, files := ca.updateHub.QueueLen()
+	UpdateQueueDepth.WithLabelValues("package").Set(float64(packages))
+	UpdateQueueDepth.WithLabelValues("file").Set(float64(files))
+
+	FileMapperFiles.Reset()
+	for ns, n := range ca.fm.Count() {
+		FileMapperFiles.WithLabelValues(ns).Set(float64(n))
+	}
+}
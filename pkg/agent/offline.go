@@ -0,0 +1,172 @@
+package agent
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strconv"
+	"sync"
+	"time"
+
+	"code.xxxxx.cn/platform/galaxy/pkg/util/alog"
+)
+
+/* metadata added into FileContent.Extend to tell apps how fresh the content is */
+const (
+	// ExtendLastSyncedAt is the time local filedb last reconciled with manager in RFC3339, empty if never
+	ExtendLastSyncedAt = "_last_synced_at"
+	// ExtendPossiblyStale is "true" if agent is offline or not reconciled with manager since reconnected
+	ExtendPossiblyStale = "_possibly_stale"
+
+	// syncStateFile is the raw file to keep the last synced time across restarts
+	syncStateFile = "syncstate/lastsynced"
+	// reconcileRetryInterval is the interval to retry reconciliation failed while tunnel is ready
+	reconcileRetryInterval = 5 * time.Second
+)
+
+// syncState record the freshness of local filedb, and the files missed when offline
+type syncState struct {
+	lock       sync.Mutex
+	lastSynced time.Time
+	// reconciled is true if reconciled with manager since tunnel ready last time
+	reconciled bool
+	// missed is the files requested by apps but not in filedb, refreshed in next reconciliation
+	missed map[string]map[string]string
+}
+
+// status return the last synced time and if reconciled since tunnel ready
+func (s *syncState) status() (time.Time, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.lastSynced, s.reconciled
+}
+
+// setReconciled record the result of reconciliation
+func (s *syncState) setReconciled(reconciled bool, at time.Time) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.reconciled = reconciled
+	if reconciled {
+		s.lastSynced = at
+	}
+}
+
+// addMissed queue the file to refresh in next reconciliation
+func (s *syncState) addMissed(namespace, filename, digest string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.missed == nil {
+		s.missed = map[string]map[string]string{}
+	}
+	if _, ok := s.missed[namespace]; !ok {
+		s.missed[namespace] = map[string]string{}
+	}
+	s.missed[namespace][filename] = digest
+}
+
+// takeMissed return the files missed and clear them
+func (s *syncState) takeMissed() map[string]map[string]string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	missed := s.missed
+	s.missed = nil
+	return missed
+}
+
+// loadSyncState load the last synced time kept in filedb
+func (ca *Agent) loadSyncState() {
+	_, r, err := ca.fdb.VisitRawFile(syncStateFile)
+	if err != nil {
+		alog.Infof("No last synced time of local data: %v", err)
+		return
+	}
+	defer r.Close()
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		alog.Warningf("Read last synced time failed: %v", err)
+		return
+	}
+	at, err := time.Parse(time.RFC3339, string(data))
+	if err != nil {
+		alog.Warningf("Parse last synced time %q failed: %v", data, err)
+		return
+	}
+	ca.syncState.lock.Lock()
+	ca.syncState.lastSynced = at
+	ca.syncState.lock.Unlock()
+	alog.Infof("Local data last synced at %s", data)
+}
+
+// stalenessExtend copy extend of file and add the freshness metadata
+func (ca *Agent) stalenessExtend(extend map[string]string) map[string]string {
+	lastSynced, reconciled := ca.syncState.status()
+	_, ready, _ := ca.tunnel.get()
+
+	e := make(map[string]string, len(extend)+2)
+	for k, v := range extend {
+		e[k] = v
+	}
+	e[ExtendLastSyncedAt] = ""
+	if !lastSynced.IsZero() {
+		e[ExtendLastSyncedAt] = lastSynced.Format(time.RFC3339)
+	}
+	e[ExtendPossiblyStale] = strconv.FormatBool(!ready || !reconciled)
+	return e
+}
+
+// requestReconcile queue a reconciliation with manager without blocking, it runs once tunnel is ready
+func (ca *Agent) requestReconcile() {
+	select {
+	case ca.reconcileCh <- struct{}{}:
+	default:
+	}
+}
+
+// runReconcile reconcile local data with manager when requested, and retry until succeeded or tunnel down
+func (ca *Agent) runReconcile() {
+	for {
+		select {
+		case <-ca.stopEverything:
+			return
+		case <-ca.reconcileCh:
+		}
+		for !ca.reconcile() {
+			select {
+			case <-ca.stopEverything:
+				return
+			case <-time.After(reconcileRetryInterval):
+			}
+		}
+	}
+}
+
+// reconcile sync local data and the files missed with manager, return false if failed and should retry,
+// it is skipped when tunnel is down as it is requested again once tunnel ready
+func (ca *Agent) reconcile() bool {
+	if _, ready, _ := ca.tunnel.get(); !ready {
+		alog.Infof("Tunnel is down, serve local data until reconciled with manager")
+		return true
+	}
+	if err := ca.syncLocalData(); err != nil {
+		alog.Errorf("Reconcile local data failed, retry after %s: %v", reconcileRetryInterval, err)
+		return false
+	}
+	if missed := ca.syncState.takeMissed(); len(missed) != 0 {
+		if err := ca.refreshAgentFDBFromRemote(missed, false); err != nil {
+			for ns, files := range missed {
+				for filename, digest := range files {
+					ca.syncState.addMissed(ns, filename, digest)
+				}
+			}
+			alog.Errorf("Refresh missed files failed, retry after %s: %v", reconcileRetryInterval, err)
+			return false
+		}
+	}
+
+	now := time.Now()
+	ca.syncState.setReconciled(true, now)
+	if _, err := ca.fdb.StoreRawFile(syncStateFile, nil, bytes.NewReader([]byte(now.Format(time.RFC3339)))); err != nil {
+		alog.Warningf("Keep last synced time failed: %v", err)
+	}
+	alog.Infof("Reconciled local data with manager")
+	return true
+}
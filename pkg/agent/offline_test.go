@@ -0,0 +1,111 @@
+package agent
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"code.xxxxx.cn/platform/galaxy/pkg/agent/config"
+	"code.xxxxx.cn/platform/galaxy/pkg/agent/syncer"
+	"code.xxxxx.cn/platform/galaxy/pkg/agent/updater"
+	"code.xxxxx.cn/platform/galaxy/pkg/agent/utils"
+	"code.xxxxx.cn/platform/galaxy/pkg/component/cmd"
+	"code.xxxxx.cn/platform/galaxy/pkg/component/cmd/cmdtest"
+	"code.xxxxx.cn/platform/galaxy/pkg/component/storage/filedb"
+)
+
+func TestOfflineServing(t *testing.T) {
+	h := cmdtest.New(t)
+	defer h.Close()
+
+	dir, err := ioutil.TempDir("", "offline")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fdb, err := filedb.NewFileDB(&filedb.Config{Workdir: dir, CasDisable: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fdb.StoreConfig(utils.FdbSite, "ns", "cached.yaml", utils.FdbVersion, nil, strings.NewReader("cached")); err != nil {
+		t.Fatal(err)
+	}
+	ca := &Agent{
+		config:      &config.AgentConfiguration{ID: "site"},
+		cmdClient:   h.Client,
+		fdb:         fdb,
+		fm:          updater.NewFileMapper(fdb),
+		syncer:      syncer.NewSyncer(syncer.Config{}),
+		reconcileCh: make(chan struct{}, 1),
+	}
+	ca.tunnel.set(false)
+	ca.syncer.RegisterApp(&syncer.AppDescribe{AppID: "app", Files: map[string]struct{}{}}, "conn")
+
+	// manager records the files refreshed
+	var lock sync.Mutex
+	refreshed := map[cmd.Name][]string{}
+	refresh := func(req *cmd.Req) (*cmd.Resp, cmd.OnComplete) {
+		p, err := cmd.GetFileRefreshPayload(req)
+		if err != nil {
+			return cmd.RespError(err), nil
+		}
+		lock.Lock()
+		defer lock.Unlock()
+		for ns, files := range cmd.FileDigestsMap(p.Files) {
+			for name := range files {
+				refreshed[req.Name] = append(refreshed[req.Name], ns+"/"+name)
+			}
+		}
+		return cmd.RespSucceed("{}"), nil
+	}
+	h.Server.AddCmdHandler(cmd.FileSyncHandler, refresh)
+	h.Server.AddCmdHandler(cmd.CmdFileRefreshHandler, refresh)
+
+	content := func(filename string) (*cmd.Resp, *FileContent) {
+		resp, _ := ca.CmdContentHandler(&cmd.Req{Name: cmd.CmdContentHandler, Caller: "conn", Args: cmd.Args{"namespace": "ns", "filename": filename}})
+		if resp.Code != cmd.SuccessCode {
+			return resp, nil
+		}
+		fc := &FileContent{}
+		if err := json.Unmarshal([]byte(resp.Data), fc); err != nil {
+			t.Fatal(err)
+		}
+		return resp, fc
+	}
+
+	// cached content is served when offline and marked possibly stale
+	resp, fc := content("cached.yaml")
+	if fc == nil || fc.Content != "cached" || fc.Extend[ExtendPossiblyStale] != "true" || fc.Extend[ExtendLastSyncedAt] != "" {
+		t.Fatalf("expect stale cached content served, got %+v %+v", resp, fc)
+	}
+	// uncached content is queued to refresh without blocking
+	if resp, _ := content("missed.yaml"); resp.Code != 204 {
+		t.Errorf("expect no content of uncached file, got %+v", resp)
+	}
+	if !ca.reconcile() || len(refreshed) != 0 {
+		t.Errorf("expect reconciliation skipped when offline, got %v", refreshed)
+	}
+
+	// reconciled once tunnel ready
+	ca.tunnel.set(true)
+	if !ca.reconcile() {
+		t.Fatalf("expect reconciled")
+	}
+	if len(refreshed[cmd.FileSyncHandler]) != 0 || strings.Join(refreshed[cmd.CmdFileRefreshHandler], ",") != "ns/missed.yaml" {
+		t.Errorf("expect missed file refreshed, got %v", refreshed)
+	}
+	_, fc = content("cached.yaml")
+	if fc == nil || fc.Extend[ExtendPossiblyStale] != "false" || fc.Extend[ExtendLastSyncedAt] == "" {
+		t.Errorf("expect fresh content after reconciled, got %+v", fc)
+	}
+
+	// the last synced time is kept across restarts
+	restarted := &Agent{fdb: fdb}
+	restarted.loadSyncState()
+	if lastSynced, reconciled := restarted.syncState.status(); lastSynced.Format("2006-01-02T15:04:05Z07:00") != fc.Extend[ExtendLastSyncedAt] || reconciled {
+		t.Errorf("expect last synced time loaded and not reconciled, got %s %v", lastSynced, reconciled)
+	}
+}
@@ -0,0 +1,96 @@
+package agent
+
+import (
+	"context"
+
+	"code.xxxxx.cn/platform/galaxy/pkg/util/alog"
+)
+
+// startWorkers start the workers serve apps with local data
+func (ca *Agent) startWorkers() {
+	ca.goWorker(ca.updateHub.Start)
+	ca.goWorker(ca.fm.Run)
+	ca.goWorker(ca.syncer.Run)
+}
+
+// goWorker run worker until stopEverything closed, it is not started if agent is shutting down
+func (ca *Agent) goWorker(worker func(stopCh <-chan struct{})) {
+	ca.workersLock.Lock()
+	defer ca.workersLock.Unlock()
+	select {
+	case <-ca.stopEverything:
+		return
+	default:
+	}
+	ca.workers.Add(1)
+	go func() {
+		defer ca.workers.Done()
+		worker(ca.stopEverything)
+	}()
+}
+
+// shutdown stop agent in order after stopEverything closed, so the pending updates survive restarts:
+//  1. stop accepting new connections and rpcs of apps
+//  2. wait for workers to finish the downloads, updates and notifies in progress
+//  3. dump the tasks queued and file mapper to WorkDir, they are loaded on next start
+//  4. drain cmds of apps and disconnect them
+//  5. drain cmds of manager and close the tunnel and connection
+func (ca *Agent) shutdown() {
+	alog.Infof("Shutting down agent in %s", ca.config.ShutdownTimeout)
+	ctx, cancel := context.WithTimeout(context.Background(), ca.config.ShutdownTimeout)
+	defer cancel()
+
+	grpcStopped := make(chan struct{})
+	go func() {
+		ca.grpcServer.GracefulStop()
+		close(grpcStopped)
+	}()
+
+	// no worker is started after stopEverything closed
+	ca.workersLock.Lock()
+	ca.workersLock.Unlock()
+	workersStopped := make(chan struct{})
+	go func() {
+		ca.workers.Wait()
+		close(workersStopped)
+	}()
+	select {
+	case <-workersStopped:
+		alog.Infof("Workers stopped")
+	case <-ctx.Done():
+		alog.Warningf("Workers not stopped in %s, dump the tasks queued", ca.config.ShutdownTimeout)
+	}
+	ca.dumpQueues()
+
+	if err := ca.cmdServer.Close(ctx); err != nil {
+		alog.Warningf("Drain cmds of apps failed: %v", err)
+	}
+	select {
+	case <-grpcStopped:
+	case <-ctx.Done():
+		ca.grpcServer.Stop()
+	}
+
+	if err := ca.cmdClient.Close(ctx); err != nil {
+		alog.Warningf("Drain cmds of manager failed: %v", err)
+	}
+	// manager unregisters agent once the connection closed
+	if err := ca.conn.CloseConn(); err != nil {
+		alog.Warningf("Close connection of manager failed: %v", err)
+	}
+	close(ca.tunnelStop)
+}
+
+// dumpQueues persist the download, update and notify tasks queued and file mapper
+func (ca *Agent) dumpQueues() {
+	if err := ca.vm.Dump(); err != nil {
+		alog.Errorf("Dump download tasks failed: %v", err)
+	}
+	if err := ca.updateHub.Dump(); err != nil {
+		alog.Errorf("Dump updates failed: %v", err)
+	}
+	if err := ca.syncer.Dump(); err != nil {
+		alog.Errorf("Dump notify tasks failed: %v", err)
+	}
+	ca.fm.Dump()
+}
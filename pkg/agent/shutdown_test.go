@@ -0,0 +1,84 @@
+package agent
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"code.xxxxx.cn/platform/galaxy/pkg/agent/syncer"
+	"code.xxxxx.cn/platform/galaxy/pkg/agent/updater"
+	"code.xxxxx.cn/platform/galaxy/pkg/agent/vm"
+	"code.xxxxx.cn/platform/galaxy/pkg/component/cmd/cmdtest"
+	"code.xxxxx.cn/platform/galaxy/pkg/component/storage/filedb"
+)
+
+func TestDumpQueues(t *testing.T) {
+	h := cmdtest.New(t)
+	defer h.Close()
+
+	dir, err := ioutil.TempDir("", "shutdown")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fdb, err := filedb.NewFileDB(&filedb.Config{Workdir: dir, CasDisable: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	build := func() *Agent {
+		fm := updater.NewFileMapper(fdb)
+		s := syncer.NewSyncer(syncer.Config{CmdServer: h.Server, FDB: fdb})
+		return &Agent{
+			fdb:       fdb,
+			fm:        fm,
+			syncer:    s,
+			updateHub: updater.NewUpdateHub(updater.Config{FDB: fdb, FM: fm, Syncer: s}),
+			vm:        vm.NewVersionManager(vm.Config{ProviderAddress: "http://127.0.0.1:1", Fdb: fdb}),
+		}
+	}
+
+	// tasks pending when shutting down
+	ca := build()
+	ca.fm.Set("ns", "a.yaml", "digest-a")
+	if err := ca.updateHub.PackageUpdated("ns", "digest-p"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ca.updateHub.FileUpdated("ns", "a.yaml", "digest-a"); err != nil {
+		t.Fatal(err)
+	}
+	ca.vm.AddDownloadFileTask("ns", "b.yaml", "1")
+	// notify to the app disconnected fails and is queued to retry
+	ca.syncer.RegisterApp(&syncer.AppDescribe{AppID: "app", Hostname: "pod-1", Files: map[string]struct{}{"ns/a.yaml": {}}}, "conn-1")
+	if err := ca.syncer.Renotify("conn-1", ""); err == nil {
+		t.Fatalf("expect notify to disconnected app failed")
+	}
+	ca.dumpQueues()
+
+	// tasks are loaded on next start
+	restarted := build()
+	if packages, files := restarted.updateHub.QueueLen(); packages != 1 || files != 1 {
+		t.Errorf("expect updates loaded, got %d packages and %d files", packages, files)
+	}
+	if downloads, _ := restarted.vm.Queues(); len(downloads) != 1 || downloads[0].Args[1] != "b.yaml" {
+		t.Errorf("expect download tasks loaded, got %v", downloads)
+	}
+	if digest := restarted.fm.Get("ns", "a.yaml"); digest != "digest-a" {
+		t.Errorf("expect file mapper loaded, got %q", digest)
+	}
+	// notify is retried to the new conn of the same app instance
+	restarted.syncer.RegisterApp(&syncer.AppDescribe{AppID: "app", Hostname: "pod-2", Files: map[string]struct{}{}}, "conn-2")
+	restarted.syncer.RegisterApp(&syncer.AppDescribe{AppID: "app", Hostname: "pod-1", Files: map[string]struct{}{}}, "conn-3")
+	if tasks := restarted.syncer.NotifyTasks(); len(tasks) != 1 || tasks[0].Conn != "conn-3" || tasks[0].Files[0] != "a.yaml" {
+		t.Errorf("expect notify task requeued to conn-3, got %+v", tasks)
+	}
+
+	// the dumps are loaded only once
+	again := build()
+	if packages, files := again.updateHub.QueueLen(); packages != 0 || files != 0 {
+		t.Errorf("expect updates loaded once, got %d packages and %d files", packages, files)
+	}
+	if downloads, _ := again.vm.Queues(); len(downloads) != 0 {
+		t.Errorf("expect download tasks loaded once, got %v", downloads)
+	}
+}
@@ -0,0 +1,26 @@
+package syncer
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// GalaxySubsystem metric prefix name
+	GalaxySubsystem = "galaxy"
+)
+
+var (
+	// NotifyRetries metric of the number of failed notify tasks scheduled to retry
+	NotifyRetries = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Subsystem: GalaxySubsystem,
+			Name:      "agent_notify_retries_total",
+			Help:      "Number of failed notifies to apps scheduled to retry",
+		},
+	)
+)
+
+// Register all metrics
+func init() {
+	prometheus.MustRegister(NotifyRetries)
+}
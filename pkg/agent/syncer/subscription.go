@@ -0,0 +1,82 @@
+package syncer
+
+import (
+	"path"
+	"sort"
+	"strings"
+)
+
+// ParseSubscriptions parse the comma separated files of app registration info, files are ns/name
+// or globs of them such as ns/*.yaml, and ns/* subscribes all files of ns, globs are matched by path.Match
+func ParseSubscriptions(files string) (exact map[string]struct{}, patterns []string) {
+	exact = map[string]struct{}{}
+	for _, file := range strings.Split(files, ",") {
+		file = strings.TrimSpace(file)
+		switch {
+		case file == "":
+		case isGlob(file):
+			patterns = append(patterns, file)
+		default:
+			exact[file] = struct{}{}
+		}
+	}
+	return exact, patterns
+}
+
+// isGlob check if name has any meta chars of path.Match
+func isGlob(name string) bool {
+	return strings.ContainsAny(name, "*?[\\")
+}
+
+// matched check if name is the subscription or matched by it as glob, ns/* matches all files of ns
+// even in sub directories
+func matched(subscription, name string) bool {
+	if subscription == name {
+		return true
+	}
+	if !isGlob(subscription) {
+		return false
+	}
+	if ns := strings.TrimSuffix(subscription, "/*"); ns != subscription {
+		if idx := strings.Index(name, "/"); idx > 0 {
+			ok, _ := path.Match(ns, name[:idx])
+			return ok
+		}
+	}
+	ok, _ := path.Match(subscription, name)
+	return ok
+}
+
+// subscribers return the files updated of namespace subscribed by every app, by file names or globs of files
+func (s *Syncer) subscribers(namespace string, files []string) map[string][]string {
+	app2Files := map[string]map[string]struct{}{}
+	add := func(apps map[string]struct{}, file string) {
+		for app := range apps {
+			if _, ok := app2Files[app]; !ok {
+				app2Files[app] = map[string]struct{}{}
+			}
+			app2Files[app][file] = struct{}{}
+		}
+	}
+
+	s.fileLock.RLock()
+	for _, file := range files {
+		name := namespace + "/" + file
+		add(s.regFileToApp[name], file)
+		for pattern, apps := range s.regPatternToApp {
+			if matched(pattern, name) {
+				add(apps, file)
+			}
+		}
+	}
+	s.fileLock.RUnlock()
+
+	res := make(map[string][]string, len(app2Files))
+	for app, set := range app2Files {
+		for file := range set {
+			res[app] = append(res[app], file)
+		}
+		sort.Strings(res[app])
+	}
+	return res
+}
@@ -0,0 +1,40 @@
+package syncer
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSubscribers(t *testing.T) {
+	files, patterns := ParseSubscriptions(" ns/a.yaml,,ns/*.json ,team-*/*")
+	if _, ok := files["ns/a.yaml"]; !ok || len(files) != 1 {
+		t.Errorf("expect exact file parsed, got %v", files)
+	}
+	if !reflect.DeepEqual(patterns, []string{"ns/*.json", "team-*/*"}) {
+		t.Errorf("expect globs parsed, got %v", patterns)
+	}
+
+	s := NewSyncer(Config{})
+	s.RegisterApp(&AppDescribe{AppID: "exact", Files: map[string]struct{}{"ns/a.yaml": {}}}, "conn-1")
+	s.RegisterApp(&AppDescribe{AppID: "glob", Files: map[string]struct{}{"ns/a.yaml": {}}, Patterns: []string{"ns/*.json"}}, "conn-2")
+	s.RegisterApp(&AppDescribe{AppID: "ns", Files: map[string]struct{}{}, Patterns: []string{"ns/*"}}, "conn-3")
+	s.RegisterApp(&AppDescribe{AppID: "team", Files: map[string]struct{}{}, Patterns: []string{"team-*/*"}}, "conn-4")
+	// namespaces are declarative only, never subscribe the files of them
+	s.RegisterApp(&AppDescribe{AppID: "declared", Files: map[string]struct{}{}, Namespaces: []string{"ns", "team-a"}}, "conn-5")
+
+	expect := map[string][]string{
+		"exact": {"a.yaml"},
+		"glob":  {"a.yaml", "b.json"},
+		"ns":    {"a.yaml", "b.json", "c.txt", "dir/d.yaml"},
+	}
+	if got := s.subscribers("ns", []string{"c.txt", "b.json", "a.yaml", "dir/d.yaml"}); !reflect.DeepEqual(got, expect) {
+		t.Errorf("expect subscribers %v, got %v", expect, got)
+	}
+	expect = map[string][]string{"team": {"x.yaml"}}
+	if got := s.subscribers("team-a", []string{"x.yaml"}); !reflect.DeepEqual(got, expect) {
+		t.Errorf("expect subscribers %v, got %v", expect, got)
+	}
+	if got := s.subscribers("none", []string{"x.yaml"}); len(got) != 0 {
+		t.Errorf("expect no subscribers, got %v", got)
+	}
+}
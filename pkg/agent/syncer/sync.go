@@ -1,15 +1,19 @@
 package syncer
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
-	"path/filepath"
+	"io/ioutil"
+	"strings"
 	"sync"
 	"time"
 
 	"code.xxxxx.cn/platform/galaxy/pkg/apis"
 	"code.xxxxx.cn/platform/galaxy/pkg/component/cmd"
+	"code.xxxxx.cn/platform/galaxy/pkg/component/storage/filedb"
 	"code.xxxxx.cn/platform/galaxy/pkg/util/alog"
+	"code.xxxxx.cn/platform/galaxy/pkg/util/uuid"
 )
 
 /*
@@ -27,28 +31,50 @@ const (
 	DefaultNotifyTimeout   = 10
 
 	SDKFileCMD = "fileupdated"
+	// NotifyDataPath is the raw file to persist the failed notify tasks across restarts
+	NotifyDataPath = "vmqueue_v1/notify.json"
 )
 
 // Config .
 type Config struct {
 	CmdServer cmd.Server
 	WorkerNum int
+	// FDB persist the notify tasks if set
+	FDB *filedb.FileDB
 }
 
 // AppDescribe describe app
 type AppDescribe struct {
-	AppID      string              `json:"appID"`
-	PodIP      string              `json:"podIP"`
-	Hostname   string              `json:"hostname"`
-	Namespaces []string            `json:"namespaces"`
-	Files      map[string]struct{} `json:"files"`
-	conn       string              `json:"conns"`
+	AppID    string `json:"appID"`
+	PodIP    string `json:"podIP"`
+	Hostname string `json:"hostname"`
+	// Namespaces declared by app, the files of them are not subscribed
+	Namespaces []string `json:"namespaces"`
+	// Files subscribed by ns/name, and Patterns by globs of them, eg. ns/*.yaml, or ns/* for all files of ns
+	Files    map[string]struct{} `json:"files"`
+	Patterns []string            `json:"patterns"`
+	conn     string              `json:"conns"`
 }
 
 type notifyTask struct {
 	conn      string
 	namespace string
 	files     []string
+	// uuid is kept in every retry, so the app never handles a notify twice
+	uuid string
+}
+
+// NotifyTask is a failed notify task waiting to retry
+type NotifyTask struct {
+	Conn string `json:"conn"`
+	UUID string `json:"uuid"`
+	// App and Hostname identify the app instance of conn, as the conn changes after reconnected
+	App              string    `json:"app"`
+	Hostname         string    `json:"hostname"`
+	Namespace        string    `json:"namespace"`
+	Files            []string  `json:"files"`
+	NextScheduleTime time.Time `json:"nextScheduleTime"`
+	FailedCount      int       `json:"failedCount"`
 }
 
 type scheduleNotifyTask struct {
@@ -61,16 +87,20 @@ type scheduleNotifyTask struct {
 type Syncer struct {
 	regNSToApp   map[string]map[string]struct{}
 	regFileToApp map[string]map[string]struct{}
-	nsLock       sync.RWMutex
-	fileLock     sync.RWMutex
+	// regPatternToApp is the globs of files subscribed, protected by fileLock
+	regPatternToApp map[string]map[string]struct{}
+	nsLock          sync.RWMutex
+	fileLock        sync.RWMutex
 
 	apps     map[string][]string
 	conn2App map[string]*AppDescribe
 	appsLock sync.RWMutex
 
 	notifyQueue []*scheduleNotifyTask
-	queueLock   sync.Mutex
-	cfg         Config
+	// pending is the notify tasks loaded waiting for the app instances registered, key is app/hostname
+	pending   map[string][]NotifyTask
+	queueLock sync.Mutex
+	cfg       Config
 }
 
 // NewSyncer return syncer
@@ -82,37 +112,57 @@ func NewSyncer(cfg Config) *Syncer {
 	s := Syncer{
 		cfg: cfg,
 
-		regFileToApp: map[string]map[string]struct{}{},
-		regNSToApp:   map[string]map[string]struct{}{},
+		regFileToApp:    map[string]map[string]struct{}{},
+		regPatternToApp: map[string]map[string]struct{}{},
+		regNSToApp:      map[string]map[string]struct{}{},
 
 		apps:     map[string][]string{},
 		conn2App: map[string]*AppDescribe{},
 
 		notifyQueue: []*scheduleNotifyTask{},
 	}
+	s.load()
 
 	return &s
 }
 
-// Run start worker
-func (s *Syncer) Run() {
+// Run start workers to retry failed notify tasks until stopCh closed, it returns after the notifies
+// in progress finished
+func (s *Syncer) Run(stopCh <-chan struct{}) {
+	sleep := func() bool {
+		select {
+		case <-stopCh:
+			return false
+		case <-time.After(time.Second):
+			return true
+		}
+	}
 	workerFunc := func() {
 		for {
+			select {
+			case <-stopCh:
+				return
+			default:
+			}
 			st := s.popNotifyConnFileUpdateTask()
 			if st == nil {
-				time.Sleep(time.Second)
+				if !sleep() {
+					return
+				}
 				continue
 			}
 
 			if st.nextScheduleTime > time.Now().Unix() {
 				s.addNotifyConnFileUpdateTask(st)
-				time.Sleep(time.Second)
+				if !sleep() {
+					return
+				}
 				continue
 			}
 
 			err := s.doNotify(*st.task)
 			if err == nil {
-				alog.Info("Notify task succeed: %v", st.task.conn)
+				alog.Infof("Notify task succeed: %v", st.task.conn)
 				continue
 			}
 
@@ -123,6 +173,7 @@ func (s *Syncer) Run() {
 				continue
 			}
 
+			NotifyRetries.Inc()
 			deltaTime := DefualtDelayTime * st.failedCount
 			if deltaTime > MAXDeltaTime {
 				deltaTime = MAXDeltaTime
@@ -133,9 +184,15 @@ func (s *Syncer) Run() {
 
 	}
 
+	var wg sync.WaitGroup
+	wg.Add(s.cfg.WorkerNum)
 	for i := 0; i < s.cfg.WorkerNum; i++ {
-		go workerFunc()
+		go func() {
+			defer wg.Done()
+			workerFunc()
+		}()
 	}
+	wg.Wait()
 }
 
 // CancelApp cancel apps
@@ -181,10 +238,19 @@ func (s *Syncer) RegisterApp(app *AppDescribe, conn string) {
 		}
 		s.regFileToApp[file][app.AppID] = struct{}{}
 	}
+	for _, pattern := range app.Patterns {
+		if _, ok := s.regPatternToApp[pattern]; !ok {
+			s.regPatternToApp[pattern] = map[string]struct{}{}
+		}
+		s.regPatternToApp[pattern][app.AppID] = struct{}{}
+	}
 	s.fileLock.Unlock()
 
 	s.nsLock.Lock()
 	for _, ns := range app.Namespaces {
+		if ns == "" {
+			continue
+		}
 		if _, ok := s.regNSToApp[ns]; !ok {
 			s.regNSToApp[ns] = map[string]struct{}{}
 		}
@@ -193,6 +259,15 @@ func (s *Syncer) RegisterApp(app *AppDescribe, conn string) {
 	}
 	s.nsLock.Unlock()
 
+	// retry the notifies failed before restarted to the new conn of app instance
+	s.queueLock.Lock()
+	key := app.AppID + "/" + app.Hostname
+	for _, t := range s.pending[key] {
+		alog.Infof("Requeue notify task of %s to %s: %s %v", key, conn, t.Namespace, t.Files)
+		s.notifyQueue = append(s.notifyQueue, &scheduleNotifyTask{&notifyTask{conn, t.Namespace, t.Files, t.UUID}, 0, t.FailedCount})
+	}
+	delete(s.pending, key)
+	s.queueLock.Unlock()
 }
 
 // RegisterFileToApp .
@@ -209,35 +284,20 @@ func (s *Syncer) RegisterFileToApp(conn, namespace, filename string) {
 	app.Files[fullname] = struct{}{}
 }
 
-// NotifyUpdate notify update
+// NotifyUpdate notify apps the files updated they subscribed, the apps subscribed to ns/* are
+// notified all files updated
 func (s *Syncer) NotifyUpdate(namespace string, files []string) {
-	app2Files := map[string][]string{}
-
-	s.fileLock.RLock()
-	for _, file := range files {
-		name := filepath.Join(namespace, file)
-
-		apps, ok := s.regFileToApp[name]
-
-		if !ok {
-			alog.Warningf("File %v no app need", name)
-			continue
-		}
-
-		for app := range apps {
-			if _, ok := app2Files[app]; !ok {
-				app2Files[app] = []string{}
-			}
-			app2Files[app] = append(app2Files[app], file)
-		}
+	app2Files := s.subscribers(namespace, files)
+	if len(app2Files) == 0 && len(files) != 0 {
+		alog.Warningf("Files %v of %v no app need", files, namespace)
 	}
-	s.fileLock.RUnlock()
 
 	for app, files := range app2Files {
 		for _, con := range s.apps[app] {
-			task := notifyTask{con, namespace, files}
+			task := notifyTask{con, namespace, files, uuid.NewUUID()}
 			if err := s.doNotify(task); err != nil {
 				alog.Errorf("Notify Failed, task:%v go into failed loop: %v", con, err)
+				NotifyRetries.Inc()
 				s.addNotifyConnFileUpdateTask(&scheduleNotifyTask{&task, 0, 1})
 			}
 			alog.Infof("notify %v update ns %v", con, namespace)
@@ -263,6 +323,159 @@ func (s *Syncer) GetAllAppsCopy() []*AppDescribe {
 	return res
 }
 
+// AppsCount return the number of app connections registered
+func (s *Syncer) AppsCount() int {
+	s.appsLock.RLock()
+	defer s.appsLock.RUnlock()
+	return len(s.conn2App)
+}
+
+// NotifyQueueLen return the number of failed notify tasks waiting to retry
+func (s *Syncer) NotifyQueueLen() int {
+	s.queueLock.Lock()
+	defer s.queueLock.Unlock()
+	return len(s.notifyQueue)
+}
+
+// NotifyTasks return the failed notify tasks waiting to retry
+func (s *Syncer) NotifyTasks() []NotifyTask {
+	s.queueLock.Lock()
+	tasks := make([]NotifyTask, 0, len(s.notifyQueue))
+	for _, st := range s.notifyQueue {
+		tasks = append(tasks, NotifyTask{
+			Conn:             st.task.conn,
+			UUID:             st.task.uuid,
+			Namespace:        st.task.namespace,
+			Files:            append([]string{}, st.task.files...),
+			NextScheduleTime: time.Unix(st.nextScheduleTime, 0),
+			FailedCount:      st.failedCount,
+		})
+	}
+	s.queueLock.Unlock()
+
+	for i := range tasks {
+		if app := s.GetAppByConn(tasks[i].Conn); app != nil {
+			tasks[i].App, tasks[i].Hostname = app.AppID, app.Hostname
+		}
+	}
+	return tasks
+}
+
+// Dump persist the failed notify tasks, they are retried after the app instances registered again
+// when syncer built next time
+func (s *Syncer) Dump() error {
+	if s.cfg.FDB == nil {
+		return nil
+	}
+	tasks := s.NotifyTasks()
+	data, err := json.Marshal(tasks)
+	if err != nil {
+		return err
+	}
+	if _, err := s.cfg.FDB.StoreRawFile(NotifyDataPath, nil, bytes.NewReader(data)); err != nil {
+		return err
+	}
+	alog.Infof("Dumped %d notify tasks", len(tasks))
+	return nil
+}
+
+// load the notify tasks dumped as pending, the dump is cleared as they may be done before next dump
+func (s *Syncer) load() {
+	if s.cfg.FDB == nil {
+		return
+	}
+	_, r, err := s.cfg.FDB.VisitRawFile(NotifyDataPath)
+	if err != nil {
+		alog.Infof("No notify tasks dumped: %v", err)
+		return
+	}
+	data, err := ioutil.ReadAll(r)
+	r.Close()
+	if err != nil {
+		alog.Warningf("Read notify tasks dumped failed: %v", err)
+		return
+	}
+	tasks := []NotifyTask{}
+	if err := json.Unmarshal(data, &tasks); err != nil {
+		alog.Warningf("Unmarshal notify tasks dumped failed: %v", err)
+		return
+	}
+
+	s.pending = map[string][]NotifyTask{}
+	for _, t := range tasks {
+		if t.App == "" {
+			continue
+		}
+		key := t.App + "/" + t.Hostname
+		s.pending[key] = append(s.pending[key], t)
+	}
+	if _, err := s.cfg.FDB.StoreRawFile(NotifyDataPath, nil, bytes.NewReader([]byte("[]"))); err != nil {
+		alog.Warningf("Clear notify tasks dumped failed: %v", err)
+	}
+	alog.Infof("Loaded %d notify tasks dumped", len(tasks))
+}
+
+// Subscriptions return the apps subscribed to every file and every namespace
+func (s *Syncer) Subscriptions() (files, namespaces map[string][]string) {
+	s.fileLock.RLock()
+	files = make(map[string][]string, len(s.regFileToApp))
+	for file, apps := range s.regFileToApp {
+		for app := range apps {
+			files[file] = append(files[file], app)
+		}
+	}
+	for pattern, apps := range s.regPatternToApp {
+		for app := range apps {
+			files[pattern] = append(files[pattern], app)
+		}
+	}
+	s.fileLock.RUnlock()
+
+	s.nsLock.RLock()
+	namespaces = make(map[string][]string, len(s.regNSToApp))
+	for ns, apps := range s.regNSToApp {
+		for app := range apps {
+			namespaces[ns] = append(namespaces[ns], app)
+		}
+	}
+	s.nsLock.RUnlock()
+	return files, namespaces
+}
+
+// Renotify notify the app of conn all its subscribed files of namespace again, all namespaces if namespace
+// is empty, the failed notifies go into failed loop
+func (s *Syncer) Renotify(conn, namespace string) error {
+	app := s.GetAppByConn(conn)
+	if app == nil {
+		return fmt.Errorf("app of conn %v not registered", conn)
+	}
+
+	ns2Files := map[string][]string{}
+	s.fileLock.RLock()
+	for fullname := range app.Files {
+		parts := strings.SplitN(fullname, "/", 2)
+		if len(parts) != 2 || (namespace != "" && parts[0] != namespace) {
+			continue
+		}
+		ns2Files[parts[0]] = append(ns2Files[parts[0]], parts[1])
+	}
+	s.fileLock.RUnlock()
+
+	var lastErr error
+	for ns, files := range ns2Files {
+		task := notifyTask{conn, ns, files, uuid.NewUUID()}
+		if err := s.doNotify(task); err != nil {
+			alog.Errorf("Renotify Failed, task:%v go into failed loop: %v", conn, err)
+			NotifyRetries.Inc()
+			s.addNotifyConnFileUpdateTask(&scheduleNotifyTask{&task, 0, 1})
+			lastErr = err
+			continue
+		}
+		alog.Infof("renotify %v update ns %v", conn, ns)
+	}
+	return lastErr
+}
+
 func (s *Syncer) doNotify(task notifyTask) error {
 	config := map[string][]string{
 		task.namespace: task.files,
@@ -277,6 +490,9 @@ func (s *Syncer) doNotify(task notifyTask) error {
 
 	alog.Info("task.conn: ", task.conn)
 	c := s.cfg.CmdServer.NewCmdReq(SDKFileCMD, args, task.conn)
+	if task.uuid != "" {
+		c.UUID = task.uuid
+	}
 	resp, err := s.cfg.CmdServer.SendSync(c, DefaultNotifyTimeout)
 	if err != nil {
 		alog.Errorf("Send Cmd %s failed: %v ", SDKFileCMD, err)
@@ -0,0 +1,46 @@
+package syncer
+
+import (
+	"testing"
+	"time"
+
+	"code.xxxxx.cn/platform/galaxy/pkg/component/cmd"
+	"code.xxxxx.cn/platform/galaxy/pkg/component/cmd/cmdtest"
+)
+
+func TestNotifyRetryKeepUUID(t *testing.T) {
+	h := cmdtest.New(t)
+	defer h.Close()
+
+	// the first notify failed, and it is retried
+	calls := 0
+	handler := cmdtest.NewFakeHandler(func(req *cmd.Req) *cmd.Resp {
+		calls++
+		if calls == 1 {
+			return cmd.RespFailed()
+		}
+		return cmd.RespSucceed("")
+	})
+	h.Client.AddCmdHandler(SDKFileCMD, handler.Handle)
+
+	s := NewSyncer(Config{CmdServer: h.Server, WorkerNum: 1})
+	s.RegisterApp(&AppDescribe{AppID: "app", Files: map[string]struct{}{"ns/a.yaml": {}}}, cmdtest.DefaultClientName)
+	s.NotifyUpdate("ns", []string{"a.yaml"})
+	if tasks := s.NotifyTasks(); len(tasks) != 1 || tasks[0].UUID == "" {
+		t.Fatalf("expect failed notify queued with uuid, got %+v", tasks)
+	}
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	go s.Run(stopCh)
+	for i := 0; i < 2; i++ {
+		select {
+		case <-handler.Received():
+		case <-time.After(cmdtest.DefaultTimeout):
+			t.Fatalf("expect notify retried")
+		}
+	}
+	if reqs := handler.Reqs(); reqs[0].UUID != reqs[1].UUID {
+		t.Errorf("expect notify retried with the same uuid, got %s and %s", reqs[0].UUID, reqs[1].UUID)
+	}
+}
@@ -21,11 +21,13 @@ import (
 /*
 FmDataPath dump path
 FmDumpInterval dump interval
+HubDataPath dump path of updates queued
 DefaultWorkerNum worker number
 */
 const (
 	FmDataPath     = "vmqueue_v1/filemapper.json"
 	FmDumpInterval = 600
+	HubDataPath    = "vmqueue_v1/updatehub.json"
 
 	DefaultWorkerNum = 8
 )
@@ -51,6 +53,19 @@ type fileData struct {
 	digest    string
 }
 
+// queuedUpdate is a package or file update persisted
+type queuedUpdate struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name,omitempty"`
+	Digest    string `json:"digest"`
+}
+
+// hubData is the updates queued persisted
+type hubData struct {
+	Packages []queuedUpdate `json:"packages"`
+	Files    []queuedUpdate `json:"files"`
+}
+
 // UpdateHub is update hub
 type UpdateHub struct {
 	cfg Config
@@ -60,6 +75,8 @@ type UpdateHub struct {
 
 	fileQueue     []*fileData
 	fileQueueLock sync.Mutex
+
+	onUpdated []func(namespace string, files []string)
 }
 
 // NewUpdateHub return new update hub
@@ -72,20 +89,30 @@ func NewUpdateHub(config Config) *UpdateHub {
 		cfg:          config,
 		packageQueue: []*packageData{},
 	}
+	u.load()
 
 	return &u
 }
 
-// Start loop
-func (fu *UpdateHub) Start() {
+// Start dispatch updates queued to workers until stopCh closed, it returns after the updates in progress
+// finished, the ones dispatched but not started are put back to queues to dump
+func (fu *UpdateHub) Start(stopCh <-chan struct{}) {
 	packageChan := make(chan packageData, fu.cfg.WorkersNum)
 	fileChan := make(chan fileData, fu.cfg.WorkersNum)
 
+	var wg sync.WaitGroup
+	wg.Add(2 + 2*fu.cfg.WorkersNum)
+
 	// task package data from package queue
 	go func() {
+		defer wg.Done()
 		for {
 			if len(fu.packageQueue) == 0 {
-				time.Sleep(time.Second)
+				select {
+				case <-stopCh:
+					return
+				case <-time.After(time.Second):
+				}
 				continue
 			}
 
@@ -95,15 +122,27 @@ func (fu *UpdateHub) Start() {
 			fu.packageQueue = fu.packageQueue[1:]
 			fu.packageQueueLock.Unlock()
 
-			packageChan <- *data
+			select {
+			case packageChan <- *data:
+			case <-stopCh:
+				fu.packageQueueLock.Lock()
+				fu.packageQueue = append([]*packageData{data}, fu.packageQueue...)
+				fu.packageQueueLock.Unlock()
+				return
+			}
 		}
 	}()
 
-	// task package data from package queue
+	// task file data from file queue
 	go func() {
+		defer wg.Done()
 		for {
 			if len(fu.fileQueue) == 0 {
-				time.Sleep(time.Second)
+				select {
+				case <-stopCh:
+					return
+				case <-time.After(time.Second):
+				}
 				continue
 			}
 
@@ -113,27 +152,81 @@ func (fu *UpdateHub) Start() {
 			fu.fileQueue = fu.fileQueue[1:]
 			fu.fileQueueLock.Unlock()
 
-			fileChan <- *data
+			select {
+			case fileChan <- *data:
+			case <-stopCh:
+				fu.fileQueueLock.Lock()
+				fu.fileQueue = append([]*fileData{data}, fu.fileQueue...)
+				fu.fileQueueLock.Unlock()
+				return
+			}
 		}
 	}()
 
 	for i := 0; i < fu.cfg.WorkersNum; i++ {
-		go fu.runPackageWorkers(packageChan)
-		go fu.runFileWorkers(fileChan)
+		go func() {
+			defer wg.Done()
+			fu.runPackageWorkers(packageChan, stopCh)
+		}()
+		go func() {
+			defer wg.Done()
+			fu.runFileWorkers(fileChan, stopCh)
+		}()
 	}
+	wg.Wait()
+
+	// put back the updates dispatched but not started
+	close(packageChan)
+	close(fileChan)
+	packages := []*packageData{}
+	for data := range packageChan {
+		d := data
+		packages = append(packages, &d)
+	}
+	files := []*fileData{}
+	for data := range fileChan {
+		d := data
+		files = append(files, &d)
+	}
+	fu.packageQueueLock.Lock()
+	fu.packageQueue = append(packages, fu.packageQueue...)
+	fu.packageQueueLock.Unlock()
+	fu.fileQueueLock.Lock()
+	fu.fileQueue = append(files, fu.fileQueue...)
+	fu.fileQueueLock.Unlock()
 }
 
-func (fu *UpdateHub) runPackageWorkers(packageChan chan packageData) {
+func (fu *UpdateHub) runPackageWorkers(packageChan chan packageData, stopCh <-chan struct{}) {
 	for {
-		data := <-packageChan
-		fu.runPackageUpdated(data)
+		select {
+		case <-stopCh:
+			return
+		case data := <-packageChan:
+			fu.runPackageUpdated(data)
+		}
 	}
 }
 
-func (fu *UpdateHub) runFileWorkers(fileChan chan fileData) {
+func (fu *UpdateHub) runFileWorkers(fileChan chan fileData, stopCh <-chan struct{}) {
 	for {
-		data := <-fileChan
-		fu.runFileUpdated(data)
+		select {
+		case <-stopCh:
+			return
+		case data := <-fileChan:
+			fu.runFileUpdated(data)
+		}
+	}
+}
+
+// OnUpdated register callback called after files of namespace updated in filedb, it must be registered before Start
+func (fu *UpdateHub) OnUpdated(f func(namespace string, files []string)) {
+	fu.onUpdated = append(fu.onUpdated, f)
+}
+
+// fireUpdated call callbacks of files updated
+func (fu *UpdateHub) fireUpdated(namespace string, files []string) {
+	for _, f := range fu.onUpdated {
+		f(namespace, files)
 	}
 }
 
@@ -153,6 +246,77 @@ func (fu *UpdateHub) FileUpdated(namespace, name, digest string) error {
 	return nil
 }
 
+// QueueLen return the number of packages and files waiting to update
+func (fu *UpdateHub) QueueLen() (packages, files int) {
+	fu.packageQueueLock.Lock()
+	packages = len(fu.packageQueue)
+	fu.packageQueueLock.Unlock()
+
+	fu.fileQueueLock.Lock()
+	files = len(fu.fileQueue)
+	fu.fileQueueLock.Unlock()
+	return packages, files
+}
+
+// Dump persist the updates queued, they are queued again when update hub built next time
+func (fu *UpdateHub) Dump() error {
+	d := &hubData{Packages: []queuedUpdate{}, Files: []queuedUpdate{}}
+	fu.packageQueueLock.Lock()
+	for _, p := range fu.packageQueue {
+		d.Packages = append(d.Packages, queuedUpdate{Namespace: p.namespace, Digest: p.digest})
+	}
+	fu.packageQueueLock.Unlock()
+	fu.fileQueueLock.Lock()
+	for _, f := range fu.fileQueue {
+		d.Files = append(d.Files, queuedUpdate{Namespace: f.namespace, Name: f.name, Digest: f.digest})
+	}
+	fu.fileQueueLock.Unlock()
+
+	data, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+	if _, err := fu.cfg.FDB.StoreRawFile(HubDataPath, nil, bytes.NewReader(data)); err != nil {
+		return err
+	}
+	alog.Infof("Dumped %d package updates and %d file updates", len(d.Packages), len(d.Files))
+	return nil
+}
+
+// load queue the updates dumped, the dump is cleared as the updates may be done before next dump
+func (fu *UpdateHub) load() {
+	if fu.cfg.FDB == nil {
+		return
+	}
+	_, r, err := fu.cfg.FDB.VisitRawFile(HubDataPath)
+	if err != nil {
+		alog.Infof("No updates dumped: %v", err)
+		return
+	}
+	data, err := ioutil.ReadAll(r)
+	r.Close()
+	if err != nil {
+		alog.Warningf("Read updates dumped failed: %v", err)
+		return
+	}
+	d := &hubData{}
+	if err := json.Unmarshal(data, d); err != nil {
+		alog.Warningf("Unmarshal updates dumped failed: %v", err)
+		return
+	}
+
+	for _, p := range d.Packages {
+		fu.packageQueue = append(fu.packageQueue, &packageData{p.Namespace, p.Digest})
+	}
+	for _, f := range d.Files {
+		fu.fileQueue = append(fu.fileQueue, &fileData{f.Namespace, f.Name, f.Digest})
+	}
+	if _, err := fu.cfg.FDB.StoreRawFile(HubDataPath, nil, bytes.NewReader([]byte("{}"))); err != nil {
+		alog.Warningf("Clear updates dumped failed: %v", err)
+	}
+	alog.Infof("Loaded %d package updates and %d file updates dumped", len(d.Packages), len(d.Files))
+}
+
 func (fu *UpdateHub) runPackageUpdated(data packageData) {
 	// 1. unpack
 	_, r, err := fu.cfg.FDB.VisitPackage(utils.FdbSite, data.namespace)
@@ -194,6 +358,9 @@ func (fu *UpdateHub) runPackageUpdated(data packageData) {
 
 	fu.cfg.FM.Update(data.namespace, diffedFile)
 	fu.cfg.Syncer.NotifyUpdate(data.namespace, files)
+	if len(files) != 0 {
+		fu.fireUpdated(data.namespace, files)
+	}
 }
 
 func (fu *UpdateHub) runFileUpdated(data fileData) {
@@ -211,6 +378,7 @@ func (fu *UpdateHub) runFileUpdated(data fileData) {
 	// Do notify syncer
 	fu.cfg.FM.Update(data.namespace, map[string]string{data.name: data.digest})
 	fu.cfg.Syncer.NotifyUpdate(data.namespace, []string{data.name})
+	fu.fireUpdated(data.namespace, []string{data.name})
 }
 
 func untar(r io.Reader, writeFunc func(closer io.Reader, filename string) error) (err error) {
@@ -275,11 +443,17 @@ func NewFileMapper(fdb *filedb.FileDB) *FileMapper {
 	return &fm
 }
 
-// Run .
-func (fm *FileMapper) Run() {
+// Run dump file mapper every FmDumpInterval until stopCh closed
+func (fm *FileMapper) Run(stopCh <-chan struct{}) {
+	ticker := time.NewTicker(FmDumpInterval * time.Second)
+	defer ticker.Stop()
 	for {
-		fm.dump()
-		time.Sleep(FmDumpInterval * time.Second)
+		fm.Dump()
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C:
+		}
 	}
 }
 
@@ -326,6 +500,48 @@ func (fm *FileMapper) Set(namespace, key, value string) {
 	fm.content[namespace][key] = value
 }
 
+// Copy return a deep copy of digests of all files
+func (fm *FileMapper) Copy() map[string]map[string]string {
+	fm.mapLock.RLock()
+	namespaces := make([]string, 0, len(fm.content))
+	for ns := range fm.content {
+		namespaces = append(namespaces, ns)
+	}
+	fm.mapLock.RUnlock()
+
+	content := make(map[string]map[string]string, len(namespaces))
+	for _, ns := range namespaces {
+		fm.EnsureNamespace(ns)
+		fm.contentLock[ns].RLock()
+		files := make(map[string]string, len(fm.content[ns]))
+		for k, v := range fm.content[ns] {
+			files[k] = v
+		}
+		fm.contentLock[ns].RUnlock()
+		content[ns] = files
+	}
+	return content
+}
+
+// Count return the number of files of every namespace
+func (fm *FileMapper) Count() map[string]int {
+	fm.mapLock.RLock()
+	namespaces := make([]string, 0, len(fm.content))
+	for ns := range fm.content {
+		namespaces = append(namespaces, ns)
+	}
+	fm.mapLock.RUnlock()
+
+	counts := make(map[string]int, len(namespaces))
+	for _, ns := range namespaces {
+		fm.EnsureNamespace(ns)
+		fm.contentLock[ns].RLock()
+		counts[ns] = len(fm.content[ns])
+		fm.contentLock[ns].RUnlock()
+	}
+	return counts
+}
+
 // EnsureNamespace .
 func (fm *FileMapper) EnsureNamespace(namespace string) {
 	if _, ok := fm.contentLock[namespace]; !ok {
@@ -370,8 +586,9 @@ func (fm *FileMapper) Diff(namespace string, target map[string]string) (map[stri
 	return diffedMap, missedMap
 }
 
-func (fm *FileMapper) dump() {
-	data, err := json.Marshal(fm.content)
+// Dump persist digests of all files, they are loaded when file mapper built next time
+func (fm *FileMapper) Dump() {
+	data, err := json.Marshal(fm.Copy())
 	if err != nil {
 		alog.Warningf("marshal file mapper failed: %v", err)
 		return
@@ -1,10 +1,12 @@
 package vm
 
 import (
+	"bytes"
 	"context"
 	"crypto/tls"
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"net"
 	"net/http"
 	"net/url"
@@ -18,6 +20,8 @@ import (
 	"code.xxxxx.cn/platform/galaxy/pkg/agent/utils"
 
 	"code.xxxxx.cn/platform/galaxy/pkg/agent/updater"
+	"code.xxxxx.cn/platform/galaxy/pkg/component/cmd"
+	pb "code.xxxxx.cn/platform/galaxy/pkg/component/cmd/v1"
 	"code.xxxxx.cn/platform/galaxy/pkg/component/storage/filedb"
 
 	"code.xxxxx.cn/platform/galaxy/pkg/manager/provider"
@@ -45,6 +49,10 @@ const (
 	DefaultGalaxyUser       = "galaxy"
 
 	MaxFailedThreshold = 10
+	// DefaultPackageCmdTimeout max time to download a package by cmd
+	DefaultPackageCmdTimeout = 5 * time.Minute
+	// QueueDataPath is the raw file to persist download tasks across restarts
+	QueueDataPath = "vmqueue_v1/downloads.json"
 )
 
 /*
@@ -63,6 +71,8 @@ type Config struct {
 
 	Fdb       *filedb.FileDB
 	UpdateHub *updater.UpdateHub
+	// CmdClient download packages by chunked cmd if set, fallback to http if failed
+	CmdClient cmd.Client
 }
 
 // VersionManager .
@@ -86,6 +96,12 @@ type DownloadTask struct {
 	Args     []string `json:"args"`
 }
 
+// queueData is the download tasks persisted
+type queueData struct {
+	Downloads []DownloadTask `json:"downloads"`
+	Failures  []DownloadTask `json:"failures"`
+}
+
 // NewVersionManager return version manager instance
 func NewVersionManager(config Config) *VersionManager {
 
@@ -120,17 +136,32 @@ func NewVersionManager(config Config) *VersionManager {
 		downloadMap:   map[string]struct{}{},
 		netClient:     client,
 	}
+	vm.load()
 
 	return &vm
 }
 
-// Start dump download queue and consumer
-func (vm *VersionManager) Start() {
+// Start consume download queue and retry failed tasks until stopCh closed, it returns after the
+// downloads in progress finished, the tasks not started are kept in queues to dump
+func (vm *VersionManager) Start(stopCh <-chan struct{}) {
+	var wg sync.WaitGroup
+	defer wg.Wait()
 
+	wg.Add(1)
 	go func(vm *VersionManager) {
+		defer wg.Done()
 		for {
+			select {
+			case <-stopCh:
+				return
+			default:
+			}
 			if len(vm.downloadQueue) == 0 {
-				time.Sleep(time.Second)
+				select {
+				case <-stopCh:
+					return
+				case <-time.After(time.Second):
+				}
 				continue
 			}
 
@@ -147,8 +178,14 @@ func (vm *VersionManager) Start() {
 		}
 	}(vm)
 
+	ticker := time.NewTicker(time.Second * time.Duration(vm.cfg.CheckInterval))
+	defer ticker.Stop()
 	for {
-		time.Sleep(time.Second * time.Duration(vm.cfg.CheckInterval))
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C:
+		}
 		if len(vm.failureQueue) == 0 {
 			continue
 		}
@@ -160,7 +197,16 @@ func (vm *VersionManager) Start() {
 
 		failuredTasks := []DownloadTask{}
 		doneFailureMap := map[string]struct{}{}
-		for _, t := range tasks {
+	retry:
+		for i, t := range tasks {
+			select {
+			case <-stopCh:
+				// keep the tasks not retried to dump
+				failuredTasks = append(failuredTasks, tasks[i:]...)
+				break retry
+			default:
+			}
+
 			key := strings.Join(t.Args, "/")
 			if _, ok := doneFailureMap[key]; ok {
 				alog.Info("Merge Failure Download Task: %v", t.URL)
@@ -207,7 +253,7 @@ func (vm *VersionManager) AddDownloadPackageTask(namespace, digest string) {
 	task := DownloadTask{
 		URL:      provider.PackageURLPrefix + vm.cfg.SiteID + "/" + namespace + "?" + url.Values{"digest": []string{digest}}.Encode(),
 		Callback: DownloadPackageCallback,
-		Args:     []string{namespace},
+		Args:     args,
 	}
 
 	vm.downloadMap[key] = struct{}{}
@@ -237,6 +283,99 @@ func (vm *VersionManager) AddDownloadFileTask(namespace, filename, version strin
 	vm.downloadQueue = append(vm.downloadQueue, task)
 }
 
+// Queues return copies of the tasks waiting to download and the failed tasks waiting to retry
+func (vm *VersionManager) Queues() (downloads, failures []DownloadTask) {
+	vm.queueLock.Lock()
+	downloads = append([]DownloadTask{}, vm.downloadQueue...)
+	vm.queueLock.Unlock()
+
+	vm.failureLock.Lock()
+	failures = append([]DownloadTask{}, vm.failureQueue...)
+	vm.failureLock.Unlock()
+	return downloads, failures
+}
+
+// RetryFailure move the failed tasks of key back to download queue now, key is the args of task joined by "/",
+// all failed tasks are moved if key is empty, return the number of tasks moved
+func (vm *VersionManager) RetryFailure(key string) int {
+	vm.failureLock.Lock()
+	var retries, remains []DownloadTask
+	for _, t := range vm.failureQueue {
+		if key == "" || strings.Join(t.Args, "/") == key {
+			retries = append(retries, t)
+		} else {
+			remains = append(remains, t)
+		}
+	}
+	vm.failureQueue = remains
+	vm.failureLock.Unlock()
+
+	vm.queueLock.Lock()
+	defer vm.queueLock.Unlock()
+	for _, t := range retries {
+		k := strings.Join(t.Args, "/")
+		if _, ok := vm.downloadMap[k]; ok {
+			continue
+		}
+		alog.Infof("Retry Failure Download Task: %v", t.URL)
+		vm.downloadMap[k] = struct{}{}
+		vm.downloadQueue = append(vm.downloadQueue, t)
+	}
+	return len(retries)
+}
+
+// Dump persist the tasks waiting to download and the failed tasks, they are queued again when
+// version manager built next time
+func (vm *VersionManager) Dump() error {
+	downloads, failures := vm.Queues()
+	data, err := json.Marshal(&queueData{Downloads: downloads, Failures: failures})
+	if err != nil {
+		return err
+	}
+	if _, err := vm.cfg.Fdb.StoreRawFile(QueueDataPath, nil, bytes.NewReader(data)); err != nil {
+		return err
+	}
+	alog.Infof("Dumped %d download tasks and %d failed tasks", len(downloads), len(failures))
+	return nil
+}
+
+// load queue the tasks dumped, the dump is cleared as the tasks may be done before next dump
+func (vm *VersionManager) load() {
+	if vm.cfg.Fdb == nil {
+		return
+	}
+	_, r, err := vm.cfg.Fdb.VisitRawFile(QueueDataPath)
+	if err != nil {
+		alog.Infof("No download tasks dumped: %v", err)
+		return
+	}
+	data, err := ioutil.ReadAll(r)
+	r.Close()
+	if err != nil {
+		alog.Warningf("Read download tasks dumped failed: %v", err)
+		return
+	}
+	q := &queueData{}
+	if err := json.Unmarshal(data, q); err != nil {
+		alog.Warningf("Unmarshal download tasks dumped failed: %v", err)
+		return
+	}
+
+	for _, t := range q.Downloads {
+		key := strings.Join(t.Args, "/")
+		if _, ok := vm.downloadMap[key]; ok {
+			continue
+		}
+		vm.downloadMap[key] = struct{}{}
+		vm.downloadQueue = append(vm.downloadQueue, t)
+	}
+	vm.failureQueue = append(vm.failureQueue, q.Failures...)
+	if _, err := vm.cfg.Fdb.StoreRawFile(QueueDataPath, nil, bytes.NewReader([]byte("{}"))); err != nil {
+		alog.Warningf("Clear download tasks dumped failed: %v", err)
+	}
+	alog.Infof("Loaded %d download tasks and %d failed tasks dumped", len(q.Downloads), len(q.Failures))
+}
+
 //
 func (vm *VersionManager) popDownloadTask() DownloadTask {
 	vm.queueLock.Lock()
@@ -250,6 +389,14 @@ func (vm *VersionManager) popDownloadTask() DownloadTask {
 }
 
 func (vm *VersionManager) doDownload(task DownloadTask) error {
+	if task.Callback == DownloadPackageCallback && vm.cfg.CmdClient != nil && len(task.Args) == 2 {
+		err := vm.downloadPackageByCmd(task.Args[0], task.Args[1])
+		if err == nil {
+			return nil
+		}
+		alog.Warningf("Download package %v by cmd failed, fallback to http: %v", task.Args[0], err)
+	}
+
 	req, err := http.NewRequest("GET", vm.cfg.ProviderAddress+task.URL, nil)
 	if err != nil {
 		return fmt.Errorf("new request failed: %v", err)
@@ -334,6 +481,35 @@ func (vm *VersionManager) doDownload(task DownloadTask) error {
 	return nil
 }
 
+// downloadPackageByCmd download package through the chunked cmd channel of manager
+func (vm *VersionManager) downloadPackageByCmd(namespace, digest string) error {
+	req := vm.cfg.CmdClient.NewCmdReq(cmd.PackageContentHandler, nil)
+	if err := cmd.SetNSPackagePayload(req, &pb.NSPackagePayload{Namespace: namespace, Digest: digest}); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultPackageCmdTimeout)
+	defer cancel()
+	resp, err := vm.cfg.CmdClient.SendSyncContext(ctx, req)
+	if err != nil {
+		return err
+	}
+	defer resp.Close()
+	if resp.Code != cmd.SuccessCode || !resp.IsChunked() {
+		return errors.Errorf("Download request failed code: %v, msg: %v", resp.Code, resp.Msg)
+	}
+
+	storedDigest, err := vm.cfg.Fdb.StorePackage(utils.FdbSite, namespace, resp)
+	if err != nil {
+		return err
+	}
+	if resp.Data != storedDigest {
+		return ErrDigestNotMatch
+	}
+
+	return vm.NotifyNSUpdate(namespace, resp.Data)
+}
+
 // NotifyNSUpdate . notify updater package updated
 func (vm *VersionManager) NotifyNSUpdate(namespace, digest string) error {
 	return vm.cfg.UpdateHub.PackageUpdated(namespace, digest)
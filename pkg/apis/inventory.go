@@ -0,0 +1,52 @@
+package apis
+
+import "time"
+
+// ClusterInventory is the summary of kubernetes workloads reported by agent of a site
+type ClusterInventory struct {
+	SiteID      string              `json:"site_id"`
+	ReportedAt  time.Time           `json:"reported_at"`
+	Nodes       []NodeSummary       `json:"nodes"`
+	Namespaces  []NamespaceSummary  `json:"namespaces"`
+	Deployments []DeploymentSummary `json:"deployments"`
+	Pods        []PodSummary        `json:"pods"`
+}
+
+// NodeSummary is the summary of a kubernetes node
+type NodeSummary struct {
+	Name           string `json:"name"`
+	Ready          bool   `json:"ready"`
+	Unschedulable  bool   `json:"unschedulable"`
+	KubeletVersion string `json:"kubelet_version"`
+}
+
+// NamespaceSummary is the summary of a kubernetes namespace
+type NamespaceSummary struct {
+	Name  string `json:"name"`
+	Phase string `json:"phase"`
+}
+
+// DeploymentSummary is the summary of a kubernetes deployment
+type DeploymentSummary struct {
+	Namespace         string   `json:"namespace"`
+	Name              string   `json:"name"`
+	Replicas          int32    `json:"replicas"`
+	ReadyReplicas     int32    `json:"ready_replicas"`
+	UpdatedReplicas   int32    `json:"updated_replicas"`
+	AvailableReplicas int32    `json:"available_replicas"`
+	Images            []string `json:"images"`
+}
+
+// PodSummary is the summary of a kubernetes pod
+type PodSummary struct {
+	Namespace string   `json:"namespace"`
+	Name      string   `json:"name"`
+	Node      string   `json:"node"`
+	IP        string   `json:"ip"`
+	Phase     string   `json:"phase"`
+	Ready     bool     `json:"ready"`
+	Restarts  int32    `json:"restarts"`
+	Images    []string `json:"images"`
+	// MayaApp is true if the pod is a maya application pod, which loads configs from agent
+	MayaApp bool `json:"maya_app"`
+}
@@ -2,3 +2,11 @@ package apis
 
 // ConnectionSplit the split character between site_id and timestamp in connection key
 const ConnectionSplit = "@@"
+
+/* labels of agent connection info, used to select agents to broadcast cmd */
+const (
+	// LabelSiteID is the site id of agent
+	LabelSiteID = "site_id"
+	// LabelBusinessLine is the business line of agent site
+	LabelBusinessLine = "business_line"
+)
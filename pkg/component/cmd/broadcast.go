@@ -0,0 +1,160 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"code.xxxxx.cn/platform/galaxy/pkg/component/conns"
+	"code.xxxxx.cn/platform/galaxy/pkg/util/alog"
+)
+
+const (
+	// DefaultBroadcastParallelism default max number of executors to send cmd at the same time
+	DefaultBroadcastParallelism = 10
+	// DefaultBroadcastTimeout default max time to wait for response of every executor
+	DefaultBroadcastTimeout = 10 * time.Second
+)
+
+// Selector select the executors to broadcast cmd by info labels of their connections
+type Selector interface {
+	// Matches return true if the connection info matched
+	Matches(info map[string]string) bool
+}
+
+// LabelSelector select connections whose info contains all the key=value labels, empty selector select everything
+type LabelSelector map[string]string
+
+// Matches return true if info contains all labels of selector
+func (ls LabelSelector) Matches(info map[string]string) bool {
+	for k, v := range ls {
+		if value, ok := info[k]; !ok || value != v {
+			return false
+		}
+	}
+	return true
+}
+
+// SelectorFunc is an adapter to use a func as Selector
+type SelectorFunc func(info map[string]string) bool
+
+// Matches call the func
+func (f SelectorFunc) Matches(info map[string]string) bool {
+	return f(info)
+}
+
+// BroadcastOptions is options to broadcast cmd
+type BroadcastOptions struct {
+	// Parallelism is max number of executors to send cmd at the same time, default is DefaultBroadcastParallelism
+	Parallelism int
+	// Timeout is max time to wait for response of every executor, default is DefaultBroadcastTimeout
+	Timeout time.Duration
+}
+
+// ExecutorResult is the result of cmd executed by an executor
+type ExecutorResult struct {
+	// Executor is the connection key of executor
+	Executor string
+	// Resp is the response of executor, nil if send failed or timeout
+	Resp *Resp
+	// Err is the error when send failed, or resp code is not succeed
+	Err error
+}
+
+// BroadcastResult is the aggregated results of all executors broadcast to
+type BroadcastResult struct {
+	Succeeded []*ExecutorResult
+	Failed    []*ExecutorResult
+	TimedOut  []*ExecutorResult
+}
+
+// Total return the number of all executors broadcast to
+func (r *BroadcastResult) Total() int {
+	return len(r.Succeeded) + len(r.Failed) + len(r.TimedOut)
+}
+
+// SendBroadcast send cmd to all executors selected by selector with bounded parallelism, and wait for all results,
+// name and args of req are sent to every executor with a new uuid, stream responses are closed immediately
+func (cs *cmdServer) SendBroadcast(req *Req, selector Selector, opts *BroadcastOptions) (*BroadcastResult, error) {
+	if req == nil || req.Name == "" {
+		return nil, fmt.Errorf("cmd request name can't be empty")
+	}
+	if selector == nil {
+		selector = LabelSelector{}
+	}
+	parallelism, timeout := DefaultBroadcastParallelism, DefaultBroadcastTimeout
+	if opts != nil && opts.Parallelism > 0 {
+		parallelism = opts.Parallelism
+	}
+	if opts != nil && opts.Timeout > 0 {
+		timeout = opts.Timeout
+	}
+
+	var executors []*conns.Conn
+	if labels, ok := selector.(LabelSelector); ok {
+		// look up by the label index of connections
+		executors = cs.connManager.ListConnsByLabels(labels)
+	} else {
+		executors = cs.connManager.ListConns(func(conn *conns.Conn) bool {
+			return selector.Matches(conn.Info)
+		})
+	}
+	alog.V(4).Infof("Broadcast cmd %s to %d executors", req.Name, len(executors))
+
+	result := &BroadcastResult{}
+	lock := sync.Mutex{}
+	tokens := make(chan struct{}, parallelism)
+	wg := sync.WaitGroup{}
+	for _, conn := range executors {
+		tokens <- struct{}{}
+		wg.Add(1)
+		go func(executor string) {
+			defer func() {
+				<-tokens
+				wg.Done()
+			}()
+			r, timedOut := cs.sendToExecutor(req, executor, timeout)
+
+			lock.Lock()
+			defer lock.Unlock()
+			switch {
+			case timedOut:
+				result.TimedOut = append(result.TimedOut, r)
+			case r.Err != nil:
+				result.Failed = append(result.Failed, r)
+			default:
+				result.Succeeded = append(result.Succeeded, r)
+			}
+		}(conn.Key)
+	}
+	wg.Wait()
+
+	alog.Infof("Broadcast cmd %s finished: %d succeeded, %d failed, %d timed out",
+		req.Name, len(result.Succeeded), len(result.Failed), len(result.TimedOut))
+	return result, nil
+}
+
+// sendToExecutor send a copy of req to executor and wait for response until timeout
+func (cs *cmdServer) sendToExecutor(req *Req, executor string, timeout time.Duration) (*ExecutorResult, bool) {
+	ctx, cancel := context.WithTimeout(req.Context(), timeout)
+	defer cancel()
+
+	r := &ExecutorResult{Executor: executor}
+	execReq := cs.NewCmdReq(req.Name, req.Args, executor)
+	execReq.Payload, execReq.TypeURL = req.Payload, req.TypeURL
+	r.Resp, r.Err = cs.SendSyncContext(ctx, execReq)
+	if r.Err != nil {
+		return r, ctx.Err() == context.DeadlineExceeded
+	}
+	if r.Resp.IsStream() {
+		// broadcast not support stream response, close it to release the stream at executor
+		if err := r.Resp.Close(); err != nil {
+			alog.Warningf("Close stream resp of broadcast cmd %s from %s failed: %v", req.Name, executor, err)
+		}
+	}
+	if r.Resp.Code != SuccessCode {
+		r.Err = fmt.Errorf("executor %s response code %d: %s", executor, r.Resp.Code, r.Resp.Msg)
+	}
+	return r, false
+}
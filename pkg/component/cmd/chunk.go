@@ -0,0 +1,135 @@
+package cmd
+
+import (
+	"fmt"
+	"hash/crc32"
+	"io"
+
+	pb "code.xxxxx.cn/platform/galaxy/pkg/component/cmd/v1"
+	"code.xxxxx.cn/platform/galaxy/pkg/util/alog"
+)
+
+const (
+	// ChunkSize max size of raw bytes sent in one chunk
+	ChunkSize = 64 * 1024
+	// ChunkWindow max number of chunks sent but not acknowledged by caller
+	ChunkWindow = 16
+)
+
+// chunkReceiver reorder the chunks or stream packages received by sequence, as packages are processed concurrently
+type chunkReceiver struct {
+	next    uint64
+	pending map[uint64]*pb.CmdPackage
+}
+
+// newChunkReceiver build a chunkReceiver expects the first package with sequence next
+func newChunkReceiver(next uint64) *chunkReceiver {
+	return &chunkReceiver{next: next, pending: make(map[uint64]*pb.CmdPackage)}
+}
+
+// push save the chunk and return all chunks ready in order, duplicated chunks are ignored
+func (r *chunkReceiver) push(c *pb.CmdPackage) []*pb.CmdPackage {
+	if c.Seq < r.next {
+		return nil
+	}
+	r.pending[c.Seq] = c
+
+	var ready []*pb.CmdPackage
+	for {
+		chunk, ok := r.pending[r.next]
+		if !ok {
+			return ready
+		}
+		delete(r.pending, r.next)
+		ready = append(ready, chunk)
+		r.next++
+	}
+}
+
+// verifyChunk check the checksum of chunk data
+func verifyChunk(c *pb.CmdPackage) error {
+	if sum := crc32.ChecksumIEEE(c.RespData); sum != c.Checksum {
+		return fmt.Errorf("checksum of chunk %d mismatch, expect %d, got %d", c.Seq, c.Checksum, sum)
+	}
+	return nil
+}
+
+// sendChunks send the stream of resp as sequenced raw bytes chunks, the header chunk with seq 0
+// carries Data of resp, at most ChunkWindow chunks are sent before acknowledged by caller
+func (cm *cmdManager) sendChunks(cmd *pb.CmdPackage, resp *Resp) error {
+	credits := cm.newCredits(cmd.UUID, ChunkWindow, resp.creditTimeout)
+	defer cm.credits.Delete(cmd.UUID)
+
+	cmd.Stream = true
+	cmd.Chunked = true
+	cmd.RespData = []byte(resp.Data)
+	cmd.Seq, cmd.Checksum = 0, crc32.ChecksumIEEE(cmd.RespData)
+	if err := cm.respCmd(cmd); err != nil {
+		return err
+	}
+
+	var readers []io.Reader
+	for _, reader := range resp.stream.readers {
+		readers = append(readers, reader)
+	}
+	reader := io.MultiReader(readers...)
+	buf := make([]byte, ChunkSize)
+	for seq := uint64(1); ; seq++ {
+		n, readErr := io.ReadFull(reader, buf)
+		eof := readErr == io.EOF || readErr == io.ErrUnexpectedEOF
+		if eof {
+			readErr = nil
+		} else if readErr != nil {
+			// notify caller the stream is broken by the last chunk
+			cmd.RespCode = FailCode
+			cmd.RespMsg = fmt.Sprintf("read chunk failed: %v", readErr)
+			eof = true
+		}
+		if err := credits.wait(seq, cm.stopCh); err != nil {
+			return fmt.Errorf("send chunks of cmd %s/%s failed: %v", cmd.Name, cmd.UUID, err)
+		}
+
+		cmd.RespData = buf[:n]
+		cmd.Seq, cmd.Checksum, cmd.EOF = seq, crc32.ChecksumIEEE(cmd.RespData), eof
+		if err := cm.respCmd(cmd); err != nil {
+			return err
+		}
+		if eof {
+			return readErr
+		}
+	}
+}
+
+// receiveChunk write the data of chunk to resp stream, acknowledge the executor every half window,
+// close the stream when received the last chunk
+func (cm *cmdManager) receiveChunk(resp *Resp, c *pb.CmdPackage) error {
+	if err := verifyChunk(c); err != nil {
+		return err
+	}
+	if len(c.RespData) > 0 {
+		if _, err := resp.Write(c.RespData); err != nil {
+			return err
+		}
+	}
+	if c.Seq%(ChunkWindow/2) == 0 {
+		cm.grantCredits(c, c.Seq)
+	}
+	if !c.EOF {
+		return nil
+	}
+	if c.RespCode != SuccessCode {
+		return fmt.Errorf("%s", c.RespMsg)
+	}
+	return resp.stream.writer.Close()
+}
+
+// closeChunks close the resp stream with err, the reader of resp will get err after read all data
+func closeChunks(resp *Resp, err error) {
+	if pw, ok := resp.stream.writer.(*io.PipeWriter); ok {
+		_ = pw.CloseWithError(err)
+		return
+	}
+	if err := resp.stream.writer.Close(); err != nil {
+		alog.Warningf("Close chunked stream failed: %v", err)
+	}
+}
@@ -0,0 +1,34 @@
+package cmd
+
+import (
+	"hash/crc32"
+	"testing"
+
+	pb "code.xxxxx.cn/platform/galaxy/pkg/component/cmd/v1"
+)
+
+func TestChunkReceiver(t *testing.T) {
+	r := newChunkReceiver(0)
+	if ready := r.push(&pb.CmdPackage{Seq: 1}); len(ready) != 0 {
+		t.Fatalf("expect chunk 1 pending before header, got %d ready", len(ready))
+	}
+	ready := r.push(&pb.CmdPackage{Seq: 0})
+	if len(ready) != 2 || ready[0].Seq != 0 || ready[1].Seq != 1 {
+		t.Fatalf("expect chunk 0 and 1 ready in order, got %v", ready)
+	}
+	if ready := r.push(&pb.CmdPackage{Seq: 1}); len(ready) != 0 {
+		t.Errorf("expect duplicated chunk ignored, got %v", ready)
+	}
+}
+
+func TestVerifyChunk(t *testing.T) {
+	c := &pb.CmdPackage{Seq: 1, RespData: []byte("chunk")}
+	c.Checksum = crc32.ChecksumIEEE(c.RespData)
+	if err := verifyChunk(c); err != nil {
+		t.Errorf("verify chunk failed: %v", err)
+	}
+	c.RespData[0] = 'C'
+	if err := verifyChunk(c); err == nil {
+		t.Errorf("expect checksum mismatch")
+	}
+}
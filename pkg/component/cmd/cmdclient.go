@@ -3,6 +3,8 @@ package cmd
 import (
 	"context"
 	"io"
+	"sync"
+	"time"
 
 	pb "code.xxxxx.cn/platform/galaxy/pkg/component/cmd/v1"
 	"code.xxxxx.cn/platform/galaxy/pkg/component/conns"
@@ -11,6 +13,9 @@ import (
 	"google.golang.org/grpc/connectivity"
 )
 
+// serverPeer is the name to record liveness of server at client
+const serverPeer = "server"
+
 // cmdClient implements interface CmdListener
 type cmdClient struct {
 	conn            conns.GlobalConn
@@ -18,13 +23,24 @@ type cmdClient struct {
 	stopCh          <-chan struct{}
 	onReadyFuncs    []func()
 	onNotReadyFuncs []func()
+
+	// lock protect the stream listening and its cancel func
+	lock   sync.Mutex
+	stream pb.CmdManager_ExecuteClient
+	cancel context.CancelFunc
+	done   <-chan struct{}
+	// closed is closed once the tunnel closed by Close, never reconnect after it
+	closed    chan struct{}
+	closeOnce sync.Once
 }
 
-// NewCmdClient build command grpc tunnel to lis
-func NewCmdClient(name string, conn conns.GlobalConn, stopCh <-chan struct{}) Client {
-	cc := &cmdClient{}
+// NewCmdClient build command grpc tunnel to lis, opts such as WithInterceptors configure the executor
+func NewCmdClient(name string, conn conns.GlobalConn, stopCh <-chan struct{}, opts ...Option) Client {
+	cc := &cmdClient{closed: make(chan struct{})}
 	cc.conn = conn
-	cc.cmdManager = newCmdManager(name, cc.sendCmdPackage, cc.respCmdSure, stopCh)
+	cc.cmdManager = newCmdManager(name, cc.sendCmdPackage, cc.respCmdSure, stopCh, opts...)
+	// liveness of server is labeled by the site of client
+	cc.cmdManager.heartbeats.site = func(string) string { return siteOf(name) }
 	cc.stopCh = stopCh
 	return cc
 }
@@ -37,6 +53,8 @@ func (cc *cmdClient) StartListen(afterSendRegisterCmd chan struct{}) {
 		select {
 		case <-cc.stopCh:
 			return
+		case <-cc.closed:
+			return
 		default:
 		}
 
@@ -56,22 +74,34 @@ func (cc *cmdClient) StartListen(afterSendRegisterCmd chan struct{}) {
 			if err := cc.sendRegisterCmd(stream); err != nil {
 				return
 			}
+			cc.lock.Lock()
+			cc.stream, cc.cancel, cc.done = stream, cancel, ctx.Done()
+			cc.lock.Unlock()
 
 			// call back ready funcs
 			cc.fireOnReady()
 
 			afterSendRegisterCmd <- struct{}{}
 
+			if cc.cmdManager.heartbeats.interval > 0 {
+				go cc.keepAlive(ctx, cancel)
+			}
+
 			// Always receive command to execute and response sure
 			for {
 				select {
 				case <-cc.stopCh:
 					return
+				case <-cc.closed:
+					return
 				default:
 				}
 
 				alog.V(4).Info("Listen to receive cmd")
-				_, err := cc.cmdManager.onReceive(stream.Recv)
+				recv, err := cc.cmdManager.onReceive(stream.Recv)
+				if err == nil && recv.Name == string(Register) && recv.RespCode != SuccessCode {
+					alog.Errorf("Register to server failed: code=%d msg=%s", recv.RespCode, recv.RespMsg)
+				}
 				if err == io.EOF {
 					alog.V(4).Infof("Client received EOF msg")
 					continue
@@ -90,17 +120,60 @@ func (cc *cmdClient) StartListen(afterSendRegisterCmd chan struct{}) {
 			alog.V(4).Infof("Stream connection closed, reconnect to server")
 			// call back not ready funcs
 			cc.fireOnNotReady()
+			if cc.isClosed() {
+				return
+			}
 			cc.conn.PollConn()
 		case <-cc.conn.ConnOnStates(connectivity.Shutdown, connectivity.TransientFailure):
 			alog.V(4).Infof("Connection shutdown or failure, reconnect to server")
 			// call back not ready funcs
 			cc.fireOnNotReady()
+			if cc.isClosed() {
+				return
+			}
 			cc.conn.PollConn()
 
 		}
 	}
 }
 
+// isClosed check if the tunnel closed by Close
+func (cc *cmdClient) isClosed() bool {
+	select {
+	case <-cc.closed:
+		return true
+	default:
+		return false
+	}
+}
+
+// keepAlive send heartbeat cmd to server every interval until ctx done, close the connection and
+// cancel ctx to reconnect if server is stale, as a half-open connection may look ready for hours
+func (cc *cmdClient) keepAlive(ctx context.Context, cancel context.CancelFunc) {
+	ticker := time.NewTicker(cc.cmdManager.heartbeats.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-cc.stopCh:
+			return
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		l := cc.cmdManager.heartbeat("", serverPeer)
+		if !l.Stale {
+			continue
+		}
+		alog.Warningf("Server is stale as missed %d heartbeats, last seen at %s, reconnect to server", l.Misses, l.LastSeen)
+		cc.cmdManager.heartbeats.remove(serverPeer)
+		if err := cc.conn.CloseConn(); err != nil {
+			alog.Errorf("Close stale connection failed: %v", err)
+		}
+		cancel()
+		return
+	}
+}
+
 // NewCmdReq build cmd for agent
 func (cc *cmdClient) NewCmdReq(name Name, args Args) *Req {
 	return cc.cmdManager.newCmdReq(name, args, "")
@@ -121,6 +194,16 @@ func (cc *cmdClient) SendAsync(cmd *Req, callback Callback) error {
 	return cc.cmdManager.SendAsync(cmd, callback)
 }
 
+// SendSyncContext send cmd sync until get result or ctx done
+func (cc *cmdClient) SendSyncContext(ctx context.Context, cmd *Req) (*Resp, error) {
+	return cc.cmdManager.SendSyncContext(ctx, cmd)
+}
+
+// SendAsyncContext send cmd async, cancel cmd when ctx done
+func (cc *cmdClient) SendAsyncContext(ctx context.Context, cmd *Req, callback Callback) error {
+	return cc.cmdManager.SendAsyncContext(ctx, cmd, callback)
+}
+
 // Name return the unique name of cmdClient
 func (cc *cmdClient) Name() string {
 	return cc.cmdManager.Name()
@@ -166,12 +249,14 @@ func (cc *cmdClient) respCmdSure(resp *pb.CmdPackage) error {
 	}
 }
 
-// genRegisterCmd build a special cmd to notify server ready to execute command
+// genRegisterCmd build a special cmd to notify server ready to execute command, the version and
+// cmds registered are sent as args, so cmds added after connected are advertised after reconnected
 func (cc *cmdClient) genRegisterCmd() *pb.CmdPackage {
 	return &pb.CmdPackage{
 		UUID:   uuid.NewUUID(),
 		Name:   string(Register),
 		Caller: cc.cmdManager.Name(),
+		Args:   capabilityArgs(cc.cmdManager.executor.names()),
 	}
 }
 
@@ -193,6 +278,7 @@ func (cc *cmdClient) fireOnReady() {
 			select {
 			case <-cc.stopCh:
 				return
+			default:
 			}
 		}
 	}()
@@ -205,6 +291,7 @@ func (cc *cmdClient) fireOnNotReady() {
 			select {
 			case <-cc.stopCh:
 				return
+			default:
 			}
 		}
 	}()
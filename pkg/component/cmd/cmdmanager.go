@@ -36,21 +36,39 @@ type cmdManager struct {
 	bufferLocks sync.Map
 	// callbacks cache all cmd callback funcs, key is uuid of cmd, map[string]Callback
 	callbacks sync.Map
+	// credits cache the flow control state of responses sending, key is uuid of cmd, map[string]*credits
+	credits sync.Map
+	// heartbeats record the liveness of peers measured by heartbeat cmds
+	heartbeats *heartbeater
+	// readings cache the stream responses reading by caller, key is uuid of cmd, map[string]*reading
+	readings sync.Map
 	// stopCh
 	stopCh <-chan struct{}
 }
 
-func newCmdManager(name string, sendCmd, respCmd func(c *pb.CmdPackage) error, stopCh <-chan struct{}) *cmdManager {
+func newCmdManager(name string, sendCmd, respCmd func(c *pb.CmdPackage) error, stopCh <-chan struct{}, opts ...Option) *cmdManager {
+	o := newOptions(opts...)
 	return &cmdManager{
-		executor: newExecutor(name),
-		sendCmd:  sendCmd,
-		respCmd:  respCmd,
-		stopCh:   stopCh,
+		executor:   newExecutor(name, o),
+		sendCmd:    sendCmd,
+		respCmd:    respCmd,
+		heartbeats: newHeartbeater(o.heartbeatInterval, o.heartbeatMaxMisses, siteOf),
+		stopCh:     stopCh,
 	}
 }
 
 // SendSync send cmd until get result, will block
 func (cm *cmdManager) SendSync(cmd *Req, timeoutSecond int) (*Resp, error) {
+	return cm.sendSync(context.Background(), cmd, time.Duration(timeoutSecond)*time.Second)
+}
+
+// SendSyncContext send cmd until get result or ctx done, will block, the remote handler will be
+// cancelled when ctx done, and the stream of response will be closed if ctx done after returned
+func (cm *cmdManager) SendSyncContext(ctx context.Context, cmd *Req) (*Resp, error) {
+	return cm.sendSync(ctx, cmd, 0)
+}
+
+func (cm *cmdManager) sendSync(ctx context.Context, cmd *Req, timeout time.Duration) (*Resp, error) {
 	// send cmd
 	c, err := genReqCmdPackage(cmd, cm.Name())
 	if err != nil {
@@ -60,11 +78,16 @@ func (cm *cmdManager) SendSync(cmd *Req, timeoutSecond int) (*Resp, error) {
 		return nil, err
 	}
 
-	return cm.waitForResp(c, timeoutSecond)
+	return cm.waitForResp(ctx, c, timeout)
 }
 
 // SendAsync send cmd async
 func (cm *cmdManager) SendAsync(cmd *Req, callback Callback) error {
+	return cm.SendAsyncContext(context.Background(), cmd, callback)
+}
+
+// SendAsyncContext send cmd async, the callback will not be called if ctx done before received response
+func (cm *cmdManager) SendAsyncContext(ctx context.Context, cmd *Req, callback Callback) error {
 	// send cmd
 	c, err := genReqCmdPackage(cmd, cm.Name())
 	if err != nil {
@@ -77,7 +100,12 @@ func (cm *cmdManager) SendAsync(cmd *Req, callback Callback) error {
 	cm.addCmdCallback(c.UUID, callback)
 
 	go func() {
-		resp, _ := cm.waitForResp(c, 0)
+		resp, err := cm.waitForResp(ctx, c, 0)
+		if err != nil {
+			alog.Warningf("Wait for cmd %s/%s response failed: %v", c.Name, c.UUID, err)
+			cm.callbacks.Delete(c.UUID)
+			return
+		}
 		if fn, ok := cm.callbacks.Load(c.UUID); ok && fn != nil {
 			fn.(Callback)(resp)
 			cm.callbacks.Delete(c.UUID)
@@ -87,69 +115,146 @@ func (cm *cmdManager) SendAsync(cmd *Req, callback Callback) error {
 	return nil
 }
 
-func (cm *cmdManager) waitForResp(c *pb.CmdPackage, timeout int) (*Resp, error) {
+// waitForResp wait for the response of cmd until ctx done or timeout if timeout > 0,
+// cancel cmd at executor if not received response
+func (cm *cmdManager) waitForResp(ctx context.Context, c *pb.CmdPackage, timeout time.Duration) (*Resp, error) {
 	cmdBuffer := make(chan *pb.CmdPackage, MaxBufferSize)
 	cm.respBuffers.Store(c.UUID, cmdBuffer)
 	cm.bufferLocks.Store(c.UUID, &sync.Mutex{})
 	notifyCh := make(chan *Resp)
 
 	// wait cmd result util timeout
-	var ctx context.Context
-	if timeout <= 0 {
-		ctx = context.Background()
-	} else {
-		ctx, _ = context.WithTimeout(context.Background(), time.Duration(timeout)*time.Second)
+	var timeoutCh <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		timeoutCh = timer.C
 	}
 
 	// wait for resp
 	go func() {
 		resp := &Resp{}
 		index := 0
+		var chunks *chunkReceiver
 		for cb := range cmdBuffer {
-			// init first resp instance
-			if index == 0 {
-				resp.Code = int(cb.RespCode)
-				resp.Msg = cb.RespMsg
-				if cb.Stream {
-					resp.stream = newStreamer()
-					resp.close = make(chan struct{})
-				} else {
-					resp.Data = string(cb.RespData)
+			// chunks are reordered by sequence, and resp is returned after the header chunk received
+			if cb.Chunked {
+				if chunks == nil {
+					chunks = newChunkReceiver(0)
 				}
+				for _, chunk := range chunks.push(cb) {
+					if chunk.Seq == 0 {
+						resp.Code = int(chunk.RespCode)
+						resp.Msg = chunk.RespMsg
+						if err := verifyChunk(chunk); err != nil {
+							resp.Code, resp.Msg = FailCode, err.Error()
+						} else {
+							resp.Data = string(chunk.RespData)
+							resp.stream = newStreamer()
+							resp.chunked = true
+							resp.close = make(chan struct{})
+						}
+						select {
+						case notifyCh <- resp:
+						case <-ctx.Done():
+							return
+						}
+						if !resp.IsStream() {
+							cm.cancelCmd(c)
+							return
+						}
+						continue
+					}
+					if err := cm.receiveChunk(resp, chunk); err != nil {
+						alog.Errorf("Receive chunk of cmd %s/%s failed: %v", c.Name, c.UUID, err)
+						closeChunks(resp, err)
+						if !chunk.EOF {
+							cm.cancelCmd(c)
+						}
+						return
+					}
+				}
+				continue
+			}
 
-				// return to user immediately
-				notifyCh <- resp
+			// stream packages with sequence are reordered, and credits are granted when consumed
+			packages := []*pb.CmdPackage{cb}
+			if cb.Seq > 0 {
+				if chunks == nil {
+					chunks = newChunkReceiver(1)
+				}
+				packages = chunks.push(cb)
 			}
+			for _, p := range packages {
+				// init first resp instance
+				if index == 0 {
+					resp.Code = int(p.RespCode)
+					resp.Msg = p.RespMsg
+					if p.Stream {
+						resp.stream = newStreamer()
+						resp.close = make(chan struct{})
+					} else {
+						resp.Data = string(p.RespData)
+					}
+
+					// return to user immediately
+					select {
+					case notifyCh <- resp:
+					case <-ctx.Done():
+						return
+					}
+				}
 
-			if cb.Stream {
-				// if is stream resp write data to stream
-				if _, err := resp.Write(cb.RespData); err != nil {
-					alog.Errorf("Write data to resp stream failed: %v", err)
-					return
+				if p.Stream {
+					// if is stream resp write data to stream, block until consumed
+					if _, err := resp.Write(p.RespData); err != nil {
+						alog.Errorf("Write data to resp stream failed: %v", err)
+						return
+					}
+					if p.Seq > 0 && p.Seq%(StreamWindow/2) == 0 {
+						cm.grantCredits(p, p.Seq)
+					}
 				}
+				index++
 			}
-			index++
 		}
 	}()
+
 	select {
 	case result := <-notifyCh:
 		if !result.IsStream() {
 			// if is not stream resp close buffer to stop received
 			cm.safeCloseBuffer(c)
 		} else {
-			// close cmd stream when call resp.Close()
+			// close cmd stream when call resp.Close() or ctx done
+			r := &reading{resp: result, done: make(chan struct{})}
+			cm.readings.Store(c.UUID, r)
 			go func() {
+				defer func() {
+					cm.readings.Delete(c.UUID)
+					close(r.done)
+				}()
 				select {
 				case <-result.close:
-					cm.safeCloseBuffer(c)
-					cm.closeCmdStream(c)
+				case <-ctx.Done():
+					alog.Infof("Context of cmd %s/%s done, close the stream: %v", c.Name, c.UUID, ctx.Err())
+					if err := result.Close(); err != nil {
+						alog.Warningf("Close stream of cmd %s/%s failed: %v", c.Name, c.UUID, err)
+					}
 				}
+				cm.safeCloseBuffer(c)
+				cm.closeCmdStream(c)
 			}()
 		}
 		return result, nil
-	case <-ctx.Done():
+	case <-timeoutCh:
 		cm.safeCloseBuffer(c)
+		cm.cancelCmd(c)
 		return nil, fmt.Errorf("execute cmd %s timeout", c.Name)
+	case <-ctx.Done():
+		cm.safeCloseBuffer(c)
+		cm.cancelCmd(c)
+		return nil, fmt.Errorf("execute cmd %s canceled: %v", c.Name, ctx.Err())
 	}
 
 }
@@ -242,6 +347,16 @@ func (cm *cmdManager) onReceive(recv func() (*pb.CmdPackage, error)) (*pb.CmdPac
 		go func() {
 			cm.processResp(recvCmd)
 		}()
+	case pb.CmdPackage_CANCEL:
+		// cancel the running cmd which caller is not waiting for
+		alog.V(4).Infof("[CmdCancel]: %v", recvCmd)
+		go func() {
+			cm.processCancel(recvCmd)
+		}()
+	case pb.CmdPackage_ACK:
+		// acknowledge the chunks received by caller
+		alog.V(4).Infof("[CmdAck]: %s/%s %d", recvCmd.Name, recvCmd.UUID, recvCmd.Seq)
+		cm.processAck(recvCmd)
 	default:
 		alog.Errorf("unknown cmd Type %s", recvCmd.Type)
 		return recvCmd, nil
@@ -249,13 +364,30 @@ func (cm *cmdManager) onReceive(recv func() (*pb.CmdPackage, error)) (*pb.CmdPac
 	return recvCmd, nil
 }
 
-// processReq process REQUEST cmd, exec the requested cmd and send response package to client
+// processReq process REQUEST cmd, exec the requested cmd and send response package to client,
+// a duplicated cmd with uuid executed recently is not executed again but replied the cached response
+// 0. if is a chunked response and caller accepts, send the stream as sequenced chunks
 // 1. if is not a stream response,  send the data to client
 // 2. if is a stream response, read stream into buffer, and send buffer data to client when collected
-// MaxReadLinesNum lines or wait for MaxProcessWaitTime seconds
+// MaxReadLinesNum lines or wait for MaxProcessWaitTime seconds, if caller granted a window, the packages
+// are sent with sequence and paused until caller consumed them
 func (cm *cmdManager) processReq(cmd *pb.CmdPackage) (err error) {
+	if Name(cmd.Name) == CloseStream {
+		// wake up the stream waiting for credits, as caller will never consume it
+		cm.abortCredits(cmd.UUID)
+	}
+	if resp, ok := cm.executor.replay(cmd); ok {
+		// never exec a duplicated cmd again, reply the response of the first execution
+		alog.Infof("Replay response of duplicated cmd %s/%s from %s", cmd.Name, cmd.UUID, cmd.Caller)
+		cmd.Type = pb.CmdPackage_RESPONSE
+		cmd.Chunked, cmd.Window = false, 0
+		cmd.RespCode, cmd.RespMsg, cmd.RespData = uint32(resp.Code), resp.Msg, []byte(resp.Data)
+		return cm.respCmd(cmd)
+	}
 	resp, onComplete := cm.executor.exec(cmd)
 	defer func() {
+		// release context of the cmd when response finished
+		cm.executor.finish(cmd, resp)
 		// callback send resp result
 		if onComplete != nil {
 			onComplete(err)
@@ -264,23 +396,65 @@ func (cm *cmdManager) processReq(cmd *pb.CmdPackage) (err error) {
 	if resp == nil {
 		return fmt.Errorf("exec resp is nil")
 	}
+	if !resp.IsStream() && cm.executor.cancelled(cmd) {
+		// caller is not waiting for it, and may retry the cmd with the same uuid
+		alog.Infof("Skipped response of cmd %s/%s cancelled by caller %s", cmd.Name, cmd.UUID, cmd.Caller)
+		return nil
+	}
 
+	acceptChunked, window := cmd.Chunked, uint64(cmd.Window)
+	cmd.Chunked, cmd.Window = false, 0
 	cmd.RespCode = uint32(resp.Code)
 	cmd.RespMsg = resp.Msg
 	cmd.Stream = resp.IsStream()
+	// 0. send a chunked response if caller accepts, or fallback to stream lines
+	if resp.IsChunked() {
+		// the readers of chunked response are never closed by caller, release them once sent or failed
+		defer func() {
+			if closeErr := resp.Close(); closeErr != nil {
+				alog.Warningf("Close chunked stream of cmd %s/%s failed: %v", cmd.Name, cmd.UUID, closeErr)
+			}
+		}()
+		if acceptChunked {
+			return cm.sendChunks(cmd, resp)
+		}
+		alog.Warningf("Caller %s of cmd %s/%s not accepts chunks, send as stream lines", cmd.Caller, cmd.Name, cmd.UUID)
+	}
 	// 1. send a none-stream cmd response
 	if !cmd.Stream {
 		cmd.RespData = []byte(resp.Data)
 		return cm.respCmd(cmd)
 	}
 
-	// 2. send reader cmd response data
+	// 2. send reader cmd response data, pause when the credits granted by caller run out
+	var flow *credits
+	if window > 0 {
+		flow = cm.newCredits(cmd.UUID, window, resp.creditTimeout)
+		defer cm.credits.Delete(cmd.UUID)
+	}
+	defer func() {
+		// release the handler writing the stream if caller will not consume it
+		if err != nil {
+			if closeErr := resp.Close(); closeErr != nil {
+				alog.Warningf("Close stream of cmd %s/%s failed: %v", cmd.Name, cmd.UUID, closeErr)
+			}
+		}
+	}()
+	done := make(chan struct{})
+	defer close(done)
+
 	lines := make([]string, 0, MaxReadLinesNum)
 	buffer := make(chan string, MaxBufferSize)
 	reader := bufio.NewReader(resp)
 	timer := time.NewTimer(MaxProcessWaitTime)
 	send := func(lines *[]string) error {
 		if len(*lines) > 0 {
+			if flow != nil {
+				if err := flow.wait(cmd.Seq+1, cm.stopCh); err != nil {
+					return fmt.Errorf("resp cmd %s/%s stream data failed: %v", cmd.Name, cmd.UUID, err)
+				}
+				cmd.Seq++
+			}
 			cmd.RespData = []byte(strings.Join(*lines, ""))
 			if err := cm.respCmd(cmd); err != nil {
 				alog.Errorf("resp cmd %s/%s stream data failed: %v", cmd.Name, cmd.UUID, err)
@@ -299,7 +473,11 @@ func (cm *cmdManager) processReq(cmd *pb.CmdPackage) (err error) {
 			if len(line) > 0 {
 				// write line to buffer channel, will block when buffer is full
 				alog.Infof("[%s] | %s", cmd.Name, line)
-				buffer <- string(line)
+				select {
+				case buffer <- string(line):
+				case <-done:
+					return
+				}
 			}
 			if err == io.EOF || err != nil {
 				// close buffer to finished send stream data
@@ -341,6 +519,32 @@ func (cm *cmdManager) processResp(respPKG *pb.CmdPackage) {
 	cm.safeWriteBuffer(respPKG)
 }
 
+// processCancel process CANCEL cmd, cancel the running cmd at executor
+func (cm *cmdManager) processCancel(cmd *pb.CmdPackage) {
+	cm.abortCredits(cmd.UUID)
+	if !cm.executor.cancel(cmd.UUID) {
+		alog.V(4).Infof("Cmd %s/%s to cancel is not running", cmd.Name, cmd.UUID)
+		return
+	}
+	alog.Infof("Cancelled cmd %s/%s by caller %s", cmd.Name, cmd.UUID, cmd.Caller)
+}
+
+// cancelCmd send cancel cmd to executor, the executor will cancel the context of the running handler
+func (cm *cmdManager) cancelCmd(cmd *pb.CmdPackage) {
+	req := &pb.CmdPackage{
+		UUID:     cmd.UUID,
+		Name:     cmd.Name,
+		Type:     pb.CmdPackage_CANCEL,
+		Caller:   cmd.Caller,
+		Executor: cmd.Executor,
+	}
+	if err := cm.sendCmd(req); err != nil {
+		alog.Warningf("Send cancel cmd %s/%s failed: %v", cmd.Name, cmd.UUID, err)
+		return
+	}
+	alog.V(4).Infof("Send cancel cmd %s/%s succeed", cmd.Name, cmd.UUID)
+}
+
 // closeCmdStream send close cmd
 func (cm *cmdManager) closeCmdStream(cmd *pb.CmdPackage) {
 	req := &pb.CmdPackage{
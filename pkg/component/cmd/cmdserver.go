@@ -3,22 +3,42 @@ package cmd
 import (
 	"context"
 	"fmt"
+	"io"
+	"strings"
+	"time"
 
 	pb "code.xxxxx.cn/platform/galaxy/pkg/component/cmd/v1"
 	"code.xxxxx.cn/platform/galaxy/pkg/component/conns"
 	"code.xxxxx.cn/platform/galaxy/pkg/util/alog"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 type cmdServer struct {
 	cmdManager  *cmdManager
 	connManager *conns.ConnManager
+	// minProtocolVersion is the min protocol version of executors allowed to register
+	minProtocolVersion int
+	// identityAuthorizer check the certificate identities of executors, nil allows all
+	identityAuthorizer IdentityAuthorizer
 }
 
-// NewCmdServer build a Server instance
-func NewCmdServer(stopCh <-chan struct{}) Server {
+// NewCmdServer build a Server instance, opts such as WithInterceptors configure the executor
+func NewCmdServer(stopCh <-chan struct{}, opts ...Option) Server {
 	cs := &cmdServer{}
-	cs.cmdManager = newCmdManager("CmdServer", cs.reqCmd, cs.respCmd, stopCh)
+	cs.cmdManager = newCmdManager("CmdServer", cs.reqCmd, cs.respCmd, stopCh, opts...)
 	cs.connManager = conns.NewConnManager()
+	o := newOptions(opts...)
+	cs.minProtocolVersion = o.minProtocolVersion
+	cs.identityAuthorizer = o.identityAuthorizer
+	cs.connManager.OnNotReady(func(conn *conns.Conn) {
+		if conn != nil && conn.Key != "" {
+			cs.cmdManager.heartbeats.remove(conn.Key)
+		}
+	})
+	if cs.cmdManager.heartbeats.interval > 0 {
+		go cs.keepAlive(stopCh)
+	}
 	return cs
 }
 
@@ -29,24 +49,42 @@ func (cs *cmdServer) NewCmdReq(name Name, args Args, executor string) *Req {
 
 // Execute impl grpc service, manager send command to device agent，and receive response
 func (cs *cmdServer) Execute(stream pb.CmdManager_ExecuteServer) error {
-	ctx := stream.Context()
-	for {
-		select {
-		case <-ctx.Done():
-			alog.Infof("Received terminated signal")
-			return stream.Context().Err()
-		default:
+	// the stream is closed once ctx cancelled, by the agent or by ConnManager.Disconnect
+	ctx, cancel := context.WithCancel(stream.Context())
+	defer cancel()
+
+	// packages not sent by the executor registered on the connection are dropped
+	verifiedRecv := func() (*pb.CmdPackage, error) {
+		for {
+			recv, err := stream.Recv()
+			if err != nil || cs.fromExecutor(stream.Context(), recv) {
+				return recv, err
+			}
 		}
+	}
 
-		// Listen to receive cmd
-		recv, err := cs.cmdManager.onReceive(stream.Recv)
-		if err != nil {
-			alog.Errorf("Server receive msg from agent failed: %v", err)
-			continue
+	go func() {
+		defer cancel()
+		for {
+			// Listen to receive cmd
+			recv, err := cs.cmdManager.onReceive(verifiedRecv)
+			if err != nil {
+				if err != io.EOF && stream.Context().Err() == nil {
+					alog.Errorf("Server receive msg from agent failed: %v", err)
+				}
+				return
+			}
+			// register executor when receive register cmd
+			cs.handleRegisterIfNeed(ctx, cancel, recv, stream)
 		}
-		// register executor when receive register cmd
-		cs.handleRegisterIfNeed(ctx, recv, stream)
+	}()
+
+	<-ctx.Done()
+	alog.Infof("Received terminated signal")
+	if err := stream.Context().Err(); err != nil {
+		return err
 	}
+	return status.Error(codes.Aborted, "stream closed by server")
 }
 
 // SendSync send cmd until get result, will block
@@ -59,6 +97,16 @@ func (cs *cmdServer) SendAsync(cmd *Req, callback Callback) error {
 	return cs.cmdManager.SendAsync(cmd, callback)
 }
 
+// SendSyncContext send cmd until get result or ctx done, will block
+func (cs *cmdServer) SendSyncContext(ctx context.Context, cmd *Req) (*Resp, error) {
+	return cs.cmdManager.SendSyncContext(ctx, cmd)
+}
+
+// SendAsyncContext send cmd async, cancel cmd when ctx done
+func (cs *cmdServer) SendAsyncContext(ctx context.Context, cmd *Req, callback Callback) error {
+	return cs.cmdManager.SendAsyncContext(ctx, cmd, callback)
+}
+
 // AddCmdHandler add handler func to a cmd
 func (cs *cmdServer) AddCmdHandler(name Name, handler Handler) {
 	cs.cmdManager.AddCmdHandler(name, handler)
@@ -74,6 +122,64 @@ func (cs *cmdServer) GetConnManager() *conns.ConnManager {
 	return cs.connManager
 }
 
+// Capabilities return the version and supported cmds of executor negotiated when registered
+func (cs *cmdServer) Capabilities(executor string) (*Capabilities, error) {
+	info, err := cs.connManager.GetConnInfo(executor)
+	if err != nil {
+		return nil, err
+	}
+	return parseCapabilities(info)
+}
+
+// Supports check if executor is connected and supports cmd name
+func (cs *cmdServer) Supports(executor string, name Name) bool {
+	c, err := cs.Capabilities(executor)
+	if err != nil {
+		alog.V(4).Infof("Get capabilities of executor %q failed: %v", executor, err)
+		return false
+	}
+	return c.Supports(name)
+}
+
+// Liveness return the liveness of executor measured by heartbeat cmds
+func (cs *cmdServer) Liveness(executor string) (*Liveness, error) {
+	l, ok := cs.cmdManager.heartbeats.get(executor)
+	if !ok {
+		return nil, fmt.Errorf("no heartbeat exchanged with executor %q", executor)
+	}
+	return &l, nil
+}
+
+// OnHeartbeat add callback func called after every heartbeat sent to executor
+func (cs *cmdServer) OnHeartbeat(fn func(executor string, l Liveness)) {
+	cs.cmdManager.heartbeats.addCallback(fn)
+}
+
+// keepAlive send heartbeat cmd to all registered executors every interval until stopCh closed
+func (cs *cmdServer) keepAlive(stopCh <-chan struct{}) {
+	ticker := time.NewTicker(cs.cmdManager.heartbeats.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C:
+		}
+		for _, conn := range cs.connManager.ListConns(nil) {
+			go func(executor string) {
+				if l := cs.cmdManager.heartbeat(executor, executor); l.Stale {
+					// the connection may be half-open, close the stream so the executor registers again
+					alog.Warningf("Executor %s is stale as missed %d heartbeats, last seen at %s, disconnect it",
+						executor, l.Misses, l.LastSeen)
+					if err := cs.connManager.Disconnect(executor); err != nil {
+						alog.Errorf("Disconnect stale executor %s failed: %v", executor, err)
+					}
+				}
+			}(conn.Key)
+		}
+	}
+}
+
 // reqCmd request cmd to executor at client
 func (cs *cmdServer) reqCmd(c *pb.CmdPackage) error {
 	executor, err := cs.connManager.GetConnValue(c.Executor)
@@ -99,8 +205,27 @@ func (cs *cmdServer) respCmd(c *pb.CmdPackage) error {
 	return fmt.Errorf("retry 3 times response cmd to agent %s failed: %v", c.Caller, err)
 }
 
+// fromExecutor check if the package is sent by the executor registered on the connection of ctx, which is
+// the caller of requests and the executor of responses, as executor sends every package by a new stream
+// of the connection, only register cmd is allowed before registered and it never registers as another one
+func (cs *cmdServer) fromExecutor(ctx context.Context, recv *pb.CmdPackage) bool {
+	var key string
+	if conn, err := cs.connManager.GetConnFromContext(ctx); err == nil && conn != nil {
+		key = conn.Key
+	}
+	peer := recv.Caller
+	if recv.Type == pb.CmdPackage_RESPONSE {
+		peer = recv.Executor
+	}
+	if peer == key || (key == "" && recv.Name == string(Register)) {
+		return true
+	}
+	alog.Warningf("Dropped cmd %s/%s from %q on the connection registered by %q", recv.Name, recv.UUID, peer, key)
+	return false
+}
+
 // handleRegisterIfNeed handler register connection of client
-func (cs *cmdServer) handleRegisterIfNeed(ctx context.Context, recv *pb.CmdPackage, stream pb.CmdManager_ExecuteServer) {
+func (cs *cmdServer) handleRegisterIfNeed(ctx context.Context, cancel context.CancelFunc, recv *pb.CmdPackage, stream pb.CmdManager_ExecuteServer) {
 	if recv.Name != string(Register) {
 		return
 	}
@@ -112,12 +237,26 @@ func (cs *cmdServer) handleRegisterIfNeed(ctx context.Context, recv *pb.CmdPacka
 		Executor: recv.Executor,
 	}
 	// register executor when receive register cmd
-	if err := cs.connManager.SaveConn(ctx, recv.Caller, recv.Args, stream); err != nil {
+	info, err := cs.checkIdentity(ctx, recv)
+	if err == nil {
+		err = cs.checkCompatible(recv)
+	}
+	if err != nil {
+		// the connection is not saved, response to the stream directly
+		alog.Errorf("Refused agent connection %s: %v", recv.Caller, err)
+		registerResp.RespCode = FailCode
+		registerResp.RespMsg = err.Error()
+		if err := stream.Send(registerResp); err != nil {
+			alog.Warningf("Response refused register cmd failed: %v", err)
+		}
+		return
+	}
+	if err := cs.connManager.SaveConnWithCancel(ctx, recv.Caller, info, stream, cancel); err != nil {
 		alog.Errorf("Register agent connection %s failed: %v", recv.Caller, err)
 		registerResp.RespCode = FailCode
 		registerResp.RespMsg = FailMsg
 	} else {
-		alog.V(4).Infof("Registered agent connection %q, info: %v", recv.Caller, recv.Args)
+		alog.V(4).Infof("Registered agent connection %q, info: %v", recv.Caller, info)
 		registerResp.RespCode = SuccessCode
 		registerResp.RespMsg = SuccessMsg
 	}
@@ -128,3 +267,35 @@ func (cs *cmdServer) handleRegisterIfNeed(ctx context.Context, recv *pb.CmdPacka
 	}
 	alog.V(4).Info("Response register cmd succeed")
 }
+
+// checkIdentity check if the executor is allowed to register as caller by its certificate identities,
+// return the info to save with identities recorded, the identity sent by executor is never trusted
+func (cs *cmdServer) checkIdentity(ctx context.Context, recv *pb.CmdPackage) (map[string]string, error) {
+	identities := PeerIdentities(ctx)
+	if cs.identityAuthorizer != nil {
+		if err := cs.identityAuthorizer(identities, recv.Caller); err != nil {
+			return nil, err
+		}
+	}
+	info := make(map[string]string, len(recv.Args)+1)
+	for k, v := range recv.Args {
+		info[k] = v
+	}
+	delete(info, InfoIdentity)
+	if len(identities) > 0 {
+		info[InfoIdentity] = strings.Join(identities, ",")
+	}
+	return info, nil
+}
+
+// checkCompatible check if the executor registering is compatible with server
+func (cs *cmdServer) checkCompatible(recv *pb.CmdPackage) error {
+	c, err := parseCapabilities(recv.Args)
+	if err != nil {
+		return err
+	}
+	if c.ProtocolVersion < cs.minProtocolVersion {
+		return fmt.Errorf("protocol version %d of executor %s is less than %d", c.ProtocolVersion, recv.Caller, cs.minProtocolVersion)
+	}
+	return nil
+}
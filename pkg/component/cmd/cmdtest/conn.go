@@ -0,0 +1,153 @@
+package cmdtest
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+
+	pb "code.xxxxx.cn/platform/galaxy/pkg/component/cmd/v1"
+	"code.xxxxx.cn/platform/galaxy/pkg/component/conns"
+	"code.xxxxx.cn/platform/galaxy/pkg/util/alog"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+const defaultDialTimeout = 5 * time.Second
+
+// bufConn implements conns.GlobalConn, it dials the in-memory bufconn listener instead of a tcp address
+type bufConn struct {
+	lis     *bufconn.Listener
+	lock    sync.RWMutex
+	conn    *grpc.ClientConn
+	readyCh chan struct{}
+}
+
+var _ conns.GlobalConn = &bufConn{}
+
+func newBufConn(lis *bufconn.Listener) *bufConn {
+	return &bufConn{
+		lis:     lis,
+		readyCh: make(chan struct{}),
+	}
+}
+
+// PollConn dial the listener once if current connection is not active, unlike the real
+// connection it never loops, so the client stops reconnecting after the harness closed
+func (c *bufConn) PollConn() {
+	if c.IsActive() {
+		return
+	}
+	if err := c.CloseConn(); err != nil {
+		alog.Errorf("Close bufconn connection failed: %v", err)
+	}
+	conn, err := c.dial()
+	if err != nil {
+		alog.Errorf("Connect to bufconn failed: %v", err)
+		return
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.conn = conn
+	close(c.readyCh)
+}
+
+func (c *bufConn) GetConn() *grpc.ClientConn {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.conn
+}
+
+func (c *bufConn) ReConn(cli *conns.ClientConfig) error {
+	conn, err := c.dial()
+	if err != nil {
+		return err
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.conn = conn
+	return nil
+}
+
+func (c *bufConn) CloseConn() error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.readyCh = make(chan struct{})
+	if c.conn == nil {
+		return nil
+	}
+	return c.conn.Close()
+}
+
+func (c *bufConn) IsActive() bool {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.conn != nil && c.conn.GetState() == connectivity.Ready
+}
+
+// ConnMonitor do nothing as there is only one listener
+func (c *bufConn) ConnMonitor(stopCh <-chan struct{}) {}
+
+// RegisterMonitorConn do nothing as there is only one listener
+func (c *bufConn) RegisterMonitorConn(addr, certFile, serverName string) error {
+	return nil
+}
+
+// AddClientQueue do nothing as there is only one listener
+func (c *bufConn) AddClientQueue(addr, certFile, serverName string) error {
+	return nil
+}
+
+// WatchDiscovery do nothing as there is only one listener
+func (c *bufConn) WatchDiscovery(d conns.Discovery, period time.Duration, stopCh <-chan struct{}) {}
+
+func (c *bufConn) ConnOnStates(stats ...connectivity.State) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		conn := c.GetConn()
+		if conn == nil {
+			return
+		}
+		for {
+			state := conn.GetState()
+			for _, s := range stats {
+				if state == s {
+					return
+				}
+			}
+			if !conn.WaitForStateChange(context.Background(), state) {
+				return
+			}
+		}
+	}()
+	return done
+}
+
+func (c *bufConn) ConnOnReady() <-chan struct{} {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.readyCh
+}
+
+func (c *bufConn) GetCmdManagerClient() pb.CmdManagerClient {
+	return pb.NewCmdManagerClient(c.GetConn())
+}
+
+func (c *bufConn) GetCmdManagerClientExecuteStream() (pb.CmdManager_ExecuteClient, error) {
+	return c.GetCmdManagerClient().Execute(context.Background())
+}
+
+func (c *bufConn) dial() (*grpc.ClientConn, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultDialTimeout)
+	defer cancel()
+	return grpc.DialContext(ctx, "bufnet",
+		grpc.WithBlock(),
+		grpc.WithInsecure(),
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) {
+			return c.lis.Dial()
+		}),
+	)
+}
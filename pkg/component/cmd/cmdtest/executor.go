@@ -0,0 +1,63 @@
+package cmdtest
+
+import (
+	"sync"
+
+	"code.xxxxx.cn/platform/galaxy/pkg/component/cmd"
+)
+
+// FakeHandler is a cmd handler records every request it received and replies by the reply func
+type FakeHandler struct {
+	lock  sync.Mutex
+	reqs  []*cmd.Req
+	reply func(req *cmd.Req) *cmd.Resp
+	// received is sent a request when handler called, never blocks
+	received chan *cmd.Req
+}
+
+// NewFakeHandler build a FakeHandler replies by reply func, reply nil means always succeed with empty data
+func NewFakeHandler(reply func(req *cmd.Req) *cmd.Resp) *FakeHandler {
+	if reply == nil {
+		reply = func(req *cmd.Req) *cmd.Resp {
+			return cmd.RespSucceed("")
+		}
+	}
+	return &FakeHandler{
+		reply:    reply,
+		received: make(chan *cmd.Req, cmd.MaxBufferSize),
+	}
+}
+
+// Reply build a FakeHandler always replies resp, the resp should not be a stream as it is shared by all requests
+func Reply(resp *cmd.Resp) *FakeHandler {
+	return NewFakeHandler(func(req *cmd.Req) *cmd.Resp {
+		return &cmd.Resp{Code: resp.Code, Msg: resp.Msg, Data: resp.Data}
+	})
+}
+
+// Handle implements cmd.Handler
+func (f *FakeHandler) Handle(req *cmd.Req) (*cmd.Resp, cmd.OnComplete) {
+	f.lock.Lock()
+	f.reqs = append(f.reqs, req)
+	f.lock.Unlock()
+
+	select {
+	case f.received <- req:
+	default:
+	}
+	return f.reply(req), nil
+}
+
+// Reqs return all requests received
+func (f *FakeHandler) Reqs() []*cmd.Req {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	reqs := make([]*cmd.Req, len(f.reqs))
+	copy(reqs, f.reqs)
+	return reqs
+}
+
+// Received return the channel receives every request handled
+func (f *FakeHandler) Received() <-chan *cmd.Req {
+	return f.received
+}
@@ -0,0 +1,220 @@
+// Package cmdtest provides an in-process loopback transport to test code built on cmd.Server and cmd.Client,
+// the server and clients are connected over an in-memory bufconn listener, no tcp port or tls cert is needed
+package cmdtest
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"code.xxxxx.cn/platform/galaxy/pkg/component/cmd"
+	pb "code.xxxxx.cn/platform/galaxy/pkg/component/cmd/v1"
+	"code.xxxxx.cn/platform/galaxy/pkg/util/alog"
+	"code.xxxxx.cn/platform/galaxy/pkg/util/uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+const (
+	// DefaultClientName is the name of the client created by New
+	DefaultClientName = "cmdtest-client"
+	// DefaultTimeout is the max time to wait for client registered or packages sent
+	DefaultTimeout = 5 * time.Second
+
+	bufSize = 1024 * 1024
+)
+
+// Harness hold a cmd.Server and cmd.Clients connected over an in-memory listener
+type Harness struct {
+	// Server is the cmd server all clients connected to
+	Server cmd.Server
+	// Client is the default client named DefaultClientName
+	Client cmd.Client
+
+	t          testing.TB
+	lis        *bufconn.Listener
+	grpcServer *grpc.Server
+	link       *link
+	opts       []cmd.Option
+	lock       sync.Mutex
+	clients    map[string]*bufConn
+	stopCh     chan struct{}
+	stopOnce   sync.Once
+}
+
+// New start a Harness with a server and a default client, opts configure both the server and clients,
+// call Close to release it when test finished
+func New(t testing.TB, opts ...cmd.Option) *Harness {
+	h := &Harness{
+		t:       t,
+		lis:     bufconn.Listen(bufSize),
+		link:    newLink(),
+		opts:    opts,
+		clients: make(map[string]*bufConn),
+		stopCh:  make(chan struct{}),
+	}
+	h.Server = cmd.NewCmdServer(h.stopCh, opts...)
+	h.grpcServer = grpc.NewServer(
+		grpc.StatsHandler(h.Server.GetConnManager()),
+		grpc.StreamInterceptor(h.link.streamInterceptor),
+	)
+	pb.RegisterCmdManagerServer(h.grpcServer, h.Server)
+	go func() {
+		if err := h.grpcServer.Serve(h.lis); err != nil {
+			alog.Errorf("Serve bufconn listener failed: %v", err)
+		}
+	}()
+
+	h.Client = h.AddClient(DefaultClientName)
+	return h
+}
+
+// AddClient connect a new client named name to server, it returns after the client registered,
+// the name must be unique as the connections of server are shared in process
+func (h *Harness) AddClient(name string) cmd.Client {
+	return h.AddExecutor(name, nil)
+}
+
+// AddExecutor add a fake executor as a new client, all handlers are registered to it before connected,
+// so they are advertised to server as capabilities, returns the client to send cmds back to server
+func (h *Harness) AddExecutor(name string, handlers map[cmd.Name]*FakeHandler) cmd.Client {
+	h.lock.Lock()
+	if _, ok := h.clients[name]; ok {
+		h.lock.Unlock()
+		h.t.Fatalf("client %q already added", name)
+	}
+	conn := newBufConn(h.lis)
+	h.clients[name] = conn
+	h.lock.Unlock()
+
+	conn.PollConn()
+	client := cmd.NewCmdClient(name, conn, h.stopCh, h.opts...)
+	for n, handler := range handlers {
+		client.AddCmdHandler(n, handler.Handle)
+	}
+	afterSendRegisterCmd := make(chan struct{})
+	go client.StartListen(afterSendRegisterCmd)
+	// drain the channel as client sends to it every time reconnected
+	go func() {
+		for {
+			select {
+			case <-h.stopCh:
+				return
+			case <-afterSendRegisterCmd:
+			}
+		}
+	}()
+
+	if err := h.waitForRegistered(name, DefaultTimeout); err != nil {
+		h.t.Fatalf("add client %q failed: %v", name, err)
+	}
+	return client
+}
+
+// NewClientName return a unique client name with prefix
+func NewClientName(prefix string) string {
+	return prefix + "-" + uuid.NewUUID()
+}
+
+// SetLatency delay every package on the link for d, zero means no latency
+func (h *Harness) SetLatency(d time.Duration) {
+	h.link.lock.Lock()
+	defer h.link.lock.Unlock()
+	h.link.latency = d
+}
+
+// Drop drop all packages matched by filter, the dropped packages are still recorded
+func (h *Harness) Drop(filter Filter) {
+	if filter == nil {
+		filter = func(*Package) bool { return true }
+	}
+	h.link.lock.Lock()
+	defer h.link.lock.Unlock()
+	h.link.drops = append(h.link.drops, filter)
+}
+
+// ResetDrops stop dropping any packages
+func (h *Harness) ResetDrops() {
+	h.link.lock.Lock()
+	defer h.link.lock.Unlock()
+	h.link.drops = nil
+}
+
+// Packages return all recorded packages matched by filter in order, filter nil means all
+func (h *Harness) Packages(filter Filter) []*Package {
+	h.link.lock.Lock()
+	defer h.link.lock.Unlock()
+	var list []*Package
+	for _, pkg := range h.link.packages {
+		if filter == nil || filter(pkg) {
+			list = append(list, pkg)
+		}
+	}
+	return list
+}
+
+// WaitForPackage wait until a package matched by filter recorded, return the first one matched
+func (h *Harness) WaitForPackage(filter Filter, timeout time.Duration) (*Package, error) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		h.link.lock.Lock()
+		notify := h.link.notify
+		h.link.lock.Unlock()
+
+		if list := h.Packages(filter); len(list) > 0 {
+			return list[0], nil
+		}
+		select {
+		case <-notify:
+		case <-timer.C:
+			return nil, fmt.Errorf("no package matched in %s", timeout)
+		}
+	}
+}
+
+// ExpectPackage fail the test if no package matched by filter recorded in DefaultTimeout
+func (h *Harness) ExpectPackage(filter Filter) *Package {
+	h.t.Helper()
+	pkg, err := h.WaitForPackage(filter, DefaultTimeout)
+	if err != nil {
+		h.t.Fatalf("expect package failed: %v", err)
+	}
+	return pkg
+}
+
+// ExpectNoPackage fail the test if any package matched by filter recorded
+func (h *Harness) ExpectNoPackage(filter Filter) {
+	h.t.Helper()
+	if list := h.Packages(filter); len(list) > 0 {
+		h.t.Fatalf("expect no package, but got %d, first: %v", len(list), list[0])
+	}
+}
+
+// Close stop the server and all clients
+func (h *Harness) Close() {
+	h.stopOnce.Do(func() {
+		close(h.stopCh)
+		h.lock.Lock()
+		for name, conn := range h.clients {
+			if err := conn.CloseConn(); err != nil {
+				alog.Warningf("Close connection of client %q failed: %v", name, err)
+			}
+		}
+		h.lock.Unlock()
+		h.grpcServer.Stop()
+	})
+}
+
+// waitForRegistered wait until server saved the connection of client
+func (h *Harness) waitForRegistered(name string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if _, err := h.Server.GetConnManager().GetConnValue(name); err == nil {
+			return nil
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return fmt.Errorf("client %q not registered in %s", name, timeout)
+}
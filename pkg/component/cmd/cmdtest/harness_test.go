@@ -0,0 +1,617 @@
+package cmdtest
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"code.xxxxx.cn/platform/galaxy/pkg/component/cmd"
+	pb "code.xxxxx.cn/platform/galaxy/pkg/component/cmd/v1"
+)
+
+func TestServerSendToClient(t *testing.T) {
+	h := New(t)
+	defer h.Close()
+
+	handler := Reply(cmd.RespSucceed("pong"))
+	h.Client.AddCmdHandler("ping", handler.Handle)
+
+	resp, err := h.Server.SendSync(h.Server.NewCmdReq("ping", cmd.Args{"k": "v"}, DefaultClientName), 5)
+	if err != nil {
+		t.Fatalf("send ping failed: %v", err)
+	}
+	if resp.Code != cmd.SuccessCode || resp.Data != "pong" {
+		t.Errorf("unexpected resp: code=%d data=%q", resp.Code, resp.Data)
+	}
+	if reqs := handler.Reqs(); len(reqs) != 1 || reqs[0].Args.Get("k") != "v" {
+		t.Errorf("unexpected reqs: %v", reqs)
+	}
+
+	req := h.ExpectPackage(And(ByName("ping"), ByDirection(ToClient), ByType(pb.CmdPackage_REQUEST)))
+	if req.Executor != DefaultClientName {
+		t.Errorf("unexpected executor %q", req.Executor)
+	}
+	h.ExpectPackage(And(ByName("ping"), ByDirection(ToServer), ByType(pb.CmdPackage_RESPONSE)))
+}
+
+func TestClientSendToServer(t *testing.T) {
+	h := New(t)
+	defer h.Close()
+
+	h.Server.AddCmdHandler("hello", NewFakeHandler(func(req *cmd.Req) *cmd.Resp {
+		return cmd.RespSucceed("hello " + req.Caller)
+	}).Handle)
+
+	resp, err := h.Client.SendSync(h.Client.NewCmdReq("hello", nil), 5)
+	if err != nil {
+		t.Fatalf("send hello failed: %v", err)
+	}
+	if resp.Data != "hello "+DefaultClientName {
+		t.Errorf("unexpected resp data %q", resp.Data)
+	}
+}
+
+func TestAddExecutor(t *testing.T) {
+	h := New(t)
+	defer h.Close()
+
+	name := NewClientName("executor")
+	handler := Reply(cmd.RespError(context.Canceled))
+	h.AddExecutor(name, map[cmd.Name]*FakeHandler{"fail": handler})
+
+	resp, err := h.Server.SendSync(h.Server.NewCmdReq("fail", nil, name), 5)
+	if err != nil {
+		t.Fatalf("send fail failed: %v", err)
+	}
+	if resp.Code != cmd.FailCode || resp.Msg != context.Canceled.Error() {
+		t.Errorf("unexpected resp: code=%d msg=%q", resp.Code, resp.Msg)
+	}
+	select {
+	case req := <-handler.Received():
+		if req.Caller != h.Server.Name() {
+			t.Errorf("unexpected caller %q", req.Caller)
+		}
+	default:
+		t.Errorf("handler not received request")
+	}
+}
+
+func TestDropAndLatency(t *testing.T) {
+	h := New(t)
+	defer h.Close()
+
+	handler := Reply(cmd.RespSucceed(""))
+	h.Client.AddCmdHandler("ping", handler.Handle)
+
+	h.Drop(And(ByName("ping"), ByType(pb.CmdPackage_REQUEST)))
+	if _, err := h.Server.SendSync(h.Server.NewCmdReq("ping", nil, DefaultClientName), 1); err == nil {
+		t.Fatalf("expect timeout as request dropped")
+	}
+	if len(handler.Reqs()) != 0 {
+		t.Errorf("handler should not be called")
+	}
+	h.ExpectPackage(And(ByName("ping"), ByType(pb.CmdPackage_CANCEL)))
+	h.ExpectNoPackage(And(ByName("ping"), ByType(pb.CmdPackage_RESPONSE)))
+
+	h.ResetDrops()
+	h.SetLatency(100 * time.Millisecond)
+	start := time.Now()
+	if _, err := h.Server.SendSync(h.Server.NewCmdReq("ping", nil, DefaultClientName), 5); err != nil {
+		t.Fatalf("send ping failed: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond {
+		t.Errorf("expect latency of request and response, but elapsed %s", elapsed)
+	}
+}
+
+func TestTypedPayload(t *testing.T) {
+	h := New(t)
+	defer h.Close()
+
+	received := make(chan *pb.AppCancelPayload, 1)
+	h.Server.AddCmdHandler(cmd.AppCancelHandler, cmd.HandleAppCancel(func(req *cmd.Req, p *pb.AppCancelPayload) (*cmd.Resp, cmd.OnComplete) {
+		received <- p
+		return cmd.RespSucceed(""), nil
+	}))
+
+	req := h.Client.NewCmdReq(cmd.AppCancelHandler, nil)
+	if err := cmd.SetAppCancelPayload(req, &pb.AppCancelPayload{Site: "site1", App: "app1"}); err != nil {
+		t.Fatalf("set payload failed: %v", err)
+	}
+	if _, err := h.Client.SendSync(req, 5); err != nil {
+		t.Fatalf("send appcancel failed: %v", err)
+	}
+	if p := <-received; p.Site != "site1" || p.App != "app1" {
+		t.Errorf("unexpected payload %v", p)
+	}
+
+	pkg := h.ExpectPackage(And(ByName(cmd.AppCancelHandler), ByType(pb.CmdPackage_REQUEST)))
+	if pkg.TypeURL == "" || pkg.Args["app"] != "app1" {
+		t.Errorf("expect both payload and legacy args sent, got %v", pkg.CmdPackage)
+	}
+}
+
+func TestCapabilities(t *testing.T) {
+	h := New(t)
+	defer h.Close()
+
+	name := NewClientName("executor")
+	h.AddExecutor(name, map[cmd.Name]*FakeHandler{"ping": Reply(cmd.RespSucceed(""))})
+
+	c, err := h.Server.Capabilities(name)
+	if err != nil {
+		t.Fatalf("get capabilities failed: %v", err)
+	}
+	if c.Legacy() || c.ProtocolVersion != cmd.ProtocolVersion || c.Version == "" {
+		t.Errorf("unexpected capabilities %+v", c)
+	}
+	if !h.Server.Supports(name, "ping") || !h.Server.Supports(name, cmd.CloseStream) {
+		t.Errorf("expect executor supports registered cmds, got %v", c.Cmds)
+	}
+	if h.Server.Supports(name, "pong") {
+		t.Errorf("expect executor not supports cmd pong")
+	}
+	if h.Server.Supports("not-connected", "ping") {
+		t.Errorf("expect executor not connected supports nothing")
+	}
+}
+
+func TestChunkedResp(t *testing.T) {
+	h := New(t)
+	defer h.Close()
+
+	data := make([]byte, 3*cmd.ChunkWindow*cmd.ChunkSize+100)
+	rand.Read(data)
+	h.Client.AddCmdHandler("download", NewFakeHandler(func(req *cmd.Req) *cmd.Resp {
+		if !req.AcceptChunked {
+			return cmd.RespFailed()
+		}
+		return cmd.RespChunked("meta", ioutil.NopCloser(bytes.NewReader(data)))
+	}).Handle)
+
+	resp, err := h.Server.SendSync(h.Server.NewCmdReq("download", nil, DefaultClientName), 5)
+	if err != nil {
+		t.Fatalf("send download failed: %v", err)
+	}
+	defer resp.Close()
+	if resp.Code != cmd.SuccessCode || resp.Data != "meta" || !resp.IsStream() {
+		t.Fatalf("unexpected resp: code=%d msg=%q data=%q", resp.Code, resp.Msg, resp.Data)
+	}
+	got, err := ioutil.ReadAll(resp)
+	if err != nil {
+		t.Fatalf("read chunks failed: %v", err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Errorf("expect %d bytes received, got %d", len(data), len(got))
+	}
+	if acks := h.Packages(And(ByName("download"), ByType(pb.CmdPackage_ACK))); len(acks) == 0 {
+		t.Errorf("expect chunks acknowledged by caller")
+	}
+}
+
+// closeRecorder is a reader records if it is closed
+type closeRecorder struct {
+	io.Reader
+	once   sync.Once
+	closed chan struct{}
+}
+
+func newCloseRecorder(data []byte) *closeRecorder {
+	return &closeRecorder{Reader: bytes.NewReader(data), closed: make(chan struct{})}
+}
+
+func (r *closeRecorder) Close() error {
+	r.once.Do(func() { close(r.closed) })
+	return nil
+}
+
+func TestChunkedRespClosed(t *testing.T) {
+	h := New(t)
+	defer h.Close()
+
+	readers := make(chan *closeRecorder, 2)
+	data := make([]byte, 2*cmd.ChunkWindow*cmd.ChunkSize)
+	h.Client.AddCmdHandler("download", NewFakeHandler(func(req *cmd.Req) *cmd.Resp {
+		reader := newCloseRecorder(data)
+		readers <- reader
+		return cmd.RespChunked("meta", reader)
+	}).Handle)
+	expectClosed := func(reader *closeRecorder) {
+		t.Helper()
+		select {
+		case <-reader.closed:
+		case <-time.After(DefaultTimeout):
+			t.Fatalf("expect reader of chunked response closed")
+		}
+	}
+
+	// the reader is closed once all chunks sent
+	resp, err := h.Server.SendSync(h.Server.NewCmdReq("download", nil, DefaultClientName), 5)
+	if err != nil {
+		t.Fatalf("send download failed: %v", err)
+	}
+	if got, err := ioutil.ReadAll(resp); err != nil || len(got) != len(data) {
+		t.Fatalf("expect %d bytes received, got %d: %v", len(data), len(got), err)
+	}
+	resp.Close()
+	expectClosed(<-readers)
+
+	// the reader is closed when caller cancelled before any chunk received
+	h.Drop(And(ByName("download"), ByDirection(ToServer)))
+	if _, err := h.Server.SendSync(h.Server.NewCmdReq("download", nil, DefaultClientName), 1); err == nil {
+		t.Fatalf("expect download timeout")
+	}
+	h.ExpectPackage(And(ByName("download"), ByType(pb.CmdPackage_CANCEL)))
+	expectClosed(<-readers)
+}
+
+func TestStreamBackpressure(t *testing.T) {
+	h := New(t)
+	defer h.Close()
+
+	var lines []string
+	for i := 0; i < 3*cmd.StreamWindow*cmd.MaxReadLinesNum; i++ {
+		lines = append(lines, fmt.Sprintf("line %d\n", i))
+	}
+	h.Client.AddCmdHandler("tail", NewFakeHandler(func(req *cmd.Req) *cmd.Resp {
+		return cmd.RespStream(ioutil.NopCloser(strings.NewReader(strings.Join(lines, ""))))
+	}).Handle)
+	h.Client.AddCmdHandler("ping", Reply(cmd.RespSucceed("pong")).Handle)
+
+	resp, err := h.Server.SendSync(h.Server.NewCmdReq("tail", nil, DefaultClientName), 5)
+	if err != nil {
+		t.Fatalf("send tail failed: %v", err)
+	}
+	defer resp.Close()
+
+	// the executor pauses after sent a window of packages as nothing consumed
+	h.ExpectPackage(func(pkg *Package) bool {
+		return pkg.Name == "tail" && pkg.Seq == cmd.StreamWindow
+	})
+	time.Sleep(200 * time.Millisecond)
+	h.ExpectNoPackage(func(pkg *Package) bool {
+		return pkg.Name == "tail" && pkg.Seq > cmd.StreamWindow
+	})
+
+	// other cmds on the same tunnel are not stalled by the slow stream
+	if _, err := h.Server.SendSync(h.Server.NewCmdReq("ping", nil, DefaultClientName), 5); err != nil {
+		t.Fatalf("send ping failed: %v", err)
+	}
+
+	// stream lines have no end, read until all lines received
+	expect := strings.Join(lines, "")
+	got := make([]byte, len(expect))
+	if _, err := io.ReadFull(resp, got); err != nil {
+		t.Fatalf("read stream failed: %v", err)
+	}
+	if string(got) != expect {
+		t.Errorf("expect lines received in order")
+	}
+	h.ExpectPackage(And(ByName("tail"), ByType(pb.CmdPackage_ACK)))
+}
+
+func TestDuplicatedReq(t *testing.T) {
+	h := New(t)
+	defer h.Close()
+
+	count := 0
+	handler := NewFakeHandler(func(req *cmd.Req) *cmd.Resp {
+		count++
+		return cmd.RespSucceed(fmt.Sprintf("executed %d", count))
+	})
+	h.Client.AddCmdHandler("once", handler.Handle)
+
+	req := h.Server.NewCmdReq("once", nil, DefaultClientName)
+	for i := 0; i < 2; i++ {
+		resp, err := h.Server.SendSync(req, 5)
+		if err != nil {
+			t.Fatalf("send once failed: %v", err)
+		}
+		if resp.Data != "executed 1" {
+			t.Errorf("expect response of first execution replayed, got %q", resp.Data)
+		}
+	}
+	if reqs := handler.Reqs(); len(reqs) != 1 {
+		t.Errorf("expect handler executed once, got %d", len(reqs))
+	}
+
+	if resp, err := h.Server.SendSync(h.Server.NewCmdReq("once", nil, DefaultClientName), 5); err != nil || resp.Data != "executed 2" {
+		t.Errorf("expect new cmd executed again, got %v, %v", resp, err)
+	}
+}
+
+func TestCancelPropagated(t *testing.T) {
+	h := New(t)
+	defer h.Close()
+
+	done := make(chan error, 1)
+	handler := NewFakeHandler(func(req *cmd.Req) *cmd.Resp {
+		select {
+		case <-req.Context().Done():
+			done <- req.Context().Err()
+		case <-time.After(DefaultTimeout):
+			done <- nil
+		}
+		return cmd.RespError(fmt.Errorf("cancelled"))
+	})
+	h.Client.AddCmdHandler("block", handler.Handle)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	sent := make(chan error, 1)
+	go func() {
+		_, err := h.Server.SendSyncContext(ctx, h.Server.NewCmdReq("block", nil, DefaultClientName))
+		sent <- err
+	}()
+	select {
+	case <-handler.Received():
+	case <-time.After(DefaultTimeout):
+		t.Fatalf("expect block cmd received")
+	}
+	cancel()
+
+	if err := <-sent; err == nil {
+		t.Errorf("expect send block failed as cancelled")
+	}
+	h.ExpectPackage(And(ByName("block"), ByDirection(ToClient), ByType(pb.CmdPackage_CANCEL)))
+	if err := <-done; err != context.Canceled {
+		t.Errorf("expect handler observed cancel, got %v", err)
+	}
+}
+
+func TestCancelledReqRetried(t *testing.T) {
+	h := New(t)
+	defer h.Close()
+
+	count := 0
+	failed := make(chan struct{})
+	handler := NewFakeHandler(func(req *cmd.Req) *cmd.Resp {
+		count++
+		if count == 1 {
+			// the first execution is cancelled as caller timeout
+			defer close(failed)
+			<-req.Context().Done()
+			return cmd.RespError(req.Context().Err())
+		}
+		return cmd.RespSucceed(fmt.Sprintf("executed %d", count))
+	})
+	h.Client.AddCmdHandler("slow", handler.Handle)
+
+	req := h.Server.NewCmdReq("slow", nil, DefaultClientName)
+	if _, err := h.Server.SendSync(req, 1); err == nil {
+		t.Fatalf("expect slow timeout")
+	}
+	h.ExpectPackage(And(ByName("slow"), ByType(pb.CmdPackage_CANCEL)))
+	<-failed
+
+	// retry with the same uuid executes again instead of replaying the cancelled failure
+	if resp, err := retry(h, req); err != nil || resp.Data != "executed 2" {
+		t.Fatalf("expect cancelled cmd executed again, got %+v, %v", resp, err)
+	}
+	// and the response succeed is replayed
+	if resp, err := h.Server.SendSync(req, 5); err != nil || resp.Data != "executed 2" {
+		t.Errorf("expect response succeed replayed, got %+v, %v", resp, err)
+	}
+}
+
+func TestTimeoutReqReplayed(t *testing.T) {
+	h := New(t)
+	defer h.Close()
+
+	release := make(chan struct{})
+	handler := NewFakeHandler(func(req *cmd.Req) *cmd.Resp {
+		// the handler ignores cancel and succeeds after caller timeout
+		<-release
+		return cmd.RespSucceed("done")
+	})
+	h.Client.AddCmdHandler("slow", handler.Handle)
+
+	req := h.Server.NewCmdReq("slow", nil, DefaultClientName)
+	if _, err := h.Server.SendSync(req, 1); err == nil {
+		t.Fatalf("expect slow timeout")
+	}
+	h.ExpectPackage(And(ByName("slow"), ByType(pb.CmdPackage_CANCEL)))
+
+	// the retry never waits for the first execution
+	if resp, err := h.Server.SendSync(req, 5); err != nil || resp.Code != cmd.ExecutingCode {
+		t.Fatalf("expect cmd still executing, got %+v, %v", resp, err)
+	}
+	close(release)
+
+	// the response succeed after cancelled is replayed
+	if resp, err := retry(h, req); err != nil || resp.Data != "done" {
+		t.Fatalf("expect response succeed replayed, got %+v, %v", resp, err)
+	}
+	if reqs := handler.Reqs(); len(reqs) != 1 {
+		t.Errorf("expect handler executed once, got %d", len(reqs))
+	}
+}
+
+// retry send req until it is not executing
+func retry(h *Harness, req *cmd.Req) (*cmd.Resp, error) {
+	deadline := time.Now().Add(DefaultTimeout)
+	for {
+		resp, err := h.Server.SendSync(req, 5)
+		if err != nil || resp.Code != cmd.ExecutingCode || time.Now().After(deadline) {
+			return resp, err
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestBroadcast(t *testing.T) {
+	h := New(t)
+	defer h.Close()
+
+	group := NewClientName("group")
+	succeed := Reply(cmd.RespSucceed("done"))
+	executors := map[string]*FakeHandler{
+		NewClientName("succeed"): succeed,
+		NewClientName("succeed"): succeed,
+		NewClientName("failed"):  Reply(cmd.RespFailed()),
+		NewClientName("timeout"): NewFakeHandler(func(req *cmd.Req) *cmd.Resp {
+			<-req.Context().Done()
+			return cmd.RespError(req.Context().Err())
+		}),
+	}
+	for name, handler := range executors {
+		h.AddExecutor(name, map[cmd.Name]*FakeHandler{"fanout": handler})
+		if err := h.Server.GetConnManager().UpdateConnInfo(name, map[string]string{"group": group}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the executor out of group is never sent
+	other := NewFakeHandler(nil)
+	h.AddExecutor(NewClientName("other"), map[cmd.Name]*FakeHandler{"fanout": other})
+
+	result, err := h.Server.SendBroadcast(h.Server.NewCmdReq("fanout", nil, ""), cmd.LabelSelector{"group": group},
+		&cmd.BroadcastOptions{Parallelism: 2, Timeout: 500 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("broadcast fanout failed: %v", err)
+	}
+	if result.Total() != 4 || len(result.Succeeded) != 2 || len(result.Failed) != 1 || len(result.TimedOut) != 1 {
+		t.Fatalf("expect 2 succeeded, 1 failed and 1 timed out, got %d, %d, %d",
+			len(result.Succeeded), len(result.Failed), len(result.TimedOut))
+	}
+	for _, r := range result.Succeeded {
+		if r.Err != nil || r.Resp.Data != "done" || executors[r.Executor] != succeed {
+			t.Errorf("unexpected succeeded result of %s: %+v", r.Executor, r)
+		}
+	}
+	if r := result.Failed[0]; r.Err == nil || r.Resp == nil || !strings.HasPrefix(r.Executor, "failed-") {
+		t.Errorf("unexpected failed result of %s: %+v", r.Executor, r)
+	}
+	if r := result.TimedOut[0]; r.Err == nil || r.Resp != nil || !strings.HasPrefix(r.Executor, "timeout-") {
+		t.Errorf("unexpected timed out result of %s: %+v", r.Executor, r)
+	}
+	if reqs := succeed.Reqs(); len(reqs) != 2 || reqs[0].UUID == reqs[1].UUID {
+		t.Errorf("expect every executor sent a new uuid, got %d reqs", len(reqs))
+	}
+	if reqs := other.Reqs(); len(reqs) != 0 {
+		t.Errorf("expect executor out of group not sent, got %d reqs", len(reqs))
+	}
+}
+
+func TestHeartbeat(t *testing.T) {
+	h := New(t, cmd.WithHeartbeat(50*time.Millisecond, 2))
+	defer h.Close()
+
+	beats := make(chan cmd.Liveness, 100)
+	h.Server.OnHeartbeat(func(executor string, l cmd.Liveness) {
+		if executor == DefaultClientName {
+			select {
+			case beats <- l:
+			default:
+			}
+		}
+	})
+
+	// heartbeats are exchanged in both directions
+	h.ExpectPackage(And(ByName(cmd.Heartbeat), ByDirection(ToClient), ByType(pb.CmdPackage_REQUEST)))
+	h.ExpectPackage(And(ByName(cmd.Heartbeat), ByDirection(ToServer), ByType(pb.CmdPackage_REQUEST)))
+	if l := <-beats; l.Stale || l.RTT <= 0 || l.LastSeen.IsZero() {
+		t.Errorf("unexpected liveness %+v", l)
+	}
+	if _, err := h.Server.Liveness(DefaultClientName); err != nil {
+		t.Errorf("get liveness failed: %v", err)
+	}
+
+	// executor looks connected but never replies heartbeats
+	registered := len(h.Packages(And(ByName(cmd.Register), ByDirection(ToServer))))
+	h.Drop(And(ByName(cmd.Heartbeat), ByDirection(ToClient), ByType(pb.CmdPackage_REQUEST)))
+	timeout := time.After(DefaultTimeout)
+	for {
+		select {
+		case l := <-beats:
+			if !l.Stale {
+				continue
+			}
+			if l.Misses < 2 {
+				t.Errorf("expect stale after 2 misses, got %+v", l)
+			}
+		case <-timeout:
+			t.Fatalf("expect executor marked stale")
+		}
+		break
+	}
+
+	// the stale executor is disconnected and registers again
+	for len(h.Packages(And(ByName(cmd.Register), ByDirection(ToServer)))) == registered {
+		select {
+		case <-timeout:
+			t.Fatalf("expect stale executor registered again")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+func TestClientClose(t *testing.T) {
+	h := New(t)
+	defer h.Close()
+
+	release := make(chan struct{})
+	slow := NewFakeHandler(func(req *cmd.Req) *cmd.Resp {
+		<-release
+		return cmd.RespSucceed("done")
+	})
+	h.Client.AddCmdHandler("slow", slow.Handle)
+	pr, pw := io.Pipe()
+	defer pw.Close()
+	h.Server.AddCmdHandler("tail", NewFakeHandler(func(req *cmd.Req) *cmd.Resp {
+		go pw.Write([]byte("line\n"))
+		return cmd.RespStream(pr)
+	}).Handle)
+
+	// client is reading a stream from server and executing a cmd of server
+	stream, err := h.Client.SendSync(h.Client.NewCmdReq("tail", nil), 5)
+	if err != nil {
+		t.Fatalf("send tail failed: %v", err)
+	}
+	resps := make(chan *cmd.Resp, 1)
+	if err := h.Server.SendAsync(h.Server.NewCmdReq("slow", nil, DefaultClientName), func(resp *cmd.Resp) {
+		resps <- resp
+	}); err != nil {
+		t.Fatalf("send slow failed: %v", err)
+	}
+	<-slow.Received()
+
+	closed := make(chan error, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), DefaultTimeout)
+		defer cancel()
+		closed <- h.Client.Close(ctx)
+	}()
+	select {
+	case err := <-closed:
+		t.Fatalf("expect close blocked by cmd executing, got %v", err)
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	// the cmd executing is drained, and the stream reading is closed before the tunnel closed
+	close(release)
+	if err := <-closed; err != nil {
+		t.Errorf("close client failed: %v", err)
+	}
+	if resp := <-resps; resp.Data != "done" {
+		t.Errorf("expect cmd executing finished, got %+v", resp)
+	}
+	if _, err := stream.Read(make([]byte, 1)); err == nil {
+		t.Errorf("expect stream reading closed")
+	}
+	h.ExpectPackage(And(ByName(cmd.CloseStream), ByDirection(ToServer)))
+
+	// the tunnel is closed and never reconnected
+	if _, err := h.Server.SendSync(h.Server.NewCmdReq("slow", nil, DefaultClientName), 1); err == nil {
+		t.Errorf("expect tunnel closed")
+	}
+	time.Sleep(200 * time.Millisecond)
+	if regs := h.Packages(And(ByName(cmd.Register), ByDirection(ToServer))); len(regs) != 1 {
+		t.Errorf("expect client never reconnected, got %d registers", len(regs))
+	}
+}
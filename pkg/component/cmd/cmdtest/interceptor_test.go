@@ -0,0 +1,141 @@
+package cmdtest
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"code.xxxxx.cn/platform/galaxy/pkg/component/cmd"
+	pb "code.xxxxx.cn/platform/galaxy/pkg/component/cmd/v1"
+	"code.xxxxx.cn/platform/galaxy/pkg/util/alog"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// logWriter record all logs of the test package
+type logWriter struct {
+	lock sync.Mutex
+	buf  bytes.Buffer
+}
+
+func (w *logWriter) Write(p []byte) (int, error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	return w.buf.Write(p)
+}
+
+func (w *logWriter) String() string {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	return w.buf.String()
+}
+
+var logs = &logWriter{}
+
+func TestMain(m *testing.M) {
+	// redirect logs before any test started, flush to sync with the loggers
+	alog.SetOutput(logs)
+	alog.Flush()
+	os.Exit(m.Run())
+}
+
+func TestRecoveryInterceptor(t *testing.T) {
+	h := New(t, cmd.WithInterceptors(cmd.DefaultInterceptors()...))
+	defer h.Close()
+
+	name := cmd.Name(NewClientName("panic"))
+	h.Client.AddCmdHandler(name, NewFakeHandler(func(req *cmd.Req) *cmd.Resp {
+		panic("boom")
+	}).Handle)
+	ping := Reply(cmd.RespSucceed("pong"))
+	h.Client.AddCmdHandler("ping", ping.Handle)
+
+	resp, err := h.Server.SendSync(h.Server.NewCmdReq(name, nil, DefaultClientName), 5)
+	if err != nil {
+		t.Fatalf("send %s failed: %v", name, err)
+	}
+	if resp.Code == cmd.SuccessCode || !strings.Contains(resp.Msg, "boom") {
+		t.Errorf("expect panic responded as error, got code=%d msg=%q", resp.Code, resp.Msg)
+	}
+	if panics := testutil.ToFloat64(cmd.CmdPanics.WithLabelValues(string(name))); panics != 1 {
+		t.Errorf("expect 1 panic recorded, got %v", panics)
+	}
+
+	// the client keeps serving cmds after the panic
+	resp, err = h.Server.SendSync(h.Server.NewCmdReq("ping", nil, DefaultClientName), 5)
+	if err != nil || resp.Data != "pong" {
+		t.Errorf("expect ping succeed after panic, got resp=%v err=%v", resp, err)
+	}
+}
+
+func TestMetricsInterceptor(t *testing.T) {
+	h := New(t, cmd.WithInterceptors(cmd.DefaultInterceptors()...))
+	defer h.Close()
+
+	succeed, failed := cmd.Name(NewClientName("succeed")), cmd.Name(NewClientName("failed"))
+	h.Client.AddCmdHandler(succeed, NewFakeHandler(nil).Handle)
+	h.Client.AddCmdHandler(failed, Reply(cmd.RespFailed()).Handle)
+
+	for i := 0; i < 2; i++ {
+		if _, err := h.Server.SendSync(h.Server.NewCmdReq(succeed, nil, DefaultClientName), 5); err != nil {
+			t.Fatalf("send %s failed: %v", succeed, err)
+		}
+	}
+	if _, err := h.Server.SendSync(h.Server.NewCmdReq(failed, nil, DefaultClientName), 5); err != nil {
+		t.Fatalf("send %s failed: %v", failed, err)
+	}
+
+	if errs := testutil.ToFloat64(cmd.CmdErrors.WithLabelValues(string(succeed))); errs != 0 {
+		t.Errorf("expect no error of %s, got %v", succeed, errs)
+	}
+	if errs := testutil.ToFloat64(cmd.CmdErrors.WithLabelValues(string(failed))); errs != 1 {
+		t.Errorf("expect 1 error of %s, got %v", failed, errs)
+	}
+	// the latency is observed after the response sent
+	deadline := time.Now().Add(DefaultTimeout)
+	for handled(t, succeed) != 2 || handled(t, failed) != 1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("expect latency observed of every cmd, got %s=%d %s=%d",
+				succeed, handled(t, succeed), failed, handled(t, failed))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// handled return the number of latency observed of cmd name
+func handled(t *testing.T, name cmd.Name) uint64 {
+	m := &dto.Metric{}
+	if err := cmd.CmdHandleDuration.WithLabelValues(string(name)).(prometheus.Histogram).Write(m); err != nil {
+		t.Fatalf("read latency of %s failed: %v", name, err)
+	}
+	return m.GetHistogram().GetSampleCount()
+}
+
+func TestLoggingInterceptor(t *testing.T) {
+	h := New(t, cmd.WithInterceptors(cmd.DefaultInterceptors()...), cmd.WithHeartbeat(20*time.Millisecond, 3))
+	defer h.Close()
+
+	name := cmd.Name(NewClientName("logging"))
+	h.Client.AddCmdHandler(name, Reply(cmd.RespSucceed("")).Handle)
+
+	req := h.Server.NewCmdReq(name, nil, DefaultClientName)
+	if _, err := h.Server.SendSync(req, 5); err != nil {
+		t.Fatalf("send %s failed: %v", name, err)
+	}
+	// the cmd is logged before its response sent
+	expect := `Cmd handled: name="` + string(name) + `" uuid=` + req.UUID + ` caller="` + req.Caller + `" executor="` +
+		DefaultClientName + `" code=200`
+	if !strings.Contains(logs.String(), expect) {
+		t.Errorf("expect cmd logged as %q", expect)
+	}
+
+	// heartbeats are never logged at info level
+	h.ExpectPackage(And(ByName(cmd.Heartbeat), ByDirection(ToServer), ByType(pb.CmdPackage_RESPONSE)))
+	if heartbeat := `Cmd handled: name="` + string(cmd.Heartbeat) + `"`; strings.Contains(logs.String(), heartbeat) {
+		t.Errorf("expect heartbeat not logged")
+	}
+}
@@ -0,0 +1,137 @@
+package cmdtest
+
+import (
+	"sync"
+	"time"
+
+	"code.xxxxx.cn/platform/galaxy/pkg/component/cmd"
+	pb "code.xxxxx.cn/platform/galaxy/pkg/component/cmd/v1"
+	"code.xxxxx.cn/platform/galaxy/pkg/util/alog"
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/grpc"
+)
+
+// Direction is the direction of a cmd package on the link between server and clients
+type Direction string
+
+const (
+	// ToServer is the direction of packages sent by clients to server
+	ToServer Direction = "ToServer"
+	// ToClient is the direction of packages sent by server to clients
+	ToClient Direction = "ToClient"
+)
+
+// Package is a cmd package recorded on the link
+type Package struct {
+	Direction Direction
+	*pb.CmdPackage
+}
+
+// Filter match the packages on the link, nil matches all
+type Filter func(pkg *Package) bool
+
+// ByName match packages with the cmd name
+func ByName(name cmd.Name) Filter {
+	return func(pkg *Package) bool {
+		return pkg.Name == string(name)
+	}
+}
+
+// ByType match packages with the package type
+func ByType(typ pb.CmdPackage_CmdType) Filter {
+	return func(pkg *Package) bool {
+		return pkg.Type == typ
+	}
+}
+
+// ByDirection match packages with the direction
+func ByDirection(dir Direction) Filter {
+	return func(pkg *Package) bool {
+		return pkg.Direction == dir
+	}
+}
+
+// And match packages matched by all filters
+func And(filters ...Filter) Filter {
+	return func(pkg *Package) bool {
+		for _, f := range filters {
+			if f != nil && !f(pkg) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// link intercept every cmd package between server and clients to record, delay or drop it
+type link struct {
+	lock     sync.Mutex
+	latency  time.Duration
+	drops    []Filter
+	packages []*Package
+	// notify is closed and renewed when a new package recorded
+	notify chan struct{}
+}
+
+func newLink() *link {
+	return &link{notify: make(chan struct{})}
+}
+
+// pass record the package and wait for latency, return false if the package should be dropped
+func (l *link) pass(dir Direction, c *pb.CmdPackage) bool {
+	pkg := &Package{Direction: dir, CmdPackage: proto.Clone(c).(*pb.CmdPackage)}
+
+	l.lock.Lock()
+	l.packages = append(l.packages, pkg)
+	close(l.notify)
+	l.notify = make(chan struct{})
+	latency := l.latency
+	drop := false
+	for _, f := range l.drops {
+		if f(pkg) {
+			drop = true
+			break
+		}
+	}
+	l.lock.Unlock()
+
+	if drop {
+		alog.V(4).Infof("Dropped cmd package %s %s/%s", dir, c.Name, c.UUID)
+		return false
+	}
+	if latency > 0 {
+		time.Sleep(latency)
+	}
+	return true
+}
+
+// streamInterceptor wrap the Execute stream of server to intercept packages of both directions
+func (l *link) streamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	return handler(srv, &linkStream{ServerStream: ss, link: l})
+}
+
+// linkStream is a grpc.ServerStream passing every cmd package through link
+type linkStream struct {
+	grpc.ServerStream
+	link *link
+}
+
+func (s *linkStream) SendMsg(m interface{}) error {
+	if c, ok := m.(*pb.CmdPackage); ok && !s.link.pass(ToClient, c) {
+		return nil
+	}
+	return s.ServerStream.SendMsg(m)
+}
+
+func (s *linkStream) RecvMsg(m interface{}) error {
+	for {
+		if err := s.ServerStream.RecvMsg(m); err != nil {
+			return err
+		}
+		c, ok := m.(*pb.CmdPackage)
+		if !ok || s.link.pass(ToServer, c) {
+			return nil
+		}
+		// receive next package if dropped
+	}
+}
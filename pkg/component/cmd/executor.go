@@ -1,7 +1,9 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
+	"sync"
 
 	pb "code.xxxxx.cn/platform/galaxy/pkg/component/cmd/v1"
 	"code.xxxxx.cn/platform/galaxy/pkg/util/alog"
@@ -10,21 +12,42 @@ import (
 type executor struct {
 	name        string
 	cmdHandlers map[Name]Handler
-	streams     map[string]*streamer
+	// interceptors wrap every handler when exec cmd
+	interceptors []Interceptor
+	// lock protect streams and cancels, they are accessed by every cmd goroutine
+	lock    sync.Mutex
+	streams map[string]*streamer
+	// cancels cache cancel func of all running cmds, key is uuid of cmd
+	cancels map[string]context.CancelFunc
+	// resps cache recent responses to execute every cmd at most once
+	resps *respCache
 }
 
-func newExecutor(name string) *executor {
+func newExecutor(name string, o *options) *executor {
 	exec := &executor{
-		name:        name,
-		cmdHandlers: make(map[Name]Handler),
-		streams:     make(map[string]*streamer),
+		name:         name,
+		cmdHandlers:  make(map[Name]Handler),
+		interceptors: o.interceptors,
+		streams:      make(map[string]*streamer),
+		cancels:      make(map[string]context.CancelFunc),
+		resps:        newRespCache(o.respCacheSize, o.respCacheTTL),
 	}
 	exec.addHandler(CloseStream, exec.closeSteamHandler)
+	exec.addHandler(Heartbeat, heartbeatHandler)
 	return exec
 }
 
-func (e *executor) exec(cmd *pb.CmdPackage) (*Resp, func(err error)) {
+func (e *executor) exec(cmd *pb.CmdPackage) (resp *Resp, onComplete func(err error)) {
 	cmd.Type = pb.CmdPackage_RESPONSE
+	ctx, cancel := context.WithCancel(context.Background())
+	if Name(cmd.Name) == CloseStream {
+		// close cmd shares the uuid of the stream cmd, never override the cancel func of it
+		defer cancel()
+	} else {
+		e.lock.Lock()
+		e.cancels[cmd.UUID] = cancel
+		e.lock.Unlock()
+	}
 
 	handler, ok := e.cmdHandlers[Name(cmd.Name)]
 	if !ok {
@@ -36,28 +59,130 @@ func (e *executor) exec(cmd *pb.CmdPackage) (*Resp, func(err error)) {
 		}, nil
 	}
 
-	resp, onComplete := handler(&Req{
+	resp, onComplete = chainInterceptors(e.interceptors, handler)(&Req{
 		UUID:     cmd.UUID,
 		Name:     Name(cmd.Name),
 		Args:     cmd.Args,
 		Caller:   cmd.Caller,
 		Executor: cmd.Executor,
+		Payload:  cmd.Payload,
+		TypeURL:  cmd.TypeURL,
+		// caller accepts chunked response if chunked set in request
+		AcceptChunked: cmd.Chunked,
+		ctx:           ctx,
 	})
-	if resp.IsStream() {
+	if resp != nil && resp.IsStream() {
 		// save cmd stream to close it when received CloseStream cmd
+		e.lock.Lock()
 		e.streams[cmd.UUID] = resp.stream
+		e.lock.Unlock()
 	}
 	return resp, onComplete
 }
 
+// replay check if cmd is duplicated, return the response of the first execution if it is,
+// response ExecutingCode if the first one is executing, and execute it again if the first one failed,
+// close and heartbeat cmds are never duplicated
+func (e *executor) replay(cmd *pb.CmdPackage) (*Resp, bool) {
+	if Name(cmd.Name) == CloseStream || Name(cmd.Name) == Heartbeat {
+		return nil, false
+	}
+	for {
+		cached, first := e.resps.begin(cmd.UUID)
+		if first {
+			return nil, false
+		}
+		select {
+		case <-cached.done:
+		default:
+			// never wait for it, a stream cmd may execute for a long time
+			return &Resp{Code: ExecutingCode, Msg: ExecutingMsg}, true
+		}
+		if !cached.dropped {
+			return cached.replay(cmd.UUID), true
+		}
+	}
+}
+
+// finish release the context and stream of cmd after its response sent, and cache the response if succeed
+// even if cancelled by caller, so the retry never executes it again, the cmd failed is executed again if retried
+func (e *executor) finish(cmd *pb.CmdPackage, resp *Resp) {
+	if Name(cmd.Name) == CloseStream {
+		return
+	}
+	e.lock.Lock()
+	cancel, running := e.cancels[cmd.UUID]
+	delete(e.cancels, cmd.UUID)
+	delete(e.streams, cmd.UUID)
+	e.lock.Unlock()
+
+	if running {
+		cancel()
+	}
+	if resp == nil || resp.Code != SuccessCode {
+		e.resps.drop(cmd.UUID)
+		return
+	}
+	e.resps.complete(cmd.UUID, resp)
+}
+
+// cancelled check if the cmd executing is cancelled by caller
+func (e *executor) cancelled(cmd *pb.CmdPackage) bool {
+	if Name(cmd.Name) == CloseStream {
+		return false
+	}
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	_, running := e.cancels[cmd.UUID]
+	return !running
+}
+
+// cancel cancel the context of running cmd and close its stream if has
+func (e *executor) cancel(uuid string) bool {
+	e.lock.Lock()
+	cancel, ok := e.cancels[uuid]
+	stream := e.streams[uuid]
+	delete(e.cancels, uuid)
+	delete(e.streams, uuid)
+	e.lock.Unlock()
+
+	if ok {
+		cancel()
+	}
+	if stream != nil {
+		if err := stream.close(); err != nil {
+			alog.Warningf("Close stream of cancelled cmd %s failed: %v", uuid, err)
+		}
+	}
+	return ok || stream != nil
+}
+
+// running return the uuids of cmds executing or sending responses
+func (e *executor) running() []string {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	uuids := make([]string, 0, len(e.cancels))
+	for uuid := range e.cancels {
+		uuids = append(uuids, uuid)
+	}
+	return uuids
+}
+
 func (e *executor) addHandler(name Name, handler Handler) {
 	e.cmdHandlers[name] = handler
 }
 
-func (e *executor) closeSteamHandler(req *Req) (*Resp, OnComplete) {
-	if stream, ok := e.streams[req.UUID]; ok {
-		stream.close()
+// names return names of all cmds registered
+func (e *executor) names() []Name {
+	names := make([]Name, 0, len(e.cmdHandlers))
+	for name := range e.cmdHandlers {
+		names = append(names, name)
 	}
+	return names
+}
+
+func (e *executor) closeSteamHandler(req *Req) (*Resp, OnComplete) {
+	e.cancel(req.UUID)
 	alog.Infof("Closed cmd stream succeed: %s", req.UUID)
 	return RespSucceed("ok"), nil
 }
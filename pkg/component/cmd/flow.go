@@ -0,0 +1,130 @@
+package cmd
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	pb "code.xxxxx.cn/platform/galaxy/pkg/component/cmd/v1"
+	"code.xxxxx.cn/platform/galaxy/pkg/util/alog"
+)
+
+const (
+	// StreamWindow max number of stream packages sent but not consumed by caller
+	StreamWindow = 32
+	// CreditTimeout default max time to wait for caller granting credits before abort the response,
+	// a stream response may set its own by Resp.WithCreditTimeout
+	CreditTimeout = 30 * time.Second
+)
+
+// credits is the flow control state of a response sending, the sender may send packages with
+// sequence not greater than acked+window, caller grants credits by ACK cmd when consumed packages
+type credits struct {
+	window uint64
+	// timeout is the max time to wait for credits, negative means wait until aborted
+	timeout time.Duration
+	lock    sync.Mutex
+	acked   uint64
+	notify  chan struct{}
+	// done is closed when caller cancelled the cmd or closed the stream
+	done     chan struct{}
+	doneOnce sync.Once
+}
+
+// newCredits build credits with window for cmd, it is deleted by caller after response sent,
+// timeout 0 means CreditTimeout
+func (cm *cmdManager) newCredits(uuid string, window uint64, timeout time.Duration) *credits {
+	if timeout == 0 {
+		timeout = CreditTimeout
+	}
+	c := &credits{
+		window:  window,
+		timeout: timeout,
+		notify:  make(chan struct{}, 1),
+		done:    make(chan struct{}),
+	}
+	cm.credits.Store(uuid, c)
+	return c
+}
+
+// grant update the sequence consumed by caller and wake up the sender
+func (c *credits) grant(seq uint64) {
+	c.lock.Lock()
+	if seq > c.acked {
+		c.acked = seq
+	}
+	c.lock.Unlock()
+
+	select {
+	case c.notify <- struct{}{}:
+	default:
+	}
+}
+
+// abort stop the sender waiting for credits
+func (c *credits) abort() {
+	c.doneOnce.Do(func() {
+		close(c.done)
+	})
+}
+
+// wait block until package seq is in the window, return error if caller not granted credits in timeout,
+// or the cmd cancelled or closed by caller
+func (c *credits) wait(seq uint64, stopCh <-chan struct{}) error {
+	var timeout <-chan time.Time
+	if c.timeout > 0 {
+		timer := time.NewTimer(c.timeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	for {
+		c.lock.Lock()
+		acked := c.acked
+		c.lock.Unlock()
+		if seq <= acked+c.window {
+			return nil
+		}
+
+		select {
+		case <-c.notify:
+		case <-timeout:
+			return fmt.Errorf("wait for credits of package %d timeout", seq)
+		case <-c.done:
+			return fmt.Errorf("cancelled by caller")
+		case <-stopCh:
+			return fmt.Errorf("stopped")
+		}
+	}
+}
+
+// processAck process ACK cmd, grant credits to the sender of response
+func (cm *cmdManager) processAck(cmd *pb.CmdPackage) {
+	c, ok := cm.credits.Load(cmd.UUID)
+	if !ok {
+		alog.V(4).Infof("Response of cmd %s/%s to ack is not sending", cmd.Name, cmd.UUID)
+		return
+	}
+	c.(*credits).grant(cmd.Seq)
+}
+
+// abortCredits stop the sender of response waiting for credits
+func (cm *cmdManager) abortCredits(uuid string) {
+	if c, ok := cm.credits.Load(uuid); ok {
+		c.(*credits).abort()
+	}
+}
+
+// grantCredits send ACK cmd to executor, acknowledge all packages until seq consumed
+func (cm *cmdManager) grantCredits(cmd *pb.CmdPackage, seq uint64) {
+	req := &pb.CmdPackage{
+		UUID:     cmd.UUID,
+		Name:     cmd.Name,
+		Type:     pb.CmdPackage_ACK,
+		Caller:   cmd.Caller,
+		Executor: cmd.Executor,
+		Seq:      seq,
+	}
+	if err := cm.sendCmd(req); err != nil {
+		alog.Warningf("Send ack of cmd %s/%s package %d failed: %v", cmd.Name, cmd.UUID, seq, err)
+	}
+}
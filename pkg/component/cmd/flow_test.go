@@ -0,0 +1,49 @@
+package cmd
+
+import (
+	"testing"
+	"time"
+
+	pb "code.xxxxx.cn/platform/galaxy/pkg/component/cmd/v1"
+)
+
+func TestCreditsWindow(t *testing.T) {
+	cm := &cmdManager{}
+	stopCh := make(chan struct{})
+
+	c := cm.newCredits("uuid", 2, 0)
+	if err := c.wait(2, stopCh); err != nil {
+		t.Fatalf("expect packages in window sent without credits: %v", err)
+	}
+	cm.abortCredits("uuid")
+	if err := c.wait(3, stopCh); err == nil {
+		t.Fatalf("expect wait aborted")
+	}
+
+	c = cm.newCredits("uuid", 2, 0)
+	cm.processAck(&pb.CmdPackage{UUID: "uuid", Seq: 1})
+	if err := c.wait(3, stopCh); err != nil {
+		t.Errorf("expect package in window after credits granted: %v", err)
+	}
+}
+
+func TestCreditsTimeout(t *testing.T) {
+	cm := &cmdManager{}
+	stopCh := make(chan struct{})
+
+	c := cm.newCredits("uuid", 1, 10*time.Millisecond)
+	if err := c.wait(2, stopCh); err == nil {
+		t.Fatalf("expect wait timeout")
+	}
+
+	// wait until the cmd closed by caller
+	c = cm.newCredits("uuid", 1, -1)
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		cm.abortCredits("uuid")
+	}()
+	start := time.Now()
+	if err := c.wait(2, stopCh); err == nil || time.Since(start) < 50*time.Millisecond {
+		t.Errorf("expect wait until aborted, got %v after %v", err, time.Since(start))
+	}
+}
@@ -0,0 +1,88 @@
+package cmd
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"code.xxxxx.cn/platform/galaxy/pkg/version"
+)
+
+// ProtocolVersion is the version of cmd protocol of this build, executors registered without
+// protocol version are legacy executors of version 0
+const ProtocolVersion = 1
+
+/* keys of register cmd args, saved in conns.Conn.Info of executor */
+const (
+	// InfoVersion is the build version of executor
+	InfoVersion = "version"
+	// InfoProtocolVersion is the cmd protocol version of executor
+	InfoProtocolVersion = "protocol_version"
+	// InfoCmds is the names of cmds supported by executor, separated by comma
+	InfoCmds = "cmds"
+)
+
+// Capabilities is the version and supported cmds of executor negotiated by register cmd
+type Capabilities struct {
+	// Version is the build version of executor
+	Version string
+	// ProtocolVersion is the cmd protocol version of executor, 0 means legacy executor
+	ProtocolVersion int
+	// Cmds is the names of cmds supported by executor, nil for legacy executor as it is unknown
+	Cmds []Name
+}
+
+// Legacy return true if the executor registered without capabilities
+func (c *Capabilities) Legacy() bool {
+	return c.ProtocolVersion == 0
+}
+
+// Supports check if the executor supports cmd name, legacy executors are assumed to support all cmds
+func (c *Capabilities) Supports(name Name) bool {
+	if c.Legacy() {
+		return true
+	}
+	for _, n := range c.Cmds {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// parseCapabilities parse capabilities from connection info of executor
+func parseCapabilities(info map[string]string) (*Capabilities, error) {
+	c := &Capabilities{Version: info[InfoVersion]}
+	if v, ok := info[InfoProtocolVersion]; ok && v != "" {
+		pv, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid protocol version %q: %v", v, err)
+		}
+		c.ProtocolVersion = pv
+	}
+	if c.Legacy() {
+		return c, nil
+	}
+	c.Cmds = []Name{}
+	for _, n := range strings.Split(info[InfoCmds], ",") {
+		if n != "" {
+			c.Cmds = append(c.Cmds, Name(n))
+		}
+	}
+	return c, nil
+}
+
+// capabilityArgs build args of register cmd to advertise the version and cmds of executor
+func capabilityArgs(names []Name) Args {
+	cmds := make([]string, 0, len(names))
+	for _, n := range names {
+		cmds = append(cmds, string(n))
+	}
+	sort.Strings(cmds)
+	return Args{
+		InfoVersion:         version.Get().GitVersion,
+		InfoProtocolVersion: strconv.Itoa(ProtocolVersion),
+		InfoCmds:            strings.Join(cmds, ","),
+	}
+}
@@ -0,0 +1,43 @@
+package cmd
+
+import (
+	"testing"
+
+	pb "code.xxxxx.cn/platform/galaxy/pkg/component/cmd/v1"
+)
+
+func TestParseCapabilities(t *testing.T) {
+	c, err := parseCapabilities(capabilityArgs([]Name{"b", "a"}))
+	if err != nil {
+		t.Fatalf("parse capabilities failed: %v", err)
+	}
+	if c.ProtocolVersion != ProtocolVersion || len(c.Cmds) != 2 || c.Cmds[0] != "a" {
+		t.Errorf("unexpected capabilities %+v", c)
+	}
+	if !c.Supports("a") || c.Supports("c") {
+		t.Errorf("unexpected supports of %v", c.Cmds)
+	}
+
+	// legacy executors register with info of app only
+	legacy, err := parseCapabilities(map[string]string{"appName": "app"})
+	if err != nil {
+		t.Fatalf("parse legacy capabilities failed: %v", err)
+	}
+	if !legacy.Legacy() || !legacy.Supports("c") {
+		t.Errorf("expect legacy executor supports all cmds, got %+v", legacy)
+	}
+
+	if _, err := parseCapabilities(map[string]string{InfoProtocolVersion: "x"}); err == nil {
+		t.Errorf("expect error of invalid protocol version")
+	}
+}
+
+func TestCheckCompatible(t *testing.T) {
+	cs := &cmdServer{minProtocolVersion: ProtocolVersion}
+	if err := cs.checkCompatible(&pb.CmdPackage{Caller: "new", Args: capabilityArgs(nil)}); err != nil {
+		t.Errorf("expect compatible executor, got %v", err)
+	}
+	if err := cs.checkCompatible(&pb.CmdPackage{Caller: "legacy"}); err == nil {
+		t.Errorf("expect legacy executor refused")
+	}
+}
@@ -0,0 +1,138 @@
+package cmd
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"code.xxxxx.cn/platform/galaxy/pkg/apis"
+	"code.xxxxx.cn/platform/galaxy/pkg/util/alog"
+)
+
+const (
+	// DefaultHeartbeatInterval recommended interval to send heartbeat cmd to peers, enable it by WithHeartbeat
+	DefaultHeartbeatInterval = 30 * time.Second
+	// DefaultHeartbeatMaxMisses default number of heartbeats missed in a row to mark peer stale
+	DefaultHeartbeatMaxMisses = 3
+)
+
+// Liveness is the liveness of a peer measured by heartbeat cmds
+type Liveness struct {
+	// RTT is the round-trip time of the last heartbeat replied
+	RTT time.Duration
+	// LastSeen is the time of the last heartbeat replied by peer
+	LastSeen time.Time
+	// Misses is the number of heartbeats missed in a row
+	Misses int
+	// Stale is true if peer missed max misses heartbeats, the connection may be half-open even if it looks ready
+	Stale bool
+}
+
+// heartbeater record the liveness of peers, key is the name of peer
+type heartbeater struct {
+	interval  time.Duration
+	maxMisses int
+	// site return the site label of peer for metrics
+	site        func(peer string) string
+	lock        sync.Mutex
+	peers       map[string]*Liveness
+	onHeartbeat []func(peer string, l Liveness)
+}
+
+func newHeartbeater(interval time.Duration, maxMisses int, site func(peer string) string) *heartbeater {
+	return &heartbeater{
+		interval:  interval,
+		maxMisses: maxMisses,
+		site:      site,
+		peers:     make(map[string]*Liveness),
+	}
+}
+
+// record save the result of heartbeat sent to peer, err is not nil if peer missed it
+func (h *heartbeater) record(peer string, rtt time.Duration, err error) Liveness {
+	h.lock.Lock()
+	l, ok := h.peers[peer]
+	if !ok {
+		l = &Liveness{}
+		h.peers[peer] = l
+	}
+	if err == nil {
+		l.RTT, l.LastSeen, l.Misses, l.Stale = rtt, time.Now(), 0, false
+	} else {
+		l.Misses++
+		l.Stale = l.Misses >= h.maxMisses
+	}
+	liveness := *l
+	callbacks := h.onHeartbeat
+	h.lock.Unlock()
+
+	site := h.site(peer)
+	if err == nil {
+		HeartbeatRTT.WithLabelValues(site).Set(rtt.Seconds())
+		HeartbeatLastSeen.WithLabelValues(site).Set(float64(liveness.LastSeen.Unix()))
+	} else {
+		HeartbeatMisses.WithLabelValues(site).Inc()
+	}
+	for _, fn := range callbacks {
+		fn(peer, liveness)
+	}
+	return liveness
+}
+
+// get return the liveness of peer, false if no heartbeat exchanged with it
+func (h *heartbeater) get(peer string) (Liveness, bool) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	l, ok := h.peers[peer]
+	if !ok {
+		return Liveness{}, false
+	}
+	return *l, true
+}
+
+// remove delete the liveness and metrics of peer when it disconnected
+func (h *heartbeater) remove(peer string) {
+	h.lock.Lock()
+	delete(h.peers, peer)
+	h.lock.Unlock()
+
+	site := h.site(peer)
+	HeartbeatRTT.DeleteLabelValues(site)
+	HeartbeatLastSeen.DeleteLabelValues(site)
+	HeartbeatMisses.DeleteLabelValues(site)
+}
+
+// addCallback add fn to call after every heartbeat sent
+func (h *heartbeater) addCallback(fn func(peer string, l Liveness)) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.onHeartbeat = append(h.onHeartbeat, fn)
+}
+
+// heartbeat send a heartbeat cmd to executor and wait for its response at most one interval, peer is the
+// name to record its liveness, a legacy executor replies not supported which means it is alive as well
+func (cm *cmdManager) heartbeat(executor, peer string) Liveness {
+	ctx, cancel := context.WithTimeout(context.Background(), cm.heartbeats.interval)
+	defer cancel()
+
+	start := time.Now()
+	req := cm.newCmdReq(Heartbeat, Args{"timestamp": strconv.FormatInt(start.UnixNano(), 10)}, executor)
+	_, err := cm.SendSyncContext(ctx, req)
+	l := cm.heartbeats.record(peer, time.Since(start), err)
+	if err != nil {
+		alog.V(4).Infof("Heartbeat to %s missed %d times: %v", peer, l.Misses, err)
+	}
+	return l
+}
+
+// heartbeatHandler reply heartbeat cmd with the timestamp of caller
+func heartbeatHandler(req *Req) (*Resp, OnComplete) {
+	return RespSucceed(req.Args.Get("timestamp")), nil
+}
+
+// siteOf return the site id of connection key, the key is site id and timestamp joined by apis.ConnectionSplit
+func siteOf(key string) string {
+	return strings.Split(key, apis.ConnectionSplit)[0]
+}
@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+)
+
+// InfoIdentity is the key of conns.Conn.Info to record the identities of executor certificate, separated by comma
+const InfoIdentity = "identity"
+
+// IdentityAuthorizer check if the executor with certificate identities is allowed to register as caller,
+// identities are the CN and DNS SANs of the verified client certificate, empty if not connected by mTLS
+type IdentityAuthorizer func(identities []string, caller string) error
+
+// WithIdentityAuthorizer refuse executors registered if authorize failed, it only works for server
+func WithIdentityAuthorizer(authorize IdentityAuthorizer) Option {
+	return func(o *options) {
+		o.identityAuthorizer = authorize
+	}
+}
+
+// SiteIdentityAuthorizer build an IdentityAuthorizer allows the executor to register only if the site of its
+// connection key is mapped by any identity of its certificate, site "*" means all sites
+func SiteIdentityAuthorizer(sites map[string][]string) IdentityAuthorizer {
+	return func(identities []string, caller string) error {
+		if len(identities) == 0 {
+			return fmt.Errorf("no verified client certificate")
+		}
+		site := siteOf(caller)
+		for _, identity := range identities {
+			for _, s := range sites[identity] {
+				if s == site || s == "*" {
+					return nil
+				}
+			}
+		}
+		return fmt.Errorf("certificate of %s is not allowed to register as site %q", strings.Join(identities, ","), site)
+	}
+}
+
+// PeerIdentities return the CN and DNS SANs of the verified client certificate of grpc peer in ctx
+func PeerIdentities(ctx context.Context) []string {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return nil
+	}
+	info, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(info.State.VerifiedChains) == 0 || len(info.State.VerifiedChains[0]) == 0 {
+		return nil
+	}
+	cert := info.State.VerifiedChains[0][0]
+	var identities []string
+	if cert.Subject.CommonName != "" {
+		identities = append(identities, cert.Subject.CommonName)
+	}
+	for _, name := range cert.DNSNames {
+		if name != cert.Subject.CommonName {
+			identities = append(identities, name)
+		}
+	}
+	return identities
+}
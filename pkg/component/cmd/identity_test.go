@@ -0,0 +1,89 @@
+package cmd
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net"
+	"reflect"
+	"testing"
+
+	pb "code.xxxxx.cn/platform/galaxy/pkg/component/cmd/v1"
+	"code.xxxxx.cn/platform/galaxy/pkg/component/conns"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/stats"
+)
+
+func TestPeerIdentities(t *testing.T) {
+	if ids := PeerIdentities(context.Background()); len(ids) != 0 {
+		t.Errorf("expect no identities without peer, got %v", ids)
+	}
+
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: "agent1"}, DNSNames: []string{"agent1", "agent1.xxxxx.cn"}}
+	ctx := peer.NewContext(context.Background(), &peer.Peer{
+		AuthInfo: credentials.TLSInfo{State: tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}},
+	})
+	if ids := PeerIdentities(ctx); !reflect.DeepEqual(ids, []string{"agent1", "agent1.xxxxx.cn"}) {
+		t.Errorf("unexpected identities %v", ids)
+	}
+}
+
+func TestSiteIdentityAuthorizer(t *testing.T) {
+	authorize := SiteIdentityAuthorizer(map[string][]string{
+		"agent1": {"site1"},
+		"admin":  {"*"},
+	})
+	for _, c := range []struct {
+		identities []string
+		caller     string
+		allowed    bool
+	}{
+		{[]string{"agent1"}, "site1@@1600000000", true},
+		{[]string{"agent1"}, "site2@@1600000000", false},
+		{[]string{"other", "admin"}, "site2@@1600000000", true},
+		{nil, "site1@@1600000000", false},
+	} {
+		if err := authorize(c.identities, c.caller); (err == nil) != c.allowed {
+			t.Errorf("authorize %v as %s: expect allowed %t, got %v", c.identities, c.caller, c.allowed, err)
+		}
+	}
+}
+
+func TestFromExecutor(t *testing.T) {
+	cs := &cmdServer{connManager: conns.NewConnManager()}
+	connect := func() context.Context {
+		tag := &stats.ConnTagInfo{RemoteAddr: &net.TCPAddr{IP: net.IPv4(10, 0, 0, 2), Port: 1234}}
+		ctx := cs.connManager.TagConn(context.Background(), tag)
+		cs.connManager.HandleConn(ctx, &stats.ConnBegin{})
+		return ctx
+	}
+	registered, key := connect(), "site1@@1600000001"
+	if err := cs.connManager.SaveConn(registered, key, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	defer cs.connManager.HandleConn(registered, &stats.ConnEnd{})
+	unregistered := connect()
+	defer cs.connManager.HandleConn(unregistered, &stats.ConnEnd{})
+
+	other := "site2@@1600000001"
+	for _, c := range []struct {
+		ctx     context.Context
+		recv    *pb.CmdPackage
+		allowed bool
+	}{
+		{unregistered, &pb.CmdPackage{Name: string(Register), Caller: other}, true},
+		{unregistered, &pb.CmdPackage{Name: "ping", Type: pb.CmdPackage_REQUEST, Caller: other}, false},
+		{registered, &pb.CmdPackage{Name: "ping", Type: pb.CmdPackage_REQUEST, Caller: key}, true},
+		{registered, &pb.CmdPackage{Name: "ping", Type: pb.CmdPackage_RESPONSE, Caller: "CmdServer", Executor: key}, true},
+		{registered, &pb.CmdPackage{Name: "ping", Type: pb.CmdPackage_CANCEL, Caller: key}, true},
+		{registered, &pb.CmdPackage{Name: string(Register), Caller: other}, false},
+		{registered, &pb.CmdPackage{Name: "fileupdate", Type: pb.CmdPackage_REQUEST, Caller: other}, false},
+		{registered, &pb.CmdPackage{Name: "ping", Type: pb.CmdPackage_RESPONSE, Caller: "CmdServer", Executor: other}, false},
+	} {
+		if allowed := cs.fromExecutor(c.ctx, c.recv); allowed != c.allowed {
+			t.Errorf("package %v: expect allowed %t, got %t", c.recv, c.allowed, allowed)
+		}
+	}
+}
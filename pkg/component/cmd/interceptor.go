@@ -0,0 +1,170 @@
+package cmd
+
+import (
+	"fmt"
+	"runtime/debug"
+	"time"
+
+	"code.xxxxx.cn/platform/galaxy/pkg/util/alog"
+)
+
+// Interceptor intercept the execution of a cmd handler, it works like grpc unary interceptor,
+// interceptor must call handler to execute the cmd, or return a response instead of it
+type Interceptor func(req *Req, handler Handler) (*Resp, OnComplete)
+
+// Option configure the cmd server or client
+type Option func(o *options)
+
+// options hold all optional configs of cmd server and client
+type options struct {
+	interceptors []Interceptor
+	// minProtocolVersion is the min protocol version of executors allowed to register to server
+	minProtocolVersion int
+	// identityAuthorizer check the certificate identities of executors registering to server
+	identityAuthorizer IdentityAuthorizer
+	// respCacheSize and respCacheTTL configure the cache of recent responses to de-duplicate cmds
+	respCacheSize int
+	respCacheTTL  time.Duration
+	// heartbeatInterval and heartbeatMaxMisses configure the heartbeat cmds sent to peers
+	heartbeatInterval  time.Duration
+	heartbeatMaxMisses int
+}
+
+// WithInterceptors add interceptors to wrap every cmd handler, the first one is the outermost
+func WithInterceptors(interceptors ...Interceptor) Option {
+	return func(o *options) {
+		o.interceptors = append(o.interceptors, interceptors...)
+	}
+}
+
+// WithMinProtocolVersion refuse executors registered with protocol version less than version,
+// legacy executors are protocol version 0, it only works for server
+func WithMinProtocolVersion(version int) Option {
+	return func(o *options) {
+		o.minProtocolVersion = version
+	}
+}
+
+// WithRespCache configure executor to cache at most size responses for ttl, a cmd with the same uuid
+// of a cached one is not executed again but replied the cached response, size 0 disables the cache
+func WithRespCache(size int, ttl time.Duration) Option {
+	return func(o *options) {
+		o.respCacheSize = size
+		o.respCacheTTL = ttl
+	}
+}
+
+// WithHeartbeat configure to send heartbeat cmd to peers every interval, a peer is stale if it missed
+// maxMisses heartbeats in a row, the client reconnects to server if server is stale, and the server disconnects
+// the stale executor, heartbeat is disabled by default or interval is 0
+func WithHeartbeat(interval time.Duration, maxMisses int) Option {
+	return func(o *options) {
+		o.heartbeatInterval = interval
+		o.heartbeatMaxMisses = maxMisses
+	}
+}
+
+// newOptions build options from Option funcs
+func newOptions(opts ...Option) *options {
+	o := &options{
+		respCacheSize: DefaultRespCacheSize,
+		respCacheTTL:  DefaultRespCacheTTL,
+
+		heartbeatMaxMisses: DefaultHeartbeatMaxMisses,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// chainInterceptors wrap handler with interceptors, the first interceptor is the outermost
+func chainInterceptors(interceptors []Interceptor, handler Handler) Handler {
+	chained := handler
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		interceptor, next := interceptors[i], chained
+		chained = func(req *Req) (*Resp, OnComplete) {
+			return interceptor(req, next)
+		}
+	}
+	return chained
+}
+
+// RecoveryInterceptor recover the panic of handler and its OnComplete, response a failed resp instead of crash
+func RecoveryInterceptor() Interceptor {
+	return func(req *Req, handler Handler) (resp *Resp, onComplete OnComplete) {
+		defer func() {
+			if r := recover(); r != nil {
+				alog.Errorf("Recovered panic of cmd %s/%s from %s: %v\n%s", req.Name, req.UUID, req.Caller, r, debug.Stack())
+				CmdPanics.WithLabelValues(string(req.Name)).Inc()
+				resp, onComplete = RespError(fmt.Errorf("cmd %s panic: %v", req.Name, r)), nil
+			}
+		}()
+
+		resp, onComplete = handler(req)
+		if onComplete == nil {
+			return resp, nil
+		}
+		return resp, func(err error) {
+			defer func() {
+				if r := recover(); r != nil {
+					alog.Errorf("Recovered panic of cmd %s/%s on complete: %v\n%s", req.Name, req.UUID, r, debug.Stack())
+					CmdPanics.WithLabelValues(string(req.Name)).Inc()
+				}
+			}()
+			onComplete(err)
+		}
+	}
+}
+
+// MetricsInterceptor record the latency and errors of every cmd, latency is from handler called to response sent
+func MetricsInterceptor() Interceptor {
+	return func(req *Req, handler Handler) (*Resp, OnComplete) {
+		start := time.Now()
+		name := string(req.Name)
+		resp, onComplete := handler(req)
+		if resp == nil || resp.Code != SuccessCode {
+			CmdErrors.WithLabelValues(name).Inc()
+		}
+		return resp, func(err error) {
+			CmdHandleDuration.WithLabelValues(name).Observe(time.Since(start).Seconds())
+			if err != nil {
+				CmdErrors.WithLabelValues(name).Inc()
+			}
+			if onComplete != nil {
+				onComplete(err)
+			}
+		}
+	}
+}
+
+// LoggingInterceptor log every cmd executed in key=value format
+func LoggingInterceptor() Interceptor {
+	return func(req *Req, handler Handler) (*Resp, OnComplete) {
+		start := time.Now()
+		resp, onComplete := handler(req)
+		code, msg, stream := 0, "", false
+		if resp != nil {
+			code, msg, stream = resp.Code, resp.Msg, resp.IsStream()
+		}
+		// heartbeats are exchanged periodically, log them only in verbose mode
+		if req.Name != Heartbeat || alog.V(4) {
+			alog.Infof("Cmd handled: name=%q uuid=%s caller=%q executor=%q code=%d msg=%q stream=%t duration=%s",
+				req.Name, req.UUID, req.Caller, req.Executor, code, msg, stream, time.Since(start))
+		}
+		return resp, func(err error) {
+			if err != nil {
+				alog.Errorf("Cmd response failed: name=%q uuid=%s caller=%q err=%q duration=%s",
+					req.Name, req.UUID, req.Caller, err, time.Since(start))
+			}
+			if onComplete != nil {
+				onComplete(err)
+			}
+		}
+	}
+}
+
+// DefaultInterceptors return the recommended interceptors of recovery, metrics and logging
+func DefaultInterceptors() []Interceptor {
+	return []Interceptor{LoggingInterceptor(), MetricsInterceptor(), RecoveryInterceptor()}
+}
@@ -1,6 +1,8 @@
 package cmd
 
 import (
+	"context"
+
 	pb "code.xxxxx.cn/platform/galaxy/pkg/component/cmd/v1"
 	"code.xxxxx.cn/platform/galaxy/pkg/component/conns"
 )
@@ -9,10 +11,16 @@ import (
 type Manager interface {
 	// AddCmdHandler register cmd and handler for executor
 	AddCmdHandler(name Name, handler Handler)
-	// SendSync send cmd sync, will block until received response or timeout
+	// SendSync send cmd sync, will block until received response or timeout, retry by sending the same
+	// cmd again, the executor replies the response of the first execution if it executed the cmd
 	SendSync(cmd *Req, timeoutSecond int) (*Resp, error)
 	// SendAsync send cmd async, will return result immediately, and call callback if response received
 	SendAsync(cmd *Req, callback Callback) error
+	// SendSyncContext send cmd sync, will block until received response or ctx done,
+	// cancel the running handler at executor when ctx done
+	SendSyncContext(ctx context.Context, cmd *Req) (*Resp, error)
+	// SendAsyncContext send cmd async, cancel the running handler at executor when ctx done
+	SendAsyncContext(ctx context.Context, cmd *Req, callback Callback) error
 	// Name return the name of executor
 	Name() string
 }
@@ -25,6 +33,21 @@ type Server interface {
 	NewCmdReq(name Name, args Args, executor string) *Req
 	// GetConnManager return connection manager
 	GetConnManager() *conns.ConnManager
+	// SendBroadcast send cmd to all executors selected by selector, and return the aggregated results,
+	// all cmds will be cancelled when the context of req done
+	SendBroadcast(req *Req, selector Selector, opts *BroadcastOptions) (*BroadcastResult, error)
+	// Capabilities return the version and supported cmds of executor negotiated when registered
+	Capabilities(executor string) (*Capabilities, error)
+	// Supports check if executor is connected and supports cmd name, legacy executors are assumed to support all cmds
+	Supports(executor string, name Name) bool
+	// Liveness return the liveness of executor measured by heartbeat cmds
+	Liveness(executor string) (*Liveness, error)
+	// OnHeartbeat add callback func called after every heartbeat sent to executor, it is called even if the
+	// executor missed the heartbeat, check Stale of liveness to find half-open connections
+	OnHeartbeat(fn func(executor string, l Liveness))
+	// Close drain the cmds executing until ctx done, close the streams reading by CloseStream cmds,
+	// then disconnect all executors
+	Close(ctx context.Context) error
 }
 
 // Client start a command bi-tunnel to listen and exec command
@@ -38,6 +61,9 @@ type Client interface {
 	OnReady(ready func())
 	// OnNotReady listen connection is not ready
 	OnNotReady(ready func())
+	// Close drain the cmds executing until ctx done, close the streams reading by CloseStream cmds,
+	// then close the tunnel and never reconnect
+	Close(ctx context.Context) error
 }
 
 // Callback is the func to call when receive cmd response
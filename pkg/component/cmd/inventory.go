@@ -0,0 +1,44 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"code.xxxxx.cn/platform/galaxy/pkg/apis"
+)
+
+// argInventory is the key of args to carry the json of inventory, no typed payload defined for it
+const argInventory = "inventory"
+
+// SetInventoryArgs set the inventory as args of cmd reportinventory
+func SetInventoryArgs(req *Req, inventory *apis.ClusterInventory) error {
+	data, err := json.Marshal(inventory)
+	if err != nil {
+		return fmt.Errorf("marshal inventory failed: %v", err)
+	}
+	if req.Args == nil {
+		req.Args = Args{}
+	}
+	req.Args.Set(argInventory, string(data))
+	return nil
+}
+
+// GetInventoryArgs get the inventory from args of cmd reportinventory
+func GetInventoryArgs(req *Req) (*apis.ClusterInventory, error) {
+	inventory := &apis.ClusterInventory{}
+	if err := json.Unmarshal([]byte(req.Args.Get(argInventory)), inventory); err != nil {
+		return nil, fmt.Errorf("decode inventory of cmd %s failed: %v", req.Name, err)
+	}
+	return inventory, nil
+}
+
+// HandleReportInventory adapt a handler of inventory to Handler
+func HandleReportInventory(handler func(req *Req, inventory *apis.ClusterInventory) (*Resp, OnComplete)) Handler {
+	return func(req *Req) (*Resp, OnComplete) {
+		inventory, err := GetInventoryArgs(req)
+		if err != nil {
+			return RespError(err), nil
+		}
+		return handler(req, inventory)
+	}
+}
@@ -0,0 +1,74 @@
+package cmd
+
+import (
+	"code.xxxxx.cn/platform/galaxy/pkg/component/conns"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	// CmdHandleDuration metric of duration to handle cmd and send its response
+	CmdHandleDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Subsystem: conns.GalaxySubsystem,
+			Name:      "cmd_handle_duration_seconds",
+			Help:      "Duration in seconds to handle cmd and send its response",
+			Buckets:   prometheus.DefBuckets,
+		},
+		[]string{"name"},
+	)
+	// CmdErrors metric of failed cmd number
+	CmdErrors = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Subsystem: conns.GalaxySubsystem,
+			Name:      "cmd_errors_total",
+			Help:      "Number of cmds failed to handle or response",
+		},
+		[]string{"name"},
+	)
+	// CmdPanics metric of recovered cmd handler panic number
+	CmdPanics = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Subsystem: conns.GalaxySubsystem,
+			Name:      "cmd_panics_total",
+			Help:      "Number of recovered panics of cmd handlers",
+		},
+		[]string{"name"},
+	)
+	// HeartbeatRTT metric of round-trip time of the last heartbeat replied by peers
+	HeartbeatRTT = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Subsystem: conns.GalaxySubsystem,
+			Name:      "heartbeat_rtt_seconds",
+			Help:      "Round-trip time in seconds of the last heartbeat replied by site",
+		},
+		[]string{"site"},
+	)
+	// HeartbeatLastSeen metric of the last time heartbeat replied by peers
+	HeartbeatLastSeen = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Subsystem: conns.GalaxySubsystem,
+			Name:      "heartbeat_last_seen_timestamp_seconds",
+			Help:      "Unix timestamp of the last heartbeat replied by site",
+		},
+		[]string{"site"},
+	)
+	// HeartbeatMisses metric of heartbeat missed number
+	HeartbeatMisses = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Subsystem: conns.GalaxySubsystem,
+			Name:      "heartbeat_misses_total",
+			Help:      "Number of heartbeats not replied by site in time",
+		},
+		[]string{"site"},
+	)
+)
+
+// Register all metrics
+func init() {
+	prometheus.MustRegister(CmdHandleDuration)
+	prometheus.MustRegister(CmdErrors)
+	prometheus.MustRegister(CmdPanics)
+	prometheus.MustRegister(HeartbeatRTT)
+	prometheus.MustRegister(HeartbeatLastSeen)
+	prometheus.MustRegister(HeartbeatMisses)
+}
@@ -0,0 +1,60 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/golang/protobuf/ptypes/any"
+)
+
+// SetPayload marshal msg as the typed payload of req, the type url is set by the full name of msg
+func (r *Req) SetPayload(msg proto.Message) error {
+	a, err := ptypes.MarshalAny(msg)
+	if err != nil {
+		return fmt.Errorf("marshal payload of cmd %s failed: %v", r.Name, err)
+	}
+	r.Payload, r.TypeURL = a.Value, a.TypeUrl
+	return nil
+}
+
+// HasPayload check if req has typed payload, requests sent by older callers only have Args
+func (r *Req) HasPayload() bool {
+	return r.TypeURL != ""
+}
+
+// UnmarshalPayload unmarshal the typed payload of req into msg, fail if req has no payload or type mismatched
+func (r *Req) UnmarshalPayload(msg proto.Message) error {
+	if !r.HasPayload() {
+		return fmt.Errorf("cmd %s has no payload", r.Name)
+	}
+	if err := ptypes.UnmarshalAny(&any.Any{TypeUrl: r.TypeURL, Value: r.Payload}, msg); err != nil {
+		return fmt.Errorf("unmarshal payload of cmd %s failed: %v", r.Name, err)
+	}
+	return nil
+}
+
+// setPayload set typed payload of req, and merge legacy args into Args for older executors
+func setPayload(req *Req, msg proto.Message, args Args) error {
+	if err := req.SetPayload(msg); err != nil {
+		return err
+	}
+	if req.Args == nil {
+		req.Args = Args{}
+	}
+	for k, v := range args {
+		req.Args.Set(k, v)
+	}
+	return nil
+}
+
+// getPayload unmarshal typed payload of req into msg, or decode Args by fromArgs if req is sent by older callers
+func getPayload(req *Req, msg proto.Message, fromArgs func(args Args) error) error {
+	if req.HasPayload() {
+		return req.UnmarshalPayload(msg)
+	}
+	if err := fromArgs(req.Args); err != nil {
+		return fmt.Errorf("decode args of cmd %s failed: %v", req.Name, err)
+	}
+	return nil
+}
@@ -0,0 +1,181 @@
+package cmd
+
+import (
+	"encoding/json"
+
+	pb "code.xxxxx.cn/platform/galaxy/pkg/component/cmd/v1"
+)
+
+/* typed payloads of built-in cmds, Set* set the payload and legacy args of request, Get* read the payload
+   or decode legacy args from older callers, Handle* adapt a typed handler to Handler, they are written by hand
+   instead of generated as the legacy args of every cmd differ, update them with v1/payload.proto */
+
+// SetAppCancelPayload set payload of cmd appcancel
+func SetAppCancelPayload(req *Req, p *pb.AppCancelPayload) error {
+	return setPayload(req, p, Args{
+		"site":     p.Site,
+		"app":      p.App,
+		"hostname": p.Hostname,
+		"ip":       p.IP,
+	})
+}
+
+// GetAppCancelPayload get payload of cmd appcancel
+func GetAppCancelPayload(req *Req) (*pb.AppCancelPayload, error) {
+	p := &pb.AppCancelPayload{}
+	return p, getPayload(req, p, func(args Args) error {
+		p.Site, p.App, p.Hostname, p.IP = args.Get("site"), args.Get("app"), args.Get("hostname"), args.Get("ip")
+		return nil
+	})
+}
+
+// HandleAppCancel adapt typed handler of cmd appcancel
+func HandleAppCancel(handler func(req *Req, p *pb.AppCancelPayload) (*Resp, OnComplete)) Handler {
+	return func(req *Req) (*Resp, OnComplete) {
+		p, err := GetAppCancelPayload(req)
+		if err != nil {
+			return RespError(err), nil
+		}
+		return handler(req, p)
+	}
+}
+
+// SetNSPackagePayload set payload of cmd nspackage
+func SetNSPackagePayload(req *Req, p *pb.NSPackagePayload) error {
+	return setPayload(req, p, Args{
+		"namespace": p.Namespace,
+		"digest":    p.Digest,
+	})
+}
+
+// GetNSPackagePayload get payload of cmd nspackage
+func GetNSPackagePayload(req *Req) (*pb.NSPackagePayload, error) {
+	p := &pb.NSPackagePayload{}
+	return p, getPayload(req, p, func(args Args) error {
+		p.Namespace, p.Digest = args.Get("namespace"), args.Get("digest")
+		return nil
+	})
+}
+
+// HandleNSPackage adapt typed handler of cmd nspackage
+func HandleNSPackage(handler func(req *Req, p *pb.NSPackagePayload) (*Resp, OnComplete)) Handler {
+	return func(req *Req) (*Resp, OnComplete) {
+		p, err := GetNSPackagePayload(req)
+		if err != nil {
+			return RespError(err), nil
+		}
+		return handler(req, p)
+	}
+}
+
+// SetFileRefreshPayload set payload of cmd filerefresh and fileresync
+func SetFileRefreshPayload(req *Req, p *pb.FileRefreshPayload) error {
+	data, err := json.Marshal(FileDigestsMap(p.Files))
+	if err != nil {
+		return err
+	}
+	return setPayload(req, p, Args{
+		"siteid":       p.SiteID,
+		"filecontents": string(data),
+	})
+}
+
+// GetFileRefreshPayload get payload of cmd filerefresh and fileresync
+func GetFileRefreshPayload(req *Req) (*pb.FileRefreshPayload, error) {
+	p := &pb.FileRefreshPayload{}
+	return p, getPayload(req, p, func(args Args) error {
+		files := map[string]map[string]string{}
+		if err := json.Unmarshal([]byte(args.Get("filecontents")), &files); err != nil {
+			return err
+		}
+		p.SiteID, p.Files = args.Get("siteid"), NewFileDigests(files)
+		return nil
+	})
+}
+
+// HandleFileRefresh adapt typed handler of cmd filerefresh and fileresync
+func HandleFileRefresh(handler func(req *Req, p *pb.FileRefreshPayload) (*Resp, OnComplete)) Handler {
+	return func(req *Req) (*Resp, OnComplete) {
+		p, err := GetFileRefreshPayload(req)
+		if err != nil {
+			return RespError(err), nil
+		}
+		return handler(req, p)
+	}
+}
+
+// fileUpdatedArgs is the legacy json format of FileUpdatedPayload in args updateinfo
+type fileUpdatedArgs struct {
+	SiteID    string            `json:"site_id"`
+	App       string            `json:"app"`
+	Hostname  string            `json:"hostname"`
+	IP        string            `json:"ip"`
+	Namespace string            `json:"namespace"`
+	Filenames map[string]string `json:"filenames"`
+}
+
+// ArgUpdateError is the key of args of cmd fileupdated to report the failure of applying files,
+// the digests of payload are the ones in effect
+const ArgUpdateError = "error"
+
+// SetFileUpdatedPayload set payload of cmd fileupdated
+func SetFileUpdatedPayload(req *Req, p *pb.FileUpdatedPayload) error {
+	data, err := json.Marshal(fileUpdatedArgs{
+		SiteID:    p.SiteID,
+		App:       p.App,
+		Hostname:  p.Hostname,
+		IP:        p.IP,
+		Namespace: p.Namespace,
+		Filenames: p.Filenames,
+	})
+	if err != nil {
+		return err
+	}
+	return setPayload(req, p, Args{"updateinfo": string(data)})
+}
+
+// GetFileUpdatedPayload get payload of cmd fileupdated
+func GetFileUpdatedPayload(req *Req) (*pb.FileUpdatedPayload, error) {
+	p := &pb.FileUpdatedPayload{}
+	return p, getPayload(req, p, func(args Args) error {
+		info := &fileUpdatedArgs{}
+		if err := json.Unmarshal([]byte(args.Get("updateinfo")), info); err != nil {
+			return err
+		}
+		p.SiteID, p.App, p.Hostname, p.IP = info.SiteID, info.App, info.Hostname, info.IP
+		p.Namespace, p.Filenames = info.Namespace, info.Filenames
+		return nil
+	})
+}
+
+// HandleFileUpdated adapt typed handler of cmd fileupdated
+func HandleFileUpdated(handler func(req *Req, p *pb.FileUpdatedPayload) (*Resp, OnComplete)) Handler {
+	return func(req *Req) (*Resp, OnComplete) {
+		p, err := GetFileUpdatedPayload(req)
+		if err != nil {
+			return RespError(err), nil
+		}
+		return handler(req, p)
+	}
+}
+
+// NewFileDigests convert digests map of namespace/filename/digest to typed files of FileRefreshPayload
+func NewFileDigests(files map[string]map[string]string) map[string]*pb.FileDigests {
+	digests := make(map[string]*pb.FileDigests, len(files))
+	for ns, file := range files {
+		digests[ns] = &pb.FileDigests{Digests: file}
+	}
+	return digests
+}
+
+// FileDigestsMap convert typed files of FileRefreshPayload to digests map of namespace/filename/digest
+func FileDigestsMap(files map[string]*pb.FileDigests) map[string]map[string]string {
+	m := make(map[string]map[string]string, len(files))
+	for ns, file := range files {
+		m[ns] = file.GetDigests()
+		if m[ns] == nil {
+			m[ns] = map[string]string{}
+		}
+	}
+	return m
+}
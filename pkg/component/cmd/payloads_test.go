@@ -0,0 +1,73 @@
+package cmd
+
+import (
+	"reflect"
+	"testing"
+
+	pb "code.xxxxx.cn/platform/galaxy/pkg/component/cmd/v1"
+)
+
+func TestFileRefreshPayload(t *testing.T) {
+	files := map[string]map[string]string{"ns": {"a.json": "digest"}}
+	req := &Req{Name: FileRefreshHandler}
+	if err := SetFileRefreshPayload(req, &pb.FileRefreshPayload{SiteID: "site1", Files: NewFileDigests(files)}); err != nil {
+		t.Fatalf("set payload failed: %v", err)
+	}
+	if req.TypeURL != "type.googleapis.com/v1.FileRefreshPayload" {
+		t.Errorf("unexpected type url %q", req.TypeURL)
+	}
+	if req.Args.Get("siteid") != "site1" || req.Args.Get("filecontents") != `{"ns":{"a.json":"digest"}}` {
+		t.Errorf("unexpected legacy args %v", req.Args)
+	}
+
+	p, err := GetFileRefreshPayload(req)
+	if err != nil {
+		t.Fatalf("get payload failed: %v", err)
+	}
+	if p.SiteID != "site1" || !reflect.DeepEqual(FileDigestsMap(p.Files), files) {
+		t.Errorf("unexpected payload %v", p)
+	}
+
+	// requests from older callers only have args
+	legacy := &Req{Name: FileRefreshHandler, Args: Args{"siteid": "site1", "filecontents": req.Args.Get("filecontents")}}
+	p, err = GetFileRefreshPayload(legacy)
+	if err != nil {
+		t.Fatalf("get payload from args failed: %v", err)
+	}
+	if p.SiteID != "site1" || !reflect.DeepEqual(FileDigestsMap(p.Files), files) {
+		t.Errorf("unexpected payload from args %v", p)
+	}
+}
+
+func TestFileUpdatedPayloadFromArgs(t *testing.T) {
+	req := &Req{Name: FileUpdateHandler, Args: Args{
+		"updateinfo": `{"site_id":"site1","app":"app1","namespace":"ns","filenames":{"a.json":"digest"}}`,
+	}}
+	p, err := GetFileUpdatedPayload(req)
+	if err != nil {
+		t.Fatalf("get payload from args failed: %v", err)
+	}
+	if p.SiteID != "site1" || p.App != "app1" || p.Namespace != "ns" || p.Filenames["a.json"] != "digest" {
+		t.Errorf("unexpected payload from args %v", p)
+	}
+
+	req.Args.Set("updateinfo", "{")
+	if _, err := GetFileUpdatedPayload(req); err == nil {
+		t.Errorf("expect error of invalid updateinfo")
+	}
+}
+
+func TestHandlePayloadMismatched(t *testing.T) {
+	req := &Req{Name: AppCancelHandler}
+	if err := SetNSPackagePayload(req, &pb.NSPackagePayload{Namespace: "ns"}); err != nil {
+		t.Fatalf("set payload failed: %v", err)
+	}
+	called := false
+	resp, _ := HandleAppCancel(func(req *Req, p *pb.AppCancelPayload) (*Resp, OnComplete) {
+		called = true
+		return RespSucceed(""), nil
+	})(req)
+	if called || resp.Code != FailCode {
+		t.Errorf("expect failed resp of mismatched payload, called=%t code=%d", called, resp.Code)
+	}
+}
@@ -0,0 +1,136 @@
+package cmd
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultRespCacheSize default max number of recent responses cached by executor to de-duplicate cmds
+	DefaultRespCacheSize = 1024
+	// DefaultRespCacheTTL default time to keep a response in cache after the cmd executed
+	DefaultRespCacheTTL = 10 * time.Minute
+)
+
+// cachedResp is the response of a cmd executed or executing
+type cachedResp struct {
+	// done is closed when the cmd executed and resp saved
+	done chan struct{}
+	// resp is a copy of the response without stream
+	resp   *Resp
+	stream bool
+	expire time.Time
+	// dropped is true if the cmd failed, the duplicated cmds should be executed again
+	dropped bool
+}
+
+// replay build a response same as the cached one, stream can not be replayed as it is consumed
+func (c *cachedResp) replay(uuid string) *Resp {
+	if c.resp == nil {
+		return RespError(fmt.Errorf("response of duplicated cmd %s is not available", uuid))
+	}
+	if c.stream {
+		return RespError(fmt.Errorf("cmd %s is executed with a stream response which can not be replayed", uuid))
+	}
+	return &Resp{Code: c.resp.Code, Msg: c.resp.Msg, Data: c.resp.Data}
+}
+
+// respCache is a bounded cache of recent responses succeed keyed by uuid of cmd, it makes every cmd
+// executed at most once in ttl, a duplicated cmd gets the response of the first execution
+type respCache struct {
+	size  int
+	ttl   time.Duration
+	lock  sync.Mutex
+	resps map[string]*cachedResp
+	// order is the uuids in order of executed, the oldest is evicted first
+	order []string
+}
+
+func newRespCache(size int, ttl time.Duration) *respCache {
+	return &respCache{
+		size:  size,
+		ttl:   ttl,
+		resps: make(map[string]*cachedResp),
+	}
+}
+
+// begin reserve the uuid for execution, return the cached one and false if it is duplicated
+func (rc *respCache) begin(uuid string) (*cachedResp, bool) {
+	if rc.size <= 0 {
+		return nil, true
+	}
+	rc.lock.Lock()
+	defer rc.lock.Unlock()
+
+	rc.evict(time.Now())
+	if cached, ok := rc.resps[uuid]; ok {
+		return cached, false
+	}
+	cached := &cachedResp{done: make(chan struct{})}
+	rc.resps[uuid] = cached
+	rc.order = append(rc.order, uuid)
+	return cached, true
+}
+
+// complete save the response of uuid and wake up the duplicated cmds waiting for it
+func (rc *respCache) complete(uuid string, resp *Resp) {
+	if rc.size <= 0 {
+		return
+	}
+	rc.lock.Lock()
+	defer rc.lock.Unlock()
+
+	cached, ok := rc.resps[uuid]
+	if !ok || !cached.expire.IsZero() {
+		return
+	}
+	if resp != nil {
+		cached.resp = &Resp{Code: resp.Code, Msg: resp.Msg, Data: resp.Data}
+		cached.stream = resp.IsStream()
+	}
+	cached.expire = time.Now().Add(rc.ttl)
+	close(cached.done)
+}
+
+// drop delete the uuid reserved if the cmd is not completed, such as failed, so it is executed
+// again when retried, the duplicated cmds waiting for it are woken up to execute again
+func (rc *respCache) drop(uuid string) {
+	if rc.size <= 0 {
+		return
+	}
+	rc.lock.Lock()
+	defer rc.lock.Unlock()
+
+	cached, ok := rc.resps[uuid]
+	if !ok || !cached.expire.IsZero() {
+		return
+	}
+	delete(rc.resps, uuid)
+	for i, u := range rc.order {
+		if u == uuid {
+			rc.order = append(rc.order[:i], rc.order[i+1:]...)
+			break
+		}
+	}
+	cached.dropped = true
+	close(cached.done)
+}
+
+// evict delete the expired responses and the oldest ones if cache is full
+func (rc *respCache) evict(now time.Time) {
+	for len(rc.order) > 0 {
+		uuid := rc.order[0]
+		cached, ok := rc.resps[uuid]
+		full := len(rc.order) >= rc.size
+		if ok && !full && (cached.expire.IsZero() || cached.expire.After(now)) {
+			return
+		}
+		if ok && cached.expire.IsZero() {
+			// wake up the duplicated cmds waiting for the evicted executing cmd
+			close(cached.done)
+		}
+		delete(rc.resps, uuid)
+		rc.order = rc.order[1:]
+	}
+}
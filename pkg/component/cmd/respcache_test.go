@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRespCache(t *testing.T) {
+	rc := newRespCache(2, time.Minute)
+	if _, first := rc.begin("a"); !first {
+		t.Fatalf("expect first execution of a")
+	}
+	cached, first := rc.begin("a")
+	if first {
+		t.Fatalf("expect a duplicated")
+	}
+	rc.complete("a", RespSucceed("data"))
+	<-cached.done
+	if resp := cached.replay("a"); resp.Code != SuccessCode || resp.Data != "data" {
+		t.Errorf("unexpected replayed resp %+v", resp)
+	}
+
+	rc.begin("b")
+	rc.complete("b", RespStream())
+	if cached, _ := rc.begin("b"); cached.replay("b").Code != FailCode {
+		t.Errorf("expect stream resp not replayed")
+	}
+
+	// a is evicted as the cache is full
+	rc.begin("c")
+	if _, first := rc.begin("a"); !first {
+		t.Errorf("expect a evicted and executed again")
+	}
+}
+
+func TestRespCacheExpired(t *testing.T) {
+	rc := newRespCache(10, time.Millisecond)
+	rc.begin("a")
+	rc.complete("a", RespSucceed(""))
+	time.Sleep(10 * time.Millisecond)
+	if _, first := rc.begin("a"); !first {
+		t.Errorf("expect a expired and executed again")
+	}
+}
+
+func TestRespCacheDropped(t *testing.T) {
+	rc := newRespCache(10, time.Minute)
+	rc.begin("a")
+	cached, _ := rc.begin("a")
+	rc.drop("a")
+	<-cached.done
+	if !cached.dropped {
+		t.Errorf("expect duplicated cmd woken up to execute again")
+	}
+	if _, first := rc.begin("a"); !first {
+		t.Errorf("expect a dropped and executed again")
+	}
+	if len(rc.order) != 1 {
+		t.Errorf("expect dropped uuid removed from order, got %v", rc.order)
+	}
+
+	// the response completed is never dropped
+	rc.complete("a", RespSucceed("data"))
+	rc.drop("a")
+	if _, first := rc.begin("a"); first {
+		t.Errorf("expect response completed kept")
+	}
+}
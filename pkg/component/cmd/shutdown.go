@@ -0,0 +1,108 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"code.xxxxx.cn/platform/galaxy/pkg/util/alog"
+)
+
+// drainInterval is the interval to check if the cmds executing finished when draining
+const drainInterval = 100 * time.Millisecond
+
+// reading is a stream response reading by caller
+type reading struct {
+	resp *Resp
+	// done is closed after the CloseStream cmd sent to executor
+	done chan struct{}
+}
+
+// drain wait for the cmds executing to finish until ctx done, the ones still running are cancelled then,
+// and close the streams reading from executors by CloseStream cmds, return error if ctx done before all closed
+func (cm *cmdManager) drain(ctx context.Context) error {
+	var err error
+	if uuids := cm.waitExecuting(ctx); len(uuids) != 0 {
+		alog.Warningf("Cancel %d cmds still executing as drain timeout", len(uuids))
+		for _, uuid := range uuids {
+			cm.abortCredits(uuid)
+			cm.executor.cancel(uuid)
+		}
+		err = fmt.Errorf("%d cmds cancelled before finished: %v", len(uuids), ctx.Err())
+	}
+
+	var readings []*reading
+	cm.readings.Range(func(_, v interface{}) bool {
+		readings = append(readings, v.(*reading))
+		return true
+	})
+	for _, r := range readings {
+		if e := r.resp.Close(); e != nil {
+			alog.Warningf("Close stream reading failed: %v", e)
+		}
+	}
+	for _, r := range readings {
+		select {
+		case <-r.done:
+		case <-ctx.Done():
+			return fmt.Errorf("close streams reading failed: %v", ctx.Err())
+		}
+	}
+	return err
+}
+
+// waitExecuting wait until no cmd executing or ctx done, return the uuids of cmds still executing
+func (cm *cmdManager) waitExecuting(ctx context.Context) []string {
+	ticker := time.NewTicker(drainInterval)
+	defer ticker.Stop()
+	for {
+		uuids := cm.executor.running()
+		if len(uuids) == 0 {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return uuids
+		case <-ticker.C:
+		}
+	}
+}
+
+// Close drain the cmds from server until ctx done, close the streams reading from server by CloseStream cmds,
+// then close the tunnel and never reconnect, the connection is left to close by its owner
+func (cc *cmdClient) Close(ctx context.Context) error {
+	err := cc.cmdManager.drain(ctx)
+	cc.closeOnce.Do(func() {
+		close(cc.closed)
+	})
+
+	cc.lock.Lock()
+	stream, cancel, done := cc.stream, cc.cancel, cc.done
+	cc.lock.Unlock()
+	if stream == nil {
+		return err
+	}
+	// half close the stream, server ends it once received EOF
+	if e := stream.CloseSend(); e != nil {
+		alog.Warningf("Close send of tunnel failed: %v", e)
+	}
+	select {
+	case <-done:
+	case <-ctx.Done():
+	}
+	cancel()
+	alog.Infof("Tunnel to server closed")
+	return err
+}
+
+// Close drain the cmds from executors until ctx done, close the streams reading from executors by
+// CloseStream cmds, then disconnect all executors
+func (cs *cmdServer) Close(ctx context.Context) error {
+	err := cs.cmdManager.drain(ctx)
+	for _, conn := range cs.connManager.ListConns(nil) {
+		if e := cs.connManager.Disconnect(conn.Key); e != nil {
+			alog.Warningf("Disconnect %s failed: %v", conn.Key, e)
+		}
+	}
+	return err
+}
@@ -1,9 +1,12 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"strings"
+	"sync"
+	"time"
 )
 
 /* all supported cmd */
@@ -11,11 +14,15 @@ const (
 	// Cmd about manager
 	Register    Name = "register"
 	CloseStream Name = "close"
+	// Heartbeat is sent to peers periodically to measure rtt and liveness
+	Heartbeat Name = "heartbeat"
 	// TODO add more cmd
 	// Cmd Hello World
 	HelloWorld Name = "Hello World"
 	// cmd about log
 	GetContainerLog Name = "GetContainerLog"
+	// ReportInventory report kubernetes workload inventory of agent site to manager
+	ReportInventory Name = "reportinventory"
 
 	AppCancelHandler Name = "appcancel"
 
@@ -24,6 +31,9 @@ const (
 	FileRefreshHandler Name = "filerefresh"
 	FileSyncHandler    Name = "fileresync"
 
+	// PackageContentHandler download namespace package by chunks
+	PackageContentHandler Name = "packagecontent"
+
 	// CmdFileRefreshHandler grpc server handler
 	CmdFileRefreshHandler = "filerefresh"
 	// CmdContentHandler grpc server handler
@@ -50,6 +60,10 @@ const (
 	NotFoundCode = 400
 	// NotFoundMsg  is msg of not found
 	NotFoundMsg = "not found"
+	// ExecutingCode is code of a duplicated cmd whose first execution is not finished, retry it later
+	ExecutingCode = 409
+	// ExecutingMsg is msg of executing
+	ExecutingMsg = "executing"
 )
 
 // Name the type of command name
@@ -57,20 +71,54 @@ type Name string
 
 // Req defined the request content of cmd
 type Req struct {
+	// UUID is the unique id of cmd, executor executes the cmds with the same uuid at most once
 	UUID     string
 	Name     Name
 	Args     Args
 	Caller   string
 	Executor string
+	// Payload is the typed payload marshaled by protobuf, set it by SetPayload and read it by UnmarshalPayload
+	Payload []byte
+	// TypeURL is the type url of Payload
+	TypeURL string
+	// AcceptChunked is true if caller accepts chunked response, a handler should fallback to legacy
+	// response if not
+	AcceptChunked bool
+	// ctx is cancelled when the caller cancels the cmd or the cmd finished
+	ctx context.Context
+}
+
+// Context return the context of request, at executor it is cancelled when caller cancel the cmd,
+// it is never nil, default is background context
+func (r *Req) Context() context.Context {
+	if r.ctx != nil {
+		return r.ctx
+	}
+	return context.Background()
+}
+
+// WithContext return a shallow copy of req with its context changed to ctx
+func (r *Req) WithContext(ctx context.Context) *Req {
+	if ctx == nil {
+		panic("nil context")
+	}
+	r2 := new(Req)
+	*r2 = *r
+	r2.ctx = ctx
+	return r2
 }
 
 // Resp defined response content of cmd
 type Resp struct {
-	Code   int
-	Msg    string
-	Data   string
-	stream *streamer
-	close  chan struct{}
+	Code      int
+	Msg       string
+	Data      string
+	stream    *streamer
+	chunked   bool
+	close     chan struct{}
+	closeOnce sync.Once
+	// creditTimeout is the max time the stream waits for caller granting credits
+	creditTimeout time.Duration
 }
 
 // stream defined the stream of Resp
@@ -124,15 +172,29 @@ func (resp *Resp) Read(p []byte) (int, error) {
 
 // Close close Resp pipeWriter and pipeReader
 func (resp *Resp) Close() error {
-	defer func() {
-		resp.close <- struct{}{}
-	}()
+	defer resp.closeOnce.Do(func() {
+		if resp.close != nil {
+			close(resp.close)
+		}
+	})
 	if resp.stream != nil {
 		return resp.stream.close()
 	}
 	return nil
 }
 
+// WithCreditTimeout set the max time the stream response waits for caller consuming it, 0 means CreditTimeout,
+// negative means wait until the cmd cancelled or closed by caller, such as a stream tailing for a long time
+func (resp *Resp) WithCreditTimeout(timeout time.Duration) *Resp {
+	resp.creditTimeout = timeout
+	return resp
+}
+
+// IsChunked check if resp is sent as raw bytes chunks
+func (resp *Resp) IsChunked() bool {
+	return resp.chunked
+}
+
 // IsStream check if resp with reader data
 func (resp *Resp) IsStream() bool {
 	return resp.stream != nil
@@ -219,3 +281,15 @@ func RespStream(reader ...io.ReadCloser) *Resp {
 		stream: newStreamer(reader...),
 	}
 }
+
+// RespChunked build a succeed response sent as raw bytes chunks, data is sent before the chunks
+// and is available as Data of the resp received by caller, the content of readers can be read from it
+func RespChunked(data string, reader ...io.ReadCloser) *Resp {
+	return &Resp{
+		Code:    SuccessCode,
+		Msg:     SuccessMsg,
+		Data:    data,
+		stream:  &streamer{readers: reader},
+		chunked: true,
+	}
+}
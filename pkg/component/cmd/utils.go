@@ -17,5 +17,10 @@ func genReqCmdPackage(cmd *Req, caller string) (*pb.CmdPackage, error) {
 		Caller:   caller,
 		Executor: cmd.Executor,
 		Type:     pb.CmdPackage_REQUEST,
+		Payload:  cmd.Payload,
+		TypeURL:  cmd.TypeURL,
+		// all callers accept chunked response and grant credits for stream response
+		Chunked: true,
+		Window:  StreamWindow,
 	}, nil
 }
@@ -6,9 +6,15 @@ Package v1 is a generated protocol buffer package.
 
 It is generated from these files:
 	pkg/component/cmd/v1/api.proto
+	pkg/component/cmd/v1/payload.proto
 
 It has these top-level messages:
 	CmdPackage
+	FileDigests
+	FileRefreshPayload
+	FileUpdatedPayload
+	NSPackagePayload
+	AppCancelPayload
 */
 package v1
 
@@ -37,15 +43,21 @@ type CmdPackage_CmdType int32
 const (
 	CmdPackage_REQUEST  CmdPackage_CmdType = 0
 	CmdPackage_RESPONSE CmdPackage_CmdType = 1
+	CmdPackage_CANCEL   CmdPackage_CmdType = 2
+	CmdPackage_ACK      CmdPackage_CmdType = 3
 )
 
 var CmdPackage_CmdType_name = map[int32]string{
 	0: "REQUEST",
 	1: "RESPONSE",
+	2: "CANCEL",
+	3: "ACK",
 }
 var CmdPackage_CmdType_value = map[string]int32{
 	"REQUEST":  0,
 	"RESPONSE": 1,
+	"CANCEL":   2,
+	"ACK":      3,
 }
 
 func (x CmdPackage_CmdType) String() string {
@@ -74,6 +86,21 @@ type CmdPackage struct {
 	RespMsg string `protobuf:"bytes,9,opt,name=RespMsg" json:"RespMsg,omitempty"`
 	// Stream specify this cmd if is need return stream
 	Stream bool `protobuf:"varint,10,opt,name=Stream" json:"Stream,omitempty"`
+	// Payload is the typed payload of cmd request marshaled by protobuf, older executors use Args instead
+	Payload []byte `protobuf:"bytes,11,opt,name=Payload,proto3" json:"Payload,omitempty"`
+	// TypeURL is the type url of Payload, such as type.googleapis.com/v1.NSPackagePayload
+	TypeURL string `protobuf:"bytes,12,opt,name=TypeURL" json:"TypeURL,omitempty"`
+	// Chunked specify the response is sent as sequenced raw bytes chunks, in request it means caller accepts chunks
+	Chunked bool `protobuf:"varint,13,opt,name=Chunked" json:"Chunked,omitempty"`
+	// Seq is the sequence of chunk or stream package starts from 1, 0 is the header chunk, in ACK it is the sequence consumed
+	Seq uint64 `protobuf:"varint,14,opt,name=Seq" json:"Seq,omitempty"`
+	// Checksum is the crc32 checksum of RespData of chunk
+	Checksum uint32 `protobuf:"varint,15,opt,name=Checksum" json:"Checksum,omitempty"`
+	// EOF specify this is the last chunk
+	EOF bool `protobuf:"varint,16,opt,name=EOF" json:"EOF,omitempty"`
+	// Window is the credits granted by caller in request, executor pauses the stream when the packages
+	// not acknowledged reach it, 0 means no flow control
+	Window uint32 `protobuf:"varint,17,opt,name=Window" json:"Window,omitempty"`
 }
 
 func (m *CmdPackage) Reset()                    { *m = CmdPackage{} }
@@ -151,6 +178,55 @@ func (m *CmdPackage) GetStream() bool {
 	return false
 }
 
+func (m *CmdPackage) GetPayload() []byte {
+	if m != nil {
+		return m.Payload
+	}
+	return nil
+}
+
+func (m *CmdPackage) GetTypeURL() string {
+	if m != nil {
+		return m.TypeURL
+	}
+	return ""
+}
+
+func (m *CmdPackage) GetChunked() bool {
+	if m != nil {
+		return m.Chunked
+	}
+	return false
+}
+
+func (m *CmdPackage) GetSeq() uint64 {
+	if m != nil {
+		return m.Seq
+	}
+	return 0
+}
+
+func (m *CmdPackage) GetChecksum() uint32 {
+	if m != nil {
+		return m.Checksum
+	}
+	return 0
+}
+
+func (m *CmdPackage) GetEOF() bool {
+	if m != nil {
+		return m.EOF
+	}
+	return false
+}
+
+func (m *CmdPackage) GetWindow() uint32 {
+	if m != nil {
+		return m.Window
+	}
+	return 0
+}
+
 func init() {
 	proto.RegisterType((*CmdPackage)(nil), "v1.CmdPackage")
 	proto.RegisterEnum("v1.CmdPackage_CmdType", CmdPackage_CmdType_name, CmdPackage_CmdType_value)
@@ -265,27 +341,33 @@ var _CmdManager_serviceDesc = grpc.ServiceDesc{
 func init() { proto.RegisterFile("pkg/component/cmd/v1/api.proto", fileDescriptor0) }
 
 var fileDescriptor0 = []byte{
-	// 342 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x5c, 0x91, 0x4f, 0x6b, 0xf2, 0x40,
-	0x10, 0xc6, 0x5d, 0x13, 0x4d, 0x1c, 0x7d, 0x45, 0x86, 0x17, 0x59, 0x3c, 0x94, 0x20, 0x3d, 0x84,
-	0x52, 0x4c, 0xb5, 0x87, 0x96, 0x42, 0x0f, 0x45, 0x73, 0xe8, 0x41, 0x6b, 0x37, 0xfa, 0x01, 0xb6,
-	0x71, 0x09, 0x45, 0xf3, 0x87, 0x35, 0x86, 0xfa, 0x19, 0xfa, 0xa5, 0xcb, 0xae, 0x31, 0xa5, 0xde,
-	0x9e, 0xdf, 0x3c, 0xc3, 0xec, 0xec, 0x33, 0x70, 0x95, 0x6d, 0x23, 0x2f, 0x4c, 0xe3, 0x2c, 0x4d,
-	0x44, 0x92, 0x7b, 0x61, 0xbc, 0xf1, 0x8a, 0xb1, 0xc7, 0xb3, 0xcf, 0x51, 0x26, 0xd3, 0x3c, 0xc5,
-	0x7a, 0x31, 0x1e, 0x7e, 0x1b, 0x00, 0xd3, 0x78, 0xb3, 0xe4, 0xe1, 0x96, 0x47, 0x02, 0x11, 0xcc,
-	0xf5, 0xfa, 0x75, 0x46, 0x89, 0x43, 0xdc, 0x16, 0xd3, 0x5a, 0xd5, 0x16, 0x3c, 0x16, 0xb4, 0x7e,
-	0xaa, 0x29, 0x8d, 0x37, 0x60, 0xae, 0x8e, 0x99, 0xa0, 0x86, 0x43, 0xdc, 0xee, 0xa4, 0x3f, 0x2a,
-	0xc6, 0xa3, 0xdf, 0x29, 0x4a, 0x2a, 0x97, 0xe9, 0x1e, 0xbc, 0x05, 0xf3, 0x45, 0x46, 0x7b, 0x6a,
-	0x3a, 0x86, 0xdb, 0x9e, 0xd0, 0x8b, 0x5e, 0x65, 0xf9, 0x49, 0x2e, 0x8f, 0x4c, 0x77, 0x61, 0x1f,
-	0x9a, 0x53, 0xbe, 0xdb, 0x09, 0x49, 0x1b, 0xfa, 0xbd, 0x92, 0x70, 0x00, 0xb6, 0xff, 0x25, 0xc2,
-	0x43, 0x9e, 0x4a, 0xda, 0xd4, 0x4e, 0xc5, 0xca, 0x63, 0x62, 0x9f, 0x4d, 0xd3, 0x8d, 0xa0, 0x96,
-	0x43, 0xdc, 0x7f, 0xac, 0xe2, 0xb3, 0x37, 0xe3, 0x39, 0xa7, 0xb6, 0x43, 0xdc, 0x0e, 0xab, 0x18,
-	0x29, 0x58, 0x4a, 0xcf, 0xf7, 0x11, 0x6d, 0xe9, 0x91, 0x67, 0x54, 0x5b, 0x04, 0xb9, 0x14, 0x3c,
-	0xa6, 0xe0, 0x10, 0xd7, 0x66, 0x25, 0x0d, 0x1e, 0xa0, 0x55, 0x2d, 0x8c, 0x3d, 0x30, 0xb6, 0xe2,
-	0x58, 0x66, 0xa5, 0x24, 0xfe, 0x87, 0x46, 0xc1, 0x77, 0x87, 0x73, 0x56, 0x27, 0x78, 0xaa, 0x3f,
-	0x92, 0xe1, 0x35, 0x58, 0x65, 0x2a, 0xd8, 0x06, 0x8b, 0xf9, 0xef, 0x6b, 0x3f, 0x58, 0xf5, 0x6a,
-	0xd8, 0x01, 0x9b, 0xf9, 0xc1, 0xf2, 0x6d, 0x11, 0xf8, 0x3d, 0x32, 0x79, 0xd6, 0xc7, 0x98, 0xf3,
-	0x84, 0x47, 0x42, 0xa2, 0x07, 0xd6, 0xe9, 0x8b, 0x02, 0xbb, 0x7f, 0x53, 0x1b, 0x5c, 0xf0, 0xb0,
-	0xe6, 0x92, 0x3b, 0xf2, 0xd1, 0xd4, 0x77, 0xbd, 0xff, 0x09, 0x00, 0x00, 0xff, 0xff, 0x76, 0xf3,
-	0x03, 0xd5, 0xf9, 0x01, 0x00, 0x00,
+	// 438 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x5c, 0x92, 0x5f, 0x6f, 0xd3, 0x30,
+	0x14, 0xc5, 0xe7, 0x26, 0x6b, 0xba, 0xdb, 0xae, 0x04, 0x0b, 0x4d, 0x57, 0x7d, 0x40, 0x51, 0x9f,
+	0x22, 0x84, 0x1a, 0x5a, 0x1e, 0xf8, 0x23, 0xf1, 0x50, 0x65, 0x41, 0x42, 0x6c, 0x5d, 0x71, 0x56,
+	0xf1, 0x6c, 0x12, 0x2b, 0x9b, 0xd2, 0xfc, 0x21, 0x4d, 0x0b, 0xfd, 0x82, 0x7c, 0x2e, 0x74, 0x9d,
+	0xa4, 0x88, 0xbd, 0x9d, 0x9f, 0xcf, 0xf5, 0x89, 0x9d, 0x63, 0x78, 0x59, 0xa6, 0x89, 0x17, 0x15,
+	0x59, 0x59, 0xe4, 0x2a, 0xaf, 0xbd, 0x28, 0x8b, 0xbd, 0xc3, 0xdc, 0x93, 0xe5, 0xe3, 0xac, 0xac,
+	0x8a, 0xba, 0xe0, 0xbd, 0xc3, 0x7c, 0xfa, 0xc7, 0x04, 0xf0, 0xb3, 0x78, 0x2d, 0xa3, 0x54, 0x26,
+	0x8a, 0x73, 0x30, 0x37, 0x9b, 0x2f, 0xd7, 0xc8, 0x1c, 0xe6, 0x5e, 0x08, 0xad, 0x69, 0x6d, 0x25,
+	0x33, 0x85, 0xbd, 0x66, 0x8d, 0x34, 0x7f, 0x05, 0xe6, 0xfd, 0xb1, 0x54, 0x68, 0x38, 0xcc, 0x1d,
+	0x2f, 0xae, 0x66, 0x87, 0xf9, 0xec, 0x5f, 0x0a, 0x49, 0x72, 0x85, 0x9e, 0xe1, 0xaf, 0xc1, 0x5c,
+	0x56, 0xc9, 0x0e, 0x4d, 0xc7, 0x70, 0x87, 0x0b, 0x7c, 0x32, 0x4b, 0x56, 0x90, 0xd7, 0xd5, 0x51,
+	0xe8, 0x29, 0x7e, 0x05, 0x7d, 0x5f, 0x6e, 0xb7, 0xaa, 0xc2, 0x73, 0xfd, 0xbd, 0x96, 0xf8, 0x04,
+	0x06, 0xc1, 0x6f, 0x15, 0xed, 0xeb, 0xa2, 0xc2, 0xbe, 0x76, 0x4e, 0x4c, 0x9e, 0x50, 0xbb, 0xd2,
+	0x2f, 0x62, 0x85, 0x96, 0xc3, 0xdc, 0x4b, 0x71, 0xe2, 0xce, 0xbb, 0x96, 0xb5, 0xc4, 0x81, 0xc3,
+	0xdc, 0x91, 0x38, 0x31, 0x47, 0xb0, 0x48, 0xdf, 0xee, 0x12, 0xbc, 0xd0, 0x91, 0x1d, 0xd2, 0x29,
+	0xc2, 0xba, 0x52, 0x32, 0x43, 0x70, 0x98, 0x3b, 0x10, 0x2d, 0xd1, 0x8e, 0xb5, 0x3c, 0x6e, 0x0b,
+	0x19, 0xe3, 0x50, 0x87, 0x75, 0x48, 0x0e, 0xdd, 0x76, 0x23, 0x6e, 0x70, 0xd4, 0x64, 0xb5, 0x48,
+	0x8e, 0xff, 0xb0, 0xcf, 0x53, 0x15, 0xe3, 0xa5, 0x0e, 0xeb, 0x90, 0xdb, 0x60, 0x84, 0xea, 0x27,
+	0x8e, 0x1d, 0xe6, 0x9a, 0x82, 0x24, 0x9d, 0xd6, 0x7f, 0x50, 0x51, 0xba, 0xdb, 0x67, 0xf8, 0xac,
+	0xb9, 0x49, 0xc7, 0x34, 0x1d, 0xdc, 0x7d, 0x46, 0x5b, 0x67, 0x90, 0xa4, 0x53, 0x7e, 0x7f, 0xcc,
+	0xe3, 0xe2, 0x17, 0x3e, 0xd7, 0xb3, 0x2d, 0x4d, 0xde, 0xc1, 0xc5, 0xe9, 0xb7, 0xd2, 0xb6, 0x54,
+	0x1d, 0xdb, 0x46, 0x49, 0xf2, 0x17, 0x70, 0x7e, 0x90, 0xdb, 0x7d, 0xd7, 0x68, 0x03, 0x1f, 0x7b,
+	0xef, 0xd9, 0xf4, 0x03, 0x58, 0x6d, 0x77, 0x7c, 0x08, 0x96, 0x08, 0xbe, 0x6d, 0x82, 0xf0, 0xde,
+	0x3e, 0xe3, 0x23, 0x18, 0x88, 0x20, 0x5c, 0xdf, 0xad, 0xc2, 0xc0, 0x66, 0x1c, 0xa0, 0xef, 0x2f,
+	0x57, 0x7e, 0x70, 0x63, 0xf7, 0xb8, 0x05, 0xc6, 0xd2, 0xff, 0x6a, 0x1b, 0x8b, 0x4f, 0xfa, 0x1d,
+	0xdd, 0xca, 0x5c, 0x26, 0xaa, 0xe2, 0x1e, 0x58, 0x4d, 0x3b, 0x8a, 0x8f, 0xff, 0x2f, 0x7c, 0xf2,
+	0x84, 0xa7, 0x67, 0x2e, 0x7b, 0xc3, 0x7e, 0xf4, 0xf5, 0x93, 0x7c, 0xfb, 0x77, 0x00, 0xbd, 0x44,
+	0xa7, 0xa1, 0xb4, 0x02, 0x00, 0x00,
 }
@@ -0,0 +1,196 @@
+package conns
+
+import (
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"code.xxxxx.cn/platform/galaxy/pkg/util/alog"
+)
+
+// DefaultCertReloadPeriod default period to check if certificate files modified
+const DefaultCertReloadPeriod = time.Minute
+
+// CertReloader hold the certificate and ca pool loaded from files, and reload them when files modified,
+// the tls configs built by it use the latest ones for new handshakes, the established connections are kept
+type CertReloader struct {
+	name  string
+	files []string
+	load  func() (tls.Certificate, *x509.CertPool, error)
+
+	lock     sync.RWMutex
+	cert     *tls.Certificate
+	pool     *x509.CertPool
+	modTimes map[string]time.Time
+}
+
+// NewPKCS12Reloader build a CertReloader of p12 file which contains the certificate, private key and ca
+func NewPKCS12Reloader(p12File string) (*CertReloader, error) {
+	return newCertReloader(p12File, []string{p12File}, func() (tls.Certificate, *x509.CertPool, error) {
+		return ReadPKCS12(p12File)
+	})
+}
+
+// NewKeyPairReloader build a CertReloader of pem encoded certificate, private key and ca files, caFile is optional
+func NewKeyPairReloader(certFile, keyFile, caFile string) (*CertReloader, error) {
+	files := []string{certFile, keyFile}
+	if caFile != "" {
+		files = append(files, caFile)
+	}
+	return newCertReloader(certFile, files, func() (tls.Certificate, *x509.CertPool, error) {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return tls.Certificate{}, nil, fmt.Errorf("load key pair failed: %v", err)
+		}
+		if caFile == "" {
+			return cert, nil, nil
+		}
+		caCrt, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return tls.Certificate{}, nil, fmt.Errorf("read ca file failed: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caCrt) {
+			return tls.Certificate{}, nil, fmt.Errorf("no certificate found in ca file %s", caFile)
+		}
+		return cert, pool, nil
+	})
+}
+
+func newCertReloader(name string, files []string, load func() (tls.Certificate, *x509.CertPool, error)) (*CertReloader, error) {
+	r := &CertReloader{name: name, files: files, load: load}
+	if _, err := r.reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Watch check the files every period and reload them if modified until stopCh closed
+func (r *CertReloader) Watch(period time.Duration, stopCh <-chan struct{}) {
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C:
+		}
+		if _, err := r.reload(); err != nil {
+			alog.Errorf("Reload certificate %s failed, keep using the current one: %v", r.name, err)
+		}
+	}
+}
+
+// reload load the files if any of them modified since last loaded, return true if reloaded
+func (r *CertReloader) reload() (bool, error) {
+	modTimes := make(map[string]time.Time, len(r.files))
+	for _, file := range r.files {
+		info, err := os.Stat(file)
+		if err != nil {
+			return false, err
+		}
+		modTimes[file] = info.ModTime()
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.cert != nil && !modified(r.modTimes, modTimes) {
+		return false, nil
+	}
+	cert, pool, err := r.load()
+	if err != nil {
+		return false, err
+	}
+	r.cert, r.pool, r.modTimes = &cert, pool, modTimes
+
+	expiry := certExpiry(&cert)
+	CertExpiry.WithLabelValues(r.name).Set(float64(expiry.Unix()))
+	alog.Infof("Loaded certificate %s from %s, expires at %s", r.name, strings.Join(r.files, ","), expiry)
+	return true, nil
+}
+
+// modified check if any file modified
+func modified(old, now map[string]time.Time) bool {
+	for file, t := range now {
+		if !old[file].Equal(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// certExpiry return the expiry time of the leaf certificate
+func certExpiry(cert *tls.Certificate) time.Time {
+	if cert.Leaf != nil {
+		return cert.Leaf.NotAfter
+	}
+	if len(cert.Certificate) == 0 {
+		return time.Time{}
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return time.Time{}
+	}
+	return leaf.NotAfter
+}
+
+// current return the active certificate and ca pool
+func (r *CertReloader) current() (*tls.Certificate, *x509.CertPool) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	return r.cert, r.pool
+}
+
+// GetCertificate return the active certificate for server handshakes
+func (r *CertReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	cert, _ := r.current()
+	return cert, nil
+}
+
+// GetClientCertificate return the active certificate for client handshakes
+func (r *CertReloader) GetClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	cert, _ := r.current()
+	return cert, nil
+}
+
+// ClientTLSConfig build the tls config to dial serverName, files are reloaded if modified,
+// call it for every dial as the ca pool can not be changed after the config built
+func (r *CertReloader) ClientTLSConfig(serverName string) *tls.Config {
+	if _, err := r.reload(); err != nil {
+		alog.Errorf("Reload certificate %s failed, keep using the current one: %v", r.name, err)
+	}
+	_, pool := r.current()
+	return &tls.Config{
+		GetClientCertificate: r.GetClientCertificate,
+		InsecureSkipVerify:   false,
+		RootCAs:              pool,
+		ServerName:           serverName,
+	}
+}
+
+// ServerTLSConfig build the tls config of server requires and verifies client certificates by the active ca pool
+func (r *CertReloader) ServerTLSConfig(serverName string) *tls.Config {
+	build := func() *tls.Config {
+		_, pool := r.current()
+		return &tls.Config{
+			ClientAuth:     tls.RequireAndVerifyClientCert,
+			GetCertificate: r.GetCertificate,
+			ClientCAs:      pool,
+			Rand:           rand.Reader,
+			ServerName:     serverName,
+			// grpc requires http2 negotiated by alpn
+			NextProtos: []string{"h2"},
+		}
+	}
+	config := build()
+	config.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		return build(), nil
+	}
+	return config
+}
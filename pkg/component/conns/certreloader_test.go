@@ -0,0 +1,109 @@
+package conns
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeSelfSignedCert write a self-signed certificate of serverName and its key to dir, the certificate is its ca
+func writeSelfSignedCert(t *testing.T, dir, serverName string, serial int64, modTime time.Time) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(serial),
+		Subject:               pkix.Name{CommonName: serverName},
+		DNSNames:              []string{serverName},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Duration(serial) * time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	for file, block := range map[string]*pem.Block{
+		certFile: {Type: "CERTIFICATE", Bytes: der},
+		keyFile:  {Type: "EC PRIVATE KEY", Bytes: keyDer},
+	} {
+		if err := ioutil.WriteFile(file, pem.EncodeToMemory(block), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(file, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return certFile, keyFile
+}
+
+// handshake return the serial number of server certificate after handshake succeed
+func handshake(server, client *tls.Config) (*big.Int, error) {
+	sc, cc := net.Pipe()
+	defer sc.Close()
+	defer cc.Close()
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- tls.Server(sc, server).Handshake()
+	}()
+	conn := tls.Client(cc, client)
+	if err := conn.Handshake(); err != nil {
+		return nil, err
+	}
+	if err := <-errCh; err != nil {
+		return nil, err
+	}
+	return conn.ConnectionState().PeerCertificates[0].SerialNumber, nil
+}
+
+func TestCertReloader(t *testing.T) {
+	dir, err := ioutil.TempDir("", "certreloader")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	now := time.Now()
+	certFile, keyFile := writeSelfSignedCert(t, dir, ManagerAddrDN, 1, now)
+	r, err := NewKeyPairReloader(certFile, keyFile, certFile)
+	if err != nil {
+		t.Fatalf("new reloader failed: %v", err)
+	}
+	server := r.ServerTLSConfig(ManagerAddrDN)
+	if serial, err := handshake(server, r.ClientTLSConfig(ManagerAddrDN)); err != nil || serial.Int64() != 1 {
+		t.Fatalf("expect handshake with certificate 1, got %v, err %v", serial, err)
+	}
+
+	// rotate the certificate and ca, the server config built before serves the new one
+	writeSelfSignedCert(t, dir, ManagerAddrDN, 2, now.Add(time.Second))
+	if reloaded, err := r.reload(); err != nil || !reloaded {
+		t.Fatalf("expect certificate reloaded, got %t, err %v", reloaded, err)
+	}
+	if serial, err := handshake(server, r.ClientTLSConfig(ManagerAddrDN)); err != nil || serial.Int64() != 2 {
+		t.Errorf("expect handshake with certificate 2, got %v, err %v", serial, err)
+	}
+	if reloaded, err := r.reload(); err != nil || reloaded {
+		t.Errorf("expect certificate not reloaded if not modified, got %t, err %v", reloaded, err)
+	}
+}
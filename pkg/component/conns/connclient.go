@@ -40,6 +40,14 @@ type ClientConfig struct {
 	Cert       string
 	ServerName string
 	Creds      credentials.TransportCredentials
+	// Reloader reload the certificate of Cert, Creds is rebuilt by it for every dial if not nil
+	Reloader *CertReloader
+	// Reconnect is the backoff and keepalive policy to connect to Addr
+	Reconnect ReconnectPolicy
+	// Priority of Addr, the connection fails back to the healthy one with the lowest priority value
+	Priority int
+	// Weight of Addr to select from the ones with the same priority
+	Weight int
 }
 
 // GlobalConn define connection actions of client
@@ -55,6 +63,8 @@ type GlobalConn interface {
 	ConnMonitor(stopCh <-chan struct{})
 	RegisterMonitorConn(addr, certFile, serverName string) error
 	AddClientQueue(addr, certFile, serverName string) error
+	// WatchDiscovery replace client queue by endpoints resolved by discovery every period until stopCh closed
+	WatchDiscovery(d Discovery, period time.Duration, stopCh <-chan struct{})
 	ConnOnStates(stats ...connectivity.State) <-chan struct{}
 	ConnOnReady() <-chan struct{}
 
@@ -69,24 +79,20 @@ func NewGlobalConn(queue ...*ClientConfig) GlobalConn {
 	}
 }
 
-// NewClientConfig create a ClientConfig
+// NewClientConfig create a ClientConfig, the p12 certFile is reloaded when modified before dialing
 func NewClientConfig(addr, certFile, serverName string) (*ClientConfig, error) {
-	cert, certPool, err := ReadPKCS12(certFile)
+	reloader, err := NewPKCS12Reloader(certFile)
 	if err != nil {
 		return nil, fmt.Errorf("read p12 file failed: %v", err)
 	}
 
-	creds := credentials.NewTLS(&tls.Config{
-		Certificates:       []tls.Certificate{cert},
-		InsecureSkipVerify: false,
-		RootCAs:            certPool,
-		ServerName:         serverName,
-	})
 	return &ClientConfig{
 		Addr:       addr,
 		Cert:       certFile,
 		ServerName: serverName,
-		Creds:      creds,
+		Creds:      credentials.NewTLS(reloader.ClientTLSConfig(serverName)),
+		Reloader:   reloader,
+		Reconnect:  NewDefaultReconnectPolicy(),
 	}, nil
 }
 
@@ -137,6 +143,9 @@ func (c *globalClientConn) RegisterMonitorConn(addr, certFile, serverName string
 	if err != nil {
 		return err
 	}
+	if len(c.clientQueue) > 0 {
+		cc.Priority = c.clientQueue[0].Priority - 1
+	}
 	var queue []*ClientConfig
 	queue = append(queue, cc)
 	queue = append(queue, c.clientQueue...)
@@ -157,6 +166,9 @@ func (c *globalClientConn) AddClientQueue(addr, certFile, serverName string) err
 	if err != nil {
 		return err
 	}
+	if n := len(c.clientQueue); n > 0 {
+		cc.Priority = c.clientQueue[n-1].Priority + 1
+	}
 	c.clientQueue = append(c.clientQueue, cc)
 	return nil
 }
@@ -178,7 +190,8 @@ func (c *globalClientConn) GetClientQueue() []*ClientConfig {
 	return c.clientQueue
 }
 
-// PollConn poll conn
+// PollConn block until connected to any server in queue, wait for a backoff interval with jitter
+// between two rounds of dialing, so servers are not hammered by all clients when they are down
 func (c *globalClientConn) PollConn() {
 	alog.Infof("Wait for active connection...")
 	if c.IsActive() {
@@ -188,8 +201,10 @@ func (c *globalClientConn) PollConn() {
 	if err := c.CloseConn(); err != nil {
 		alog.Errorf("Close connection %s failed: %v", c.GetConn().Target(), err)
 	}
-	for {
-		for _, cli := range c.GetClientQueue() {
+	for attempt := 0; ; attempt++ {
+		queue := c.GetClientQueue()
+		for _, cli := range queue {
+			GRPCDialAttempts.WithLabelValues(cli.Addr).Inc()
 			conn, err := dialGRPCConn(cli)
 			if err == nil {
 				alog.Infof("Connected to %s", cli.Addr)
@@ -197,48 +212,113 @@ func (c *globalClientConn) PollConn() {
 				close(c.readyCh)
 				return
 			}
+			GRPCDialFailures.WithLabelValues(cli.Addr).Inc()
 			alog.Errorf("Connect to %s failed: %v", cli.Addr, err)
 		}
+
+		policy := NewDefaultReconnectPolicy()
+		if len(queue) > 0 {
+			policy = queue[0].Reconnect
+		}
+		backoff := policy.Backoff(attempt)
+		alog.Warningf("Connect to all %d servers failed, retry after %s", len(queue), backoff)
+		time.Sleep(backoff)
 	}
 }
 
+// ConnMonitor check the connection every period, fail back to the healthy server with the highest priority
 func (c *globalClientConn) ConnMonitor(stopCh <-chan struct{}) {
+	ticker := time.NewTicker(defaultMonitorPeriod)
+	defer ticker.Stop()
 	for {
+		c.failback()
 		select {
 		case <-stopCh:
 			return
-		default:
+		case <-ticker.C:
 		}
+	}
+}
 
-		t := time.NewTimer(defaultMonitorPeriod)
-		monitorCli := c.GetMonitorConn() // monitoring the first conn
-		alog.V(4).Infof("==> Monitor connection: %s, current: %s", monitorCli.Addr, c.GetConn().Target())
-		oldConn := c.GetConn()
-		if oldConn.Target() != monitorCli.Addr {
-			// if is not the first client, reconnect and switch conn
-			if err := c.ReConn(monitorCli); err != nil {
-				// reconnect failed
-				alog.Errorf("==> Failed connection: %s: %v", monitorCli.Addr, err)
-				continue
-			} else {
-				// reconnect succeed, close old connection
-				if err := oldConn.Close(); err != nil {
-					alog.Errorf("==> Close old connection %s failed: %v", oldConn.Target(), err)
-				}
-				alog.V(4).Infof("==> Switched connection: %s -> %s", oldConn.Target(), monitorCli.Addr)
-			}
-		} else {
-			alog.V(4).Infof("==> Connection %s is active, no need to reconnect", monitorCli.Addr)
+// failback switch connection to the first server in queue which is preferred to the current one and healthy,
+// the servers with the same priority as current one are not switched to
+func (c *globalClientConn) failback() {
+	oldConn := c.GetConn()
+	if oldConn == nil {
+		return
+	}
+	queue := c.GetClientQueue()
+	var current *ClientConfig
+	for _, cli := range queue {
+		if cli.Addr == oldConn.Target() {
+			current = cli
+			break
+		}
+	}
+	for _, cli := range queue {
+		if current != nil && cli.Priority >= current.Priority {
+			alog.V(4).Infof("==> Connection %s is active, no need to reconnect", current.Addr)
+			return
+		}
+		if err := c.ReConn(cli); err != nil {
+			alog.Errorf("==> Failed connection: %s: %v", cli.Addr, err)
+			continue
+		}
+		// reconnect succeed, close old connection
+		if err := oldConn.Close(); err != nil {
+			alog.Errorf("==> Close old connection %s failed: %v", oldConn.Target(), err)
 		}
+		alog.V(4).Infof("==> Switched connection: %s -> %s", oldConn.Target(), cli.Addr)
+		return
+	}
+}
 
+// WatchDiscovery resolve endpoints every period, replace client queue by them sorted by priority and weight,
+// the first client config in queue is the template of cert and policy, the queue is kept if nothing resolved
+func (c *globalClientConn) WatchDiscovery(d Discovery, period time.Duration, stopCh <-chan struct{}) {
+	template := c.GetMonitorConn()
+	if template == nil {
+		alog.Errorf("No client config as template of discovered endpoints")
+		return
+	}
+	if period <= 0 {
+		period = DefaultDiscoveryPeriod
+	}
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+	for {
+		endpoints, err := d.Endpoints()
+		if err != nil {
+			alog.Errorf("Discover endpoints of servers failed: %v", err)
+		} else if len(endpoints) == 0 {
+			alog.Warningf("No endpoints of servers discovered, keep the current ones")
+		} else {
+			c.updateClientQueue(*template, sortEndpoints(endpoints))
+		}
 		select {
 		case <-stopCh:
 			return
-		case <-t.C:
+		case <-ticker.C:
 		}
 	}
 }
 
+// updateClientQueue replace client queue by endpoints, the other fields of client configs are copied from template
+func (c *globalClientConn) updateClientQueue(template ClientConfig, endpoints []Endpoint) {
+	queue := make([]*ClientConfig, 0, len(endpoints))
+	var addrs []string
+	for _, e := range endpoints {
+		cli := template
+		cli.Addr, cli.Priority, cli.Weight = e.Addr, e.Priority, e.Weight
+		queue = append(queue, &cli)
+		addrs = append(addrs, e.Addr)
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.clientQueue = queue
+	alog.V(4).Infof("Updated client queue: %v", addrs)
+}
+
 func (c *globalClientConn) GetCmdManagerClient() pb.CmdManagerClient {
 	c.lock.RLock()
 	defer c.lock.RUnlock()
@@ -300,18 +380,13 @@ func (c *globalClientConn) CloseConn() error {
 }
 
 func dialGRPCConn(cli *ClientConfig) (*grpc.ClientConn, error) {
-	// FIXME NOW EXPERIMENTAL make configurable?
-	//var kacp = keepalive.ClientParameters{
-	//	Time:                10 * time.Second, // send pings every 10 seconds if there is no activity
-	//	Timeout:             time.Second,      // wait 1 second for ping ack before considering the connection dead
-	//	PermitWithoutStream: true,             // send pings even without active streams
-	//}
-	opts := []grpc.DialOption{
-		grpc.WithBlock(), /*grpc.WithKeepaliveParams(kacp)*/
-	}
+	opts := []grpc.DialOption{grpc.WithBlock()}
+	opts = append(opts, cli.Reconnect.dialOptions()...)
 	ctx, cancel := context.WithTimeout(context.Background(), defaultConnectTimeout)
 	defer cancel()
-	if len(cli.Cert) != 0 {
+	if cli.Reloader != nil {
+		opts = append(opts, grpc.WithTransportCredentials(credentials.NewTLS(cli.Reloader.ClientTLSConfig(cli.ServerName))))
+	} else if len(cli.Cert) != 0 {
 		opts = append(opts, grpc.WithTransportCredentials(cli.Creds))
 	} else {
 		opts = append(opts, grpc.WithInsecure())
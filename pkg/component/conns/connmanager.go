@@ -4,6 +4,8 @@ import (
 	"context"
 	"fmt"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"code.xxxxx.cn/platform/galaxy/pkg/util/alog"
 	"google.golang.org/grpc/stats"
@@ -14,6 +16,8 @@ var mgr *ConnManager
 func init() {
 	mgr = &ConnManager{
 		conns:           make(map[*stats.ConnTagInfo]*Conn),
+		keys:            make(map[string]*Conn),
+		labels:          make(map[string]map[string]map[*Conn]struct{}),
 		onReadyFuncs:    []func(conn *Conn){},
 		onNotReadyFuncs: []func(conn *Conn){},
 	}
@@ -27,8 +31,12 @@ type OnBreakFunc func(key string, tag *stats.ConnTagInfo) error
 
 // ConnManager hold all grpc connections, cache every connection and add/delete/update them
 type ConnManager struct {
-	lock            sync.RWMutex
-	conns           map[*stats.ConnTagInfo]*Conn
+	lock  sync.RWMutex
+	conns map[*stats.ConnTagInfo]*Conn
+	// keys index the registered connections by key
+	keys map[string]*Conn
+	// labels index the registered connections by label key, label value of the indexed info labels
+	labels          map[string]map[string]map[*Conn]struct{}
 	onReadyFuncs    []func(conn *Conn)
 	onNotReadyFuncs []func(conn *Conn)
 }
@@ -38,10 +46,51 @@ type Conn struct {
 	Key   string
 	Info  map[string]string
 	Value interface{}
+	// ConnectedAt is the time the underlying connection established
+	ConnectedAt time.Time
+	// RegisteredAt is the time the connection saved with key
+	RegisteredAt time.Time
+	// RemoteAddr is the address of peer
+	RemoteAddr string
+
+	// lastActive is the unix nano of the last payload sent or received, updated atomically
+	lastActive int64
+	// cancel close the stream of connection saved, nil if it can not be closed
+	cancel context.CancelFunc
 }
 
 type connCtxKey struct{}
 
+// copy return a copy of conn with a copied info map
+func (c *Conn) copy() *Conn {
+	info := make(map[string]string, len(c.Info))
+	for k, v := range c.Info {
+		info[k] = v
+	}
+	return &Conn{
+		Key:          c.Key,
+		Info:         info,
+		Value:        c.Value,
+		ConnectedAt:  c.ConnectedAt,
+		RegisteredAt: c.RegisteredAt,
+		RemoteAddr:   c.RemoteAddr,
+		lastActive:   atomic.LoadInt64(&c.lastActive),
+	}
+}
+
+// LastActive return the time of the last payload sent or received by the connection
+func (c *Conn) LastActive() time.Time {
+	if n := atomic.LoadInt64(&c.lastActive); n > 0 {
+		return time.Unix(0, n)
+	}
+	return c.ConnectedAt
+}
+
+// touch record the connection is active now
+func (c *Conn) touch() {
+	atomic.StoreInt64(&c.lastActive, time.Now().UnixNano())
+}
+
 // NewConnManager return init mgr instance
 func NewConnManager() *ConnManager {
 	return mgr
@@ -52,10 +101,8 @@ func (cm *ConnManager) GetConnValue(key string) (interface{}, error) {
 	mgr.lock.RLock()
 	defer mgr.lock.RUnlock()
 
-	for _, conn := range mgr.conns {
-		if conn.Key == key {
-			return conn.Value, nil
-		}
+	if conn, ok := mgr.keys[key]; ok {
+		return conn.Value, nil
 	}
 	return nil, fmt.Errorf("conn of Key %q not found", key)
 }
@@ -65,15 +112,146 @@ func (cm *ConnManager) GetConnInfo(key string) (map[string]string, error) {
 	mgr.lock.RLock()
 	defer mgr.lock.RUnlock()
 
+	if conn, ok := mgr.keys[key]; ok {
+		return conn.Info, nil
+	}
+	return nil, fmt.Errorf("conn of Key %s not found", key)
+}
+
+// GetConn return a copy of the registered connection by the key
+func (cm *ConnManager) GetConn(key string) (*Conn, error) {
+	mgr.lock.RLock()
+	defer mgr.lock.RUnlock()
+
+	if conn, ok := mgr.keys[key]; ok {
+		return conn.copy(), nil
+	}
+	return nil, fmt.Errorf("conn of Key %q not found", key)
+}
+
+// ListConns return copies of all registered connections matched by filter, filter nil means all
+func (cm *ConnManager) ListConns(filter func(conn *Conn) bool) []*Conn {
+	mgr.lock.RLock()
+	defer mgr.lock.RUnlock()
+
+	var list []*Conn
 	for _, conn := range mgr.conns {
-		if conn.Key == key {
-			return conn.Info, nil
+		// skip connections not registered
+		if conn.Key == "" {
+			continue
+		}
+		c := conn.copy()
+		if filter == nil || filter(c) {
+			list = append(list, c)
 		}
 	}
-	return nil, fmt.Errorf("conn of Key %s not found", key)
+	return list
+}
+
+// IndexLabels index the registered connections by the info labels, so ListConnsByLabels of them
+// no longer scan all connections
+func (cm *ConnManager) IndexLabels(keys ...string) {
+	mgr.lock.Lock()
+	defer mgr.lock.Unlock()
+
+	for _, k := range keys {
+		if _, ok := mgr.labels[k]; ok {
+			continue
+		}
+		mgr.labels[k] = make(map[string]map[*Conn]struct{})
+		for _, conn := range mgr.keys {
+			if v, ok := conn.Info[k]; ok {
+				mgr.indexLabel(k, v, conn)
+			}
+		}
+	}
+}
+
+// ListConnsByLabels return copies of the registered connections whose info contains all the labels,
+// connections are looked up by the index if any of the labels indexed, empty labels means all
+func (cm *ConnManager) ListConnsByLabels(labels map[string]string) []*Conn {
+	mgr.lock.RLock()
+	defer mgr.lock.RUnlock()
+
+	// start from the smallest indexed set, or all registered connections
+	var candidates map[*Conn]struct{}
+	indexed := false
+	for k, v := range labels {
+		values, ok := mgr.labels[k]
+		if !ok {
+			continue
+		}
+		if set := values[v]; !indexed || len(set) < len(candidates) {
+			candidates, indexed = set, true
+		}
+	}
+	if !indexed {
+		candidates = make(map[*Conn]struct{}, len(mgr.keys))
+		for _, conn := range mgr.keys {
+			candidates[conn] = struct{}{}
+		}
+	}
+
+	var list []*Conn
+	for conn := range candidates {
+		if matchLabels(conn.Info, labels) {
+			list = append(list, conn.copy())
+		}
+	}
+	return list
+}
+
+// matchLabels return true if info contains all labels
+func matchLabels(info, labels map[string]string) bool {
+	for k, v := range labels {
+		if value, ok := info[k]; !ok || value != v {
+			return false
+		}
+	}
+	return true
 }
 
-// GetConnFromContext return the connection of grpc by context
+// Disconnect close the stream of the registered connection by the key, the executor will reconnect
+func (cm *ConnManager) Disconnect(key string) error {
+	mgr.lock.RLock()
+	conn, ok := mgr.keys[key]
+	mgr.lock.RUnlock()
+
+	if !ok {
+		return fmt.Errorf("conn of Key %q not found", key)
+	}
+	if conn.cancel == nil {
+		return fmt.Errorf("conn of Key %q can not be disconnected", key)
+	}
+	conn.cancel()
+	return nil
+}
+
+// UpdateConnInfo merge info into the info data of connection by the key, the info map is replaced
+// instead of updated in place, the maps returned by GetConnInfo before are never changed
+func (cm *ConnManager) UpdateConnInfo(key string, info map[string]string) error {
+	mgr.lock.Lock()
+	defer mgr.lock.Unlock()
+
+	conn, ok := mgr.keys[key]
+	if !ok {
+		return fmt.Errorf("conn of Key %q not found", key)
+	}
+	mgr.unindex(conn)
+	// copy on write, as the info map may be read by others without lock
+	merged := make(map[string]string, len(conn.Info)+len(info))
+	for k, v := range conn.Info {
+		merged[k] = v
+	}
+	for k, v := range info {
+		merged[k] = v
+	}
+	conn.Info = merged
+	mgr.index(conn)
+	return nil
+}
+
+// GetConnFromContext return a copy of the connection of grpc by context, nil if not found
 func (cm *ConnManager) GetConnFromContext(ctx context.Context) (*Conn, error) {
 	tag, err := getConnTagFromContext(ctx)
 	if err != nil {
@@ -82,11 +260,19 @@ func (cm *ConnManager) GetConnFromContext(ctx context.Context) (*Conn, error) {
 	mgr.lock.RLock()
 	defer mgr.lock.RUnlock()
 
-	return mgr.conns[tag], nil
+	if conn, ok := mgr.conns[tag]; ok {
+		return conn.copy(), nil
+	}
+	return nil, nil
 }
 
 // SaveConn save the connection of grpc
 func (cm *ConnManager) SaveConn(ctx context.Context, key string, infoData map[string]string, value interface{}) error {
+	return cm.SaveConnWithCancel(ctx, key, infoData, value, nil)
+}
+
+// SaveConnWithCancel save the connection of grpc, cancel is called to close the stream when Disconnect
+func (cm *ConnManager) SaveConnWithCancel(ctx context.Context, key string, infoData map[string]string, value interface{}, cancel context.CancelFunc) error {
 	tag, err := getConnTagFromContext(ctx)
 	if err != nil {
 		return err
@@ -95,15 +281,21 @@ func (cm *ConnManager) SaveConn(ctx context.Context, key string, infoData map[st
 	mgr.lock.Lock()
 	defer mgr.lock.Unlock()
 
-	conn := &Conn{Key: key, Info: infoData, Value: value}
+	conn := &Conn{Key: key, Info: infoData, Value: value, RegisteredAt: time.Now(), cancel: cancel}
+	if old, ok := mgr.conns[tag]; ok {
+		mgr.unindex(old)
+		conn.ConnectedAt, conn.RemoteAddr = old.ConnectedAt, old.RemoteAddr
+	}
+	conn.touch()
 	mgr.conns[tag] = conn
+	mgr.index(conn)
 
-	// call listener func
-	go func(c *Conn) {
-		for _, f := range cm.onReadyFuncs {
+	// call listener func with a copy, as the conn may be updated by UpdateConnInfo at the same time
+	go func(c *Conn, funcs []func(conn *Conn)) {
+		for _, f := range funcs {
 			f(c)
 		}
-	}(conn)
+	}(conn.copy(), cm.onReadyFuncs)
 
 	return nil
 }
@@ -140,19 +332,24 @@ func (cm *ConnManager) HandleConn(ctx context.Context, s stats.ConnStats) {
 
 	switch s.(type) {
 	case *stats.ConnBegin:
-		cm.conns[tag] = &Conn{}
+		conn := &Conn{ConnectedAt: time.Now()}
+		if tag.RemoteAddr != nil {
+			conn.RemoteAddr = tag.RemoteAddr.String()
+		}
+		cm.conns[tag] = conn
 		alog.V(4).Infof("......Start conn, now connections number: %d", len(cm.conns))
 	case *stats.ConnEnd:
 		key := cm.conns[tag].Key
 		alog.V(4).Infof("......Stop conn %s, now connections number: %d", key, len(cm.conns))
 
 		// call listener func
-		go func(c *Conn) {
-			for _, f := range cm.onNotReadyFuncs {
+		go func(c *Conn, funcs []func(conn *Conn)) {
+			for _, f := range funcs {
 				f(c)
 			}
-		}(cm.conns[tag])
+		}(cm.conns[tag].copy(), cm.onNotReadyFuncs)
 
+		cm.unindex(cm.conns[tag])
 		delete(cm.conns, tag)
 	default:
 		alog.V(4).Infof("Invalid conn type")
@@ -165,8 +362,74 @@ func (cm *ConnManager) TagRPC(ctx context.Context, info *stats.RPCTagInfo) conte
 	return ctx
 }
 
-// HandleRPC handle every grpc call
-func (cm *ConnManager) HandleRPC(ctx context.Context, s stats.RPCStats) {}
+// HandleRPC handle every grpc call, record the activity of connection when payload sent or received
+func (cm *ConnManager) HandleRPC(ctx context.Context, s stats.RPCStats) {
+	switch s.(type) {
+	case *stats.InPayload, *stats.OutPayload:
+	default:
+		return
+	}
+	tag, err := getConnTagFromContext(ctx)
+	if err != nil {
+		return
+	}
+	cm.lock.RLock()
+	conn, ok := cm.conns[tag]
+	cm.lock.RUnlock()
+	if ok {
+		conn.touch()
+	}
+}
+
+// index add the registered conn to the key index and label indexes, must be called with lock held
+func (cm *ConnManager) index(conn *Conn) {
+	if conn == nil || conn.Key == "" {
+		return
+	}
+	cm.keys[conn.Key] = conn
+	for k := range cm.labels {
+		if v, ok := conn.Info[k]; ok {
+			cm.indexLabel(k, v, conn)
+		}
+	}
+}
+
+// indexLabel add conn to the index of label k=v, must be called with lock held
+func (cm *ConnManager) indexLabel(k, v string, conn *Conn) {
+	set, ok := cm.labels[k][v]
+	if !ok {
+		set = make(map[*Conn]struct{})
+		cm.labels[k][v] = set
+	}
+	set[conn] = struct{}{}
+}
+
+// unindex remove conn from the key index and label indexes, must be called with lock held
+func (cm *ConnManager) unindex(conn *Conn) {
+	if conn == nil || conn.Key == "" {
+		return
+	}
+	// the key may be taken over by a newer connection, or fall back to an older one still alive
+	if cm.keys[conn.Key] == conn {
+		delete(cm.keys, conn.Key)
+		for _, c := range cm.conns {
+			if c != conn && c.Key == conn.Key {
+				cm.keys[c.Key] = c
+				break
+			}
+		}
+	}
+	for k, values := range cm.labels {
+		v, ok := conn.Info[k]
+		if !ok {
+			continue
+		}
+		delete(values[v], conn)
+		if len(values[v]) == 0 {
+			delete(values, v)
+		}
+	}
+}
 
 // getConnTagFromContext return the tag of connection by context
 func getConnTagFromContext(ctx context.Context) (*stats.ConnTagInfo, error) {
@@ -0,0 +1,73 @@
+package conns
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"google.golang.org/grpc/stats"
+)
+
+func TestConnManagerIndex(t *testing.T) {
+	// use a fresh manager instead of the global one shared by other tests
+	old := mgr
+	defer func() { mgr = old }()
+	mgr = &ConnManager{
+		conns:  make(map[*stats.ConnTagInfo]*Conn),
+		keys:   make(map[string]*Conn),
+		labels: make(map[string]map[string]map[*Conn]struct{}),
+	}
+	cm := NewConnManager()
+	cm.IndexLabels("site")
+
+	connect := func(key, site string) (context.Context, context.CancelFunc) {
+		tag := &stats.ConnTagInfo{RemoteAddr: &net.TCPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 1234}}
+		ctx := cm.TagConn(context.Background(), tag)
+		cm.HandleConn(ctx, &stats.ConnBegin{})
+		ctx, cancel := context.WithCancel(ctx)
+		if err := cm.SaveConnWithCancel(ctx, key, map[string]string{"site": site}, key, cancel); err != nil {
+			t.Fatal(err)
+		}
+		return ctx, cancel
+	}
+	ctxA, _ := connect("a", "s1")
+	ctxB, _ := connect("b", "s1")
+	connect("c", "s2")
+
+	if v, err := cm.GetConnValue("b"); err != nil || v != "b" {
+		t.Fatalf("expect value of b, got %v %v", v, err)
+	}
+	if list := cm.ListConnsByLabels(map[string]string{"site": "s1"}); len(list) != 2 {
+		t.Fatalf("expect 2 connections of site s1, got %d", len(list))
+	}
+	conn, err := cm.GetConn("a")
+	if err != nil || conn.RemoteAddr != "10.0.0.1:1234" || conn.ConnectedAt.IsZero() || conn.LastActive().IsZero() {
+		t.Fatalf("expect connection details recorded, got %+v %v", conn, err)
+	}
+
+	// relabel b to s2, the label index follows
+	if err := cm.UpdateConnInfo("b", map[string]string{"site": "s2"}); err != nil {
+		t.Fatal(err)
+	}
+	if list := cm.ListConnsByLabels(map[string]string{"site": "s2"}); len(list) != 2 {
+		t.Fatalf("expect 2 connections of site s2, got %d", len(list))
+	}
+
+	// disconnect cancel the stream of a, and the connection is removed when it ends
+	if err := cm.Disconnect("a"); err != nil {
+		t.Fatal(err)
+	}
+	if ctxA.Err() == nil || ctxB.Err() != nil {
+		t.Fatalf("expect only stream of a cancelled")
+	}
+	cm.HandleConn(ctxA, &stats.ConnEnd{})
+	if _, err := cm.GetConn("a"); err == nil {
+		t.Errorf("expect connection a removed")
+	}
+	if list := cm.ListConnsByLabels(map[string]string{"site": "s1"}); len(list) != 0 {
+		t.Errorf("expect no connections of site s1, got %d", len(list))
+	}
+	if err := cm.Disconnect("a"); err == nil {
+		t.Errorf("expect disconnect unknown connection failed")
+	}
+}
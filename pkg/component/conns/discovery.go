@@ -0,0 +1,140 @@
+package conns
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"code.xxxxx.cn/platform/galaxy/pkg/util/alog"
+	"gopkg.in/yaml.v2"
+)
+
+// DefaultDiscoveryPeriod default period to resolve endpoints of servers
+const DefaultDiscoveryPeriod = 30 * time.Second
+
+// Endpoint is an address of server, endpoints with lower priority value are preferred,
+// the ones with the same priority are selected randomly in proportion to weight
+type Endpoint struct {
+	Addr     string `yaml:"addr"`
+	Priority int    `yaml:"priority"`
+	Weight   int    `yaml:"weight"`
+}
+
+// Discovery resolve endpoints of servers
+type Discovery interface {
+	// Endpoints return all endpoints of servers resolved
+	Endpoints() ([]Endpoint, error)
+}
+
+// srvDiscovery resolve endpoints from DNS SRV records
+type srvDiscovery struct {
+	name string
+}
+
+// NewSRVDiscovery build a Discovery resolves DNS SRV records of name, eg. _galaxy._tcp.m.xxxxx.cn
+func NewSRVDiscovery(name string) Discovery {
+	return &srvDiscovery{name: name}
+}
+
+// Endpoints lookup SRV records, priority and weight of endpoints are the same as records
+func (d *srvDiscovery) Endpoints() ([]Endpoint, error) {
+	_, records, err := net.LookupSRV("", "", d.name)
+	if err != nil {
+		return nil, fmt.Errorf("lookup srv records of %s failed: %v", d.name, err)
+	}
+	endpoints := make([]Endpoint, 0, len(records))
+	for _, r := range records {
+		endpoints = append(endpoints, Endpoint{
+			Addr:     net.JoinHostPort(strings.TrimSuffix(r.Target, "."), strconv.Itoa(int(r.Port))),
+			Priority: int(r.Priority),
+			Weight:   int(r.Weight),
+		})
+	}
+	return endpoints, nil
+}
+
+// fileDiscovery resolve endpoints from a local yaml file, the file is reloaded when modified
+type fileDiscovery struct {
+	path      string
+	lock      sync.Mutex
+	modTime   time.Time
+	endpoints []Endpoint
+}
+
+// endpointsFile is the content of endpoints file
+type endpointsFile struct {
+	Endpoints []Endpoint `yaml:"endpoints"`
+}
+
+// NewFileDiscovery build a Discovery reads endpoints from yaml file path, the file has a list of
+// endpoints with fields addr, priority and weight under key endpoints
+func NewFileDiscovery(path string) Discovery {
+	return &fileDiscovery{path: path}
+}
+
+// Endpoints return endpoints in file, reload it if modified since last read
+func (d *fileDiscovery) Endpoints() ([]Endpoint, error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	info, err := os.Stat(d.path)
+	if err != nil {
+		return nil, err
+	}
+	if d.endpoints != nil && info.ModTime().Equal(d.modTime) {
+		return d.endpoints, nil
+	}
+	data, err := ioutil.ReadFile(d.path)
+	if err != nil {
+		return nil, err
+	}
+	file := &endpointsFile{}
+	if err := yaml.Unmarshal(data, file); err != nil {
+		return nil, fmt.Errorf("parse endpoints file %s failed: %v", d.path, err)
+	}
+	alog.Infof("Loaded %d endpoints from %s", len(file.Endpoints), d.path)
+	d.endpoints, d.modTime = file.Endpoints, info.ModTime()
+	return d.endpoints, nil
+}
+
+// sortEndpoints sort endpoints by priority, the endpoints with the same priority are shuffled by weight
+func sortEndpoints(endpoints []Endpoint) []Endpoint {
+	sorted := make([]Endpoint, len(endpoints))
+	copy(sorted, endpoints)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Priority < sorted[j].Priority
+	})
+	for start := 0; start < len(sorted); {
+		end := start + 1
+		for end < len(sorted) && sorted[end].Priority == sorted[start].Priority {
+			end++
+		}
+		shuffleByWeight(sorted[start:end])
+		start = end
+	}
+	return sorted
+}
+
+// shuffleByWeight order endpoints randomly, an endpoint with larger weight is more likely in front
+func shuffleByWeight(endpoints []Endpoint) {
+	for i := range endpoints {
+		total := 0
+		for _, e := range endpoints[i:] {
+			total += e.Weight + 1
+		}
+		n := rand.Intn(total)
+		for j := i; j < len(endpoints); j++ {
+			if n -= endpoints[j].Weight + 1; n < 0 {
+				endpoints[i], endpoints[j] = endpoints[j], endpoints[i]
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package conns
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSortEndpoints(t *testing.T) {
+	endpoints := []Endpoint{
+		{Addr: "backup", Priority: 10, Weight: 100},
+		{Addr: "a", Priority: 0, Weight: 100},
+		{Addr: "b", Priority: 0, Weight: 0},
+	}
+	first := map[string]int{}
+	for i := 0; i < 1000; i++ {
+		sorted := sortEndpoints(endpoints)
+		if len(sorted) != 3 || sorted[2].Addr != "backup" {
+			t.Fatalf("expect endpoints sorted by priority, got %v", sorted)
+		}
+		first[sorted[0].Addr]++
+	}
+	if first["a"] <= first["b"] {
+		t.Errorf("expect endpoint with larger weight selected first more often, got %v", first)
+	}
+}
+
+func TestFileDiscovery(t *testing.T) {
+	dir, err := ioutil.TempDir("", "discovery")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "endpoints.yaml")
+
+	write := func(content string, modTime time.Time) {
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	d := NewFileDiscovery(path)
+	now := time.Now()
+	write("endpoints:\n- addr: m1:50070\n  priority: 1\n  weight: 10\n", now)
+	endpoints, err := d.Endpoints()
+	if err != nil || len(endpoints) != 1 || endpoints[0] != (Endpoint{Addr: "m1:50070", Priority: 1, Weight: 10}) {
+		t.Fatalf("unexpected endpoints %v, err %v", endpoints, err)
+	}
+
+	write("endpoints:\n- addr: m1:50070\n- addr: m2:50070\n", now.Add(time.Second))
+	if endpoints, err := d.Endpoints(); err != nil || len(endpoints) != 2 {
+		t.Errorf("expect endpoints reloaded after file modified, got %v, err %v", endpoints, err)
+	}
+}
@@ -18,9 +18,39 @@ var (
 			Help:      "Number of grpc connections",
 		},
 	)
+	// GRPCDialAttempts metric of dial attempts to server
+	GRPCDialAttempts = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Subsystem: GalaxySubsystem,
+			Name:      "grpc_dial_attempts_total",
+			Help:      "Number of attempts to dial grpc server",
+		},
+		[]string{"addr"},
+	)
+	// GRPCDialFailures metric of failed dials to server
+	GRPCDialFailures = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Subsystem: GalaxySubsystem,
+			Name:      "grpc_dial_failures_total",
+			Help:      "Number of failed attempts to dial grpc server",
+		},
+		[]string{"addr"},
+	)
+	// CertExpiry metric of expiry time of the active certificates
+	CertExpiry = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Subsystem: GalaxySubsystem,
+			Name:      "cert_expiry_timestamp_seconds",
+			Help:      "Unix timestamp of the expiry of the active certificate",
+		},
+		[]string{"cert"},
+	)
 )
 
 // Register all metrics
 func init() {
 	prometheus.MustRegister(GRPCConnNumber)
+	prometheus.MustRegister(GRPCDialAttempts)
+	prometheus.MustRegister(GRPCDialFailures)
+	prometheus.MustRegister(CertExpiry)
 }
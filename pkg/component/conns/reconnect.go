@@ -0,0 +1,101 @@
+package conns
+
+import (
+	"math"
+	"math/rand"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/keepalive"
+)
+
+/* default params of reconnect policy and keepalive */
+const (
+	DefaultBackoffInitialInterval = time.Second
+	DefaultBackoffMaxInterval     = 2 * time.Minute
+	DefaultBackoffMultiplier      = 2.0
+	DefaultBackoffJitter          = 0.2
+	DefaultKeepaliveTime          = 30 * time.Second
+	DefaultKeepaliveTimeout       = 10 * time.Second
+	// DefaultKeepaliveMinTime is the min interval of client pings allowed by server, it must be less than
+	// DefaultKeepaliveTime or the clients will be disconnected by server with too_many_pings
+	DefaultKeepaliveMinTime = 10 * time.Second
+)
+
+// ReconnectPolicy configure how a client reconnects to servers and keeps connection alive
+type ReconnectPolicy struct {
+	// InitialInterval is the time to wait after all servers failed to dial the first time
+	InitialInterval time.Duration
+	// MaxInterval is the max time to wait between two rounds of dialing
+	MaxInterval time.Duration
+	// Multiplier is the factor to multiply interval after every failed round
+	Multiplier float64
+	// Jitter randomize interval by the fraction, eg. 0.2 means interval*[0.8, 1.2)
+	Jitter float64
+	// KeepaliveTime is the time of no activity after which client pings server, 0 disables keepalive
+	KeepaliveTime time.Duration
+	// KeepaliveTimeout is the time to wait for ping ack before closing the connection
+	KeepaliveTimeout time.Duration
+}
+
+// NewDefaultReconnectPolicy build a ReconnectPolicy with default params
+func NewDefaultReconnectPolicy() ReconnectPolicy {
+	return ReconnectPolicy{
+		InitialInterval:  DefaultBackoffInitialInterval,
+		MaxInterval:      DefaultBackoffMaxInterval,
+		Multiplier:       DefaultBackoffMultiplier,
+		Jitter:           DefaultBackoffJitter,
+		KeepaliveTime:    DefaultKeepaliveTime,
+		KeepaliveTimeout: DefaultKeepaliveTimeout,
+	}
+}
+
+// Backoff return the time to wait before the next round of dialing after attempt rounds failed, attempt starts from 0
+func (p ReconnectPolicy) Backoff(attempt int) time.Duration {
+	initial, max, multiplier := p.InitialInterval, p.MaxInterval, p.Multiplier
+	if initial <= 0 {
+		initial = DefaultBackoffInitialInterval
+	}
+	if max < initial {
+		max = initial
+	}
+	if multiplier < 1 {
+		multiplier = 1
+	}
+
+	interval := float64(initial) * math.Pow(multiplier, float64(attempt))
+	if interval > float64(max) {
+		interval = float64(max)
+	}
+	if p.Jitter > 0 {
+		interval *= 1 + p.Jitter*(2*rand.Float64()-1)
+	}
+	return time.Duration(interval)
+}
+
+// dialOptions return the keepalive dial options of policy
+func (p ReconnectPolicy) dialOptions() []grpc.DialOption {
+	if p.KeepaliveTime <= 0 {
+		return nil
+	}
+	return []grpc.DialOption{grpc.WithKeepaliveParams(keepalive.ClientParameters{
+		Time:                p.KeepaliveTime,
+		Timeout:             p.KeepaliveTimeout,
+		PermitWithoutStream: true,
+	})}
+}
+
+// ServerKeepaliveOptions return the grpc server options to ping idle clients every t and wait timeout for ack,
+// clients ping more frequently than minTime are disconnected, it should match the policies of clients
+func ServerKeepaliveOptions(minTime, t, timeout time.Duration) []grpc.ServerOption {
+	return []grpc.ServerOption{
+		grpc.KeepaliveEnforcementPolicy(keepalive.EnforcementPolicy{
+			MinTime:             minTime,
+			PermitWithoutStream: true,
+		}),
+		grpc.KeepaliveParams(keepalive.ServerParameters{
+			Time:    t,
+			Timeout: timeout,
+		}),
+	}
+}
@@ -0,0 +1,26 @@
+package conns
+
+import (
+	"testing"
+	"time"
+)
+
+func TestReconnectPolicyBackoff(t *testing.T) {
+	p := ReconnectPolicy{InitialInterval: time.Second, MaxInterval: 10 * time.Second, Multiplier: 2}
+	for attempt, expect := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 10 * time.Second, 10 * time.Second} {
+		if got := p.Backoff(attempt); got != expect {
+			t.Errorf("attempt %d: expect backoff %s, got %s", attempt, expect, got)
+		}
+	}
+
+	p.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		if got := p.Backoff(10); got < 5*time.Second || got >= 15*time.Second {
+			t.Fatalf("expect backoff with jitter in [5s, 15s), got %s", got)
+		}
+	}
+
+	if got := (ReconnectPolicy{}).Backoff(3); got != DefaultBackoffInitialInterval {
+		t.Errorf("expect zero policy backoff %s, got %s", DefaultBackoffInitialInterval, got)
+	}
+}
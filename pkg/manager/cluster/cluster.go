@@ -1,8 +1,12 @@
 package cluster
 
 import (
+	"encoding/json"
+	"fmt"
+	"strings"
 	"time"
 
+	"code.xxxxx.cn/platform/galaxy/pkg/apis"
 	model2 "code.xxxxx.cn/platform/galaxy/pkg/manager/model/configserver"
 
 	"code.xxxxx.cn/platform/galaxy/pkg/component/cmd"
@@ -25,8 +29,11 @@ func NewManager(cmdServer cmd.Server, resourceManagerAPI string, resourceManager
 		resourceManagerSecret: resourceManagerSecret,
 	}
 
+	// index the site labels added by labelConn to look up agents of sites quickly
+	m.cmdServer.GetConnManager().IndexLabels(apis.LabelSiteID, apis.LabelBusinessLine)
 	m.cmdServer.GetConnManager().OnReady(m.onReady)
 	m.cmdServer.GetConnManager().OnNotReady(m.onNotReady)
+	m.cmdServer.OnHeartbeat(m.onHeartbeat)
 
 	m.addCmdHandlers()
 	//go m.pullData()
@@ -84,11 +91,49 @@ func (m manager) UpdateClusterEnvs(cluster *model.Cluster) (err error) {
 	return model.UpdateClusterEnvs(cluster)
 }
 
+// GetClusterResources get the latest kubernetes workload inventory reported by agent of the cluster
+func (m manager) GetClusterResources(id uint64) (*apis.ClusterInventory, error) {
+	cluster, err := model.GetClusterByID(id)
+	if err != nil {
+		return nil, err
+	}
+	record, err := model.GetClusterInventoryBySiteID(cluster.SiteID)
+	if err != nil {
+		return nil, err
+	}
+	inventory := &apis.ClusterInventory{}
+	if err := json.Unmarshal([]byte(record.Inventory), inventory); err != nil {
+		return nil, fmt.Errorf("decode inventory of site %s failed: %v", cluster.SiteID, err)
+	}
+	return inventory, nil
+}
+
 func (m manager) onReady(conn *conns.Conn) {
 	// update cluster status to Ready
 	if err := model.UpdateClusterStatus(conn.Key, model.ClusterStatusReady); err != nil {
 		alog.Errorf("When connection, update cluster %v error: %v", conn.Key, err)
 	}
+	m.labelConn(conn)
+}
+
+// labelConn add site labels to connection info, to select agents when broadcast cmd
+func (m manager) labelConn(conn *conns.Conn) {
+	connInfos := strings.Split(conn.Key, apis.ConnectionSplit)
+	if len(connInfos) != 2 {
+		return
+	}
+	cluster, err := model.GetClusterBySiteID(connInfos[0])
+	if err != nil {
+		alog.Errorf("When connection, get cluster of %v error: %v", conn.Key, err)
+		return
+	}
+	labels := map[string]string{
+		apis.LabelSiteID:       cluster.SiteID,
+		apis.LabelBusinessLine: cluster.BusinessLine,
+	}
+	if err := m.cmdServer.GetConnManager().UpdateConnInfo(conn.Key, labels); err != nil {
+		alog.Errorf("When connection, label connection %v error: %v", conn.Key, err)
+	}
 }
 
 func (m manager) onNotReady(conn *conns.Conn) {
@@ -102,6 +147,22 @@ func (m manager) onNotReady(conn *conns.Conn) {
 	}
 }
 
+// onHeartbeat update heartbeat time of cluster, mark it NotReady if the connection is stale but not broken
+func (m manager) onHeartbeat(connKey string, l cmd.Liveness) {
+	if l.Stale {
+		if err := model.UpdateClusterStatus(connKey, model.ClusterStatusNotReady); err != nil {
+			alog.Errorf("When heartbeat missed, update cluster %v error: %v", connKey, err)
+		}
+		return
+	}
+	if l.Misses > 0 {
+		return
+	}
+	if err := model.UpdateClusterHeartbeat(connKey, l.LastSeen); err != nil {
+		alog.Errorf("When heartbeat, update cluster %v error: %v", connKey, err)
+	}
+}
+
 func (m *manager) pullData() {
 	for range time.Tick(60 * time.Second) {
 		m.RsyncClusterInfo()
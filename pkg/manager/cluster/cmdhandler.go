@@ -1,5 +1,47 @@
 package cluster
 
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"code.xxxxx.cn/platform/galaxy/pkg/apis"
+	"code.xxxxx.cn/platform/galaxy/pkg/component/cmd"
+	"code.xxxxx.cn/platform/galaxy/pkg/manager/model"
+	"code.xxxxx.cn/platform/galaxy/pkg/util/alog"
+)
+
 func (m *manager) addCmdHandlers() {
+	m.cmdServer.AddCmdHandler(cmd.ReportInventory, cmd.HandleReportInventory(m.reportInventoryHandler))
 	go m.pullData()
 }
+
+// reportInventoryHandler save the kubernetes workload inventory reported by agent of the site
+func (m *manager) reportInventoryHandler(req *cmd.Req, inventory *apis.ClusterInventory) (*cmd.Resp, cmd.OnComplete) {
+	connInfos := strings.Split(req.Caller, apis.ConnectionSplit)
+	if len(connInfos) != 2 {
+		return cmd.RespError(fmt.Errorf("invalid request caller: %v", req.Caller)), nil
+	}
+	// the site is decided by the caller, agent could not report for other sites
+	inventory.SiteID = connInfos[0]
+	if inventory.ReportedAt.IsZero() {
+		inventory.ReportedAt = time.Now()
+	}
+	data, err := json.Marshal(inventory)
+	if err != nil {
+		return cmd.RespError(err), nil
+	}
+	if err := model.SaveClusterInventory(&model.ClusterInventory{
+		SiteID:     inventory.SiteID,
+		ConnKey:    req.Caller,
+		ReportedAt: inventory.ReportedAt,
+		Inventory:  string(data),
+	}); err != nil {
+		alog.Errorf("ReportInventoryHandler: save inventory of %v err: %v", req.Caller, err)
+		return cmd.RespError(err), nil
+	}
+	alog.V(4).Infof("Saved inventory of %v: %d nodes, %d namespaces, %d deployments, %d pods", req.Caller,
+		len(inventory.Nodes), len(inventory.Namespaces), len(inventory.Deployments), len(inventory.Pods))
+	return cmd.RespSucceed("success"), nil
+}
@@ -1,6 +1,7 @@
 package cluster
 
 import (
+	"code.xxxxx.cn/platform/galaxy/pkg/apis"
 	"code.xxxxx.cn/platform/galaxy/pkg/manager/model"
 )
 
@@ -19,6 +20,8 @@ type Manager interface {
 	GetClusterEnvs(*model.Cluster) error
 	// UpdateClusterEnvs get cluster env
 	UpdateClusterEnvs(*model.Cluster) error
+	// GetClusterResources get the latest kubernetes workload inventory reported by agent of cluster
+	GetClusterResources(id uint64) (*apis.ClusterInventory, error)
 }
 
 // TokenManager is responsible for generating and decrypting tokens used for authorization.
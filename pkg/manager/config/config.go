@@ -15,6 +15,11 @@ const (
 	DefaultAuthTokenTTL    = 30 * time.Minute
 	DefaultPrometheusAddr  = "http://prometheus.monitoring:9090"
 	DefaultDataDir         = "/data"
+	DefaultOutboxTTL       = 24 * time.Hour
+
+	DefaultGRPCKeepaliveMinTime = 10 * time.Second
+	DefaultGRPCKeepaliveTime    = 2 * time.Minute
+	DefaultGRPCKeepaliveTimeout = 20 * time.Second
 )
 
 // ManagerConfiguration holds whole configuration of server
@@ -27,6 +32,12 @@ type ManagerConfiguration struct {
 	GRPCServerAddr string
 	// GRPCInsecure if use insecure rpc connection
 	GRPCInsecure bool
+	// GRPCKeepaliveMinTime min interval of pings allowed from agents, agents ping more frequently are disconnected
+	GRPCKeepaliveMinTime time.Duration
+	// GRPCKeepaliveTime ping agents after the time of no activity
+	GRPCKeepaliveTime time.Duration
+	// GRPCKeepaliveTimeout time to wait for ping ack before closing the connection of agent
+	GRPCKeepaliveTimeout time.Duration
 	// WebServerAddr web api server address: ip:port
 	WebServerAddr string
 	// MetricServerAddr metric server address: ip:port
@@ -41,6 +52,9 @@ type ManagerConfiguration struct {
 	CAFile string
 	// DBConfig database config file
 	DBConfig string
+	// SiteIdentityFile yaml file maps identities of agent certificates to site ids they can register as,
+	// empty allows agents with any valid certificate to register as any site
+	SiteIdentityFile string
 	// AuthAddr system auth access address: scheme://ip:port
 	AuthAddr string
 	// PMPSecret access token to pmp
@@ -63,6 +77,8 @@ type ManagerConfiguration struct {
 	ResourceManagerSecret string
 	// SwaggerEnable if enable swagger to open swagger api docs
 	SwaggerEnable bool
+	// OutboxTTL max time to keep a cmd in outbox before delivered to agent
+	OutboxTTL time.Duration
 }
 
 // NewDefaultConfig build default manager configuration
@@ -78,5 +94,10 @@ func NewDefaultConfig() *ManagerConfiguration {
 		AuthSkip:         DefaultAuthSkip,
 		AuthTokenTTL:     DefaultAuthTokenTTL,
 		PrometheusAddr:   DefaultPrometheusAddr,
+		OutboxTTL:        DefaultOutboxTTL,
+
+		GRPCKeepaliveMinTime: DefaultGRPCKeepaliveMinTime,
+		GRPCKeepaliveTime:    DefaultGRPCKeepaliveTime,
+		GRPCKeepaliveTimeout: DefaultGRPCKeepaliveTimeout,
 	}
 }
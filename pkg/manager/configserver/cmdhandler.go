@@ -3,31 +3,34 @@ package configserver
 import (
 	"encoding/json"
 	"fmt"
+	"unicode/utf8"
 
 	"code.xxxxx.cn/platform/galaxy/pkg/util/alog"
 
 	"code.xxxxx.cn/platform/galaxy/pkg/component/cmd"
+	pb "code.xxxxx.cn/platform/galaxy/pkg/component/cmd/v1"
 	model "code.xxxxx.cn/platform/galaxy/pkg/manager/model/configserver"
 )
 
 func (cm *configManager) addCmdHandlers() {
-	cm.cmdServer.AddCmdHandler(cmd.AppCancelHandler, cm.appCancelHandler)
-	cm.cmdServer.AddCmdHandler(cmd.FileUpdateHandler, cm.fileUpdateHandler)
-	cm.cmdServer.AddCmdHandler(cmd.FileRefreshHandler, cm.fileRefreshHandler)
-	cm.cmdServer.AddCmdHandler(cmd.FileSyncHandler, cm.fileSyncHandler)
+	cm.cmdServer.AddCmdHandler(cmd.AppCancelHandler, cmd.HandleAppCancel(cm.appCancelHandler))
+	cm.cmdServer.AddCmdHandler(cmd.FileUpdateHandler, cmd.HandleFileUpdated(cm.fileUpdateHandler))
+	cm.cmdServer.AddCmdHandler(cmd.FileRefreshHandler, cmd.HandleFileRefresh(cm.fileRefreshHandler))
+	cm.cmdServer.AddCmdHandler(cmd.FileSyncHandler, cmd.HandleFileRefresh(cm.fileSyncHandler))
+	cm.cmdServer.AddCmdHandler(cmd.PackageContentHandler, cmd.HandleNSPackage(cm.packageContentHandler))
 
 }
 
 // appCancelHandler cancel app instance
-func (cm *configManager) appCancelHandler(req *cmd.Req) (*cmd.Resp, cmd.OnComplete) {
+func (cm *configManager) appCancelHandler(req *cmd.Req, payload *pb.AppCancelPayload) (*cmd.Resp, cmd.OnComplete) {
 
 	siteID, err := cm.getSiteIDFromConnKey(req.Caller)
 	if err != nil {
 		err := fmt.Errorf("invalid request caller: %v", req.Caller)
 		return cmd.RespError(err), nil
 	}
-	app := req.Args.Get("app")
-	hostname := req.Args.Get("hostname")
+	app := payload.App
+	hostname := payload.Hostname
 
 	if err := model.DeleteConfigInstance(app, hostname, siteID, req.Caller, nil); err != nil {
 		alog.Errorf("AppCancelHandler: delete config instance %v err: %v", app, err)
@@ -39,27 +42,32 @@ func (cm *configManager) appCancelHandler(req *cmd.Req) (*cmd.Resp, cmd.OnComple
 }
 
 // fileUpdateHandler update app instance detail, including digest
-func (cm *configManager) fileUpdateHandler(req *cmd.Req) (*cmd.Resp, cmd.OnComplete) {
-
-	updateInfo := &model.ConfigInstanceUpdateInfo{}
-	infoJSON := req.Args.Get("updateinfo")
-	if err := json.Unmarshal([]byte(infoJSON), updateInfo); err != nil {
+func (cm *configManager) fileUpdateHandler(req *cmd.Req, updateInfo *pb.FileUpdatedPayload) (*cmd.Resp, cmd.OnComplete) {
+	// the site is decided by the caller verified, agent could not update instances of other sites
+	siteID, err := cm.getSiteIDFromConnKey(req.Caller)
+	if err != nil {
+		err := fmt.Errorf("invalid request caller: %v", req.Caller)
 		return cmd.RespError(err), nil
 	}
+	if updateInfo.SiteID != "" && updateInfo.SiteID != siteID {
+		alog.Warningf("FileUpdateHandler: caller %v of site %v updates site %v, ignored", req.Caller, siteID, updateInfo.SiteID)
+	}
+
 	var errList []string
 	for filename, digest := range updateInfo.Filenames {
-		configInfo, err := model.GetConfigInfoByNamespaceNameSiteID(updateInfo.Namespace, filename, updateInfo.SiteID)
+		configInfo, err := model.GetConfigInfoByNamespaceNameSiteID(updateInfo.Namespace, filename, siteID)
 		if err != nil {
-			alog.Errorf("FileUpdateHandler: get config %v-%v-%v err: %v", updateInfo.SiteID, updateInfo.Namespace, filename, err)
+			alog.Errorf("FileUpdateHandler: get config %v-%v-%v err: %v", siteID, updateInfo.Namespace, filename, err)
 			errList = append(errList, filename)
 			continue
 		}
 		instance := &model.ConfigInstance{
 			Name:         updateInfo.App,
-			SiteID:       updateInfo.SiteID,
+			SiteID:       siteID,
 			Hostname:     updateInfo.Hostname,
 			IP:           updateInfo.IP,
 			Digest:       digest,
+			Error:        truncate(req.Args.Get(cmd.ArgUpdateError), 512),
 			ConfigInfoID: configInfo.ID,
 			ConnKey:      req.Caller,
 		}
@@ -80,18 +88,13 @@ func (cm *configManager) fileUpdateHandler(req *cmd.Req) (*cmd.Resp, cmd.OnCompl
 }
 
 // fileRefreshHandler diff file digest
-func (cm *configManager) fileRefreshHandler(req *cmd.Req) (*cmd.Resp, cmd.OnComplete) {
+func (cm *configManager) fileRefreshHandler(req *cmd.Req, payload *pb.FileRefreshPayload) (*cmd.Resp, cmd.OnComplete) {
 
 	siteID, err := cm.getSiteIDFromConnKey(req.Caller)
 	if err != nil {
 		return cmd.RespError(err), nil
 	}
-	contentJSON := req.Args.Get("filecontents")
-	content := make(map[string]map[string]string)
-
-	if err := json.Unmarshal([]byte(contentJSON), &content); err != nil {
-		return cmd.RespError(err), nil
-	}
+	content := cmd.FileDigestsMap(payload.Files)
 
 	diff := make(map[string]map[string]string)
 	for ns, file := range content {
@@ -135,18 +138,13 @@ func (cm *configManager) fileRefreshHandler(req *cmd.Req) (*cmd.Resp, cmd.OnComp
 }
 
 // fileSyncHandler file sync digest
-func (cm *configManager) fileSyncHandler(req *cmd.Req) (*cmd.Resp, cmd.OnComplete) {
+func (cm *configManager) fileSyncHandler(req *cmd.Req, payload *pb.FileRefreshPayload) (*cmd.Resp, cmd.OnComplete) {
 
 	siteID, err := cm.getSiteIDFromConnKey(req.Caller)
 	if err != nil {
 		return cmd.RespError(err), nil
 	}
-	contentJSON := req.Args.Get("filecontents")
-	content := make(map[string]map[string]string)
-
-	if err := json.Unmarshal([]byte(contentJSON), &content); err != nil {
-		return cmd.RespError(err), nil
-	}
+	content := cmd.FileDigestsMap(payload.Files)
 
 	query := fmt.Sprintf("site_id=%q AND status != 'deleted'", siteID)
 	configInfos, err := model.GetAllConfigInfos(query)
@@ -209,3 +207,43 @@ func (cm *configManager) fileSyncHandler(req *cmd.Req) (*cmd.Resp, cmd.OnComplet
 
 	return cmd.RespSucceed(string(diffResult)), nil
 }
+
+// packageContentHandler send the namespace package of caller site as chunks, response data is the digest,
+// the package is only sent if it is still the one of the digest requested
+func (cm *configManager) packageContentHandler(req *cmd.Req, payload *pb.NSPackagePayload) (*cmd.Resp, cmd.OnComplete) {
+	if !req.AcceptChunked {
+		return cmd.RespError(fmt.Errorf("caller %v not accepts chunked response", req.Caller)), nil
+	}
+	siteID, err := cm.getSiteIDFromConnKey(req.Caller)
+	if err != nil {
+		err := fmt.Errorf("invalid request caller: %v", req.Caller)
+		return cmd.RespError(err), nil
+	}
+
+	// never visit package by digest only, which may be a package of other sites
+	digest, packageData, err := cm.storage.VisitPackage(siteID, payload.Namespace)
+	if err != nil {
+		alog.Warningf("PackageContentHandler: visit package %v of site %v err: %v", payload.Namespace, siteID, err)
+		return cmd.RespNotFound(), nil
+	}
+	if payload.Digest != "" && payload.Digest != digest {
+		alog.Warningf("PackageContentHandler: package %v of site %v is %v, not %v requested", payload.Namespace, siteID, digest, payload.Digest)
+		if err := packageData.Close(); err != nil {
+			alog.Warningf("PackageContentHandler: close package %v of site %v err: %v", payload.Namespace, siteID, err)
+		}
+		return cmd.RespNotFound(), nil
+	}
+
+	return cmd.RespChunked(digest, packageData), nil
+}
+
+// truncate cut s to at most n bytes without breaking utf8 characters
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
@@ -0,0 +1,113 @@
+package configserver
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"code.xxxxx.cn/platform/galaxy/pkg/apis"
+	"code.xxxxx.cn/platform/galaxy/pkg/component/cmd"
+	"code.xxxxx.cn/platform/galaxy/pkg/component/cmd/cmdtest"
+	pb "code.xxxxx.cn/platform/galaxy/pkg/component/cmd/v1"
+	"code.xxxxx.cn/platform/galaxy/pkg/component/storage/filedb"
+)
+
+func TestCmdHandlersInvalidReq(t *testing.T) {
+	h := cmdtest.New(t)
+	defer h.Close()
+
+	cm := &configManager{cmdServer: h.Server}
+	cm.addCmdHandlers()
+
+	// default client name is not a valid conn key of site
+	for _, name := range []cmd.Name{cmd.AppCancelHandler, cmd.FileUpdateHandler, cmd.FileRefreshHandler, cmd.FileSyncHandler} {
+		resp, err := h.Client.SendSync(h.Client.NewCmdReq(name, nil), 5)
+		if err != nil {
+			t.Fatalf("send %s failed: %v", name, err)
+		}
+		if resp.Code != cmd.FailCode {
+			t.Errorf("expect %s failed of invalid caller, got code %d", name, resp.Code)
+		}
+	}
+
+	resp, err := h.Client.SendSync(h.Client.NewCmdReq(cmd.FileUpdateHandler, cmd.Args{"updateinfo": "{"}), 5)
+	if err != nil {
+		t.Fatalf("send %s failed: %v", cmd.FileUpdateHandler, err)
+	}
+	if resp.Code != cmd.FailCode {
+		t.Errorf("expect %s failed of invalid json, got code %d", cmd.FileUpdateHandler, resp.Code)
+	}
+}
+
+func TestPackageContentOfCallerSite(t *testing.T) {
+	h := cmdtest.New(t)
+	defer h.Close()
+
+	dir, err := ioutil.TempDir("", "configserver")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fdb, err := filedb.NewFileDB(&filedb.Config{Workdir: dir, CasDisable: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	own, err := fdb.StorePackage("site-a", "ns", strings.NewReader("package of a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := fdb.StorePackage("site-b", "ns", strings.NewReader("package of b"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cm := &configManager{cmdServer: h.Server, storage: fdb}
+	cm.addCmdHandlers()
+	client := h.AddClient(cmdtest.NewClientName("site-a" + apis.ConnectionSplit))
+
+	download := func(digest string) *cmd.Resp {
+		t.Helper()
+		req := client.NewCmdReq(cmd.PackageContentHandler, nil)
+		if err := cmd.SetNSPackagePayload(req, &pb.NSPackagePayload{Namespace: "ns", Digest: digest}); err != nil {
+			t.Fatal(err)
+		}
+		resp, err := client.SendSync(req, 5)
+		if err != nil {
+			t.Fatalf("send %s failed: %v", cmd.PackageContentHandler, err)
+		}
+		return resp
+	}
+	for _, digest := range []string{"", own} {
+		resp := download(digest)
+		if resp.Code != cmd.SuccessCode || resp.Data != own {
+			t.Fatalf("expect package %v of caller site, got code %d data %q", own, resp.Code, resp.Data)
+		}
+		data, err := ioutil.ReadAll(resp)
+		resp.Close()
+		if err != nil || string(data) != "package of a" {
+			t.Errorf("expect content of caller site, got %q: %v", data, err)
+		}
+	}
+
+	// package of other site is never sent even if its digest known
+	if resp := download(other); resp.Code != cmd.NotFoundCode {
+		t.Errorf("expect package of other site not found, got code %d", resp.Code)
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	for _, c := range []struct {
+		s    string
+		n    int
+		want string
+	}{
+		{"short", 10, "short"},
+		{"exceeded", 3, "exc"},
+		{"失败原因", 4, "失"},
+	} {
+		if got := truncate(c.s, c.n); got != c.want {
+			t.Errorf("expect truncate %q to %d bytes is %q, got %q", c.s, c.n, c.want, got)
+		}
+	}
+}
@@ -3,6 +3,7 @@ package configserver
 import (
 	"archive/tar"
 	"compress/gzip"
+	"context"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
@@ -29,8 +30,10 @@ import (
 	"code.xxxxx.cn/platform/galaxy/pkg/util/alog"
 
 	"code.xxxxx.cn/platform/galaxy/pkg/component/cmd"
+	pb "code.xxxxx.cn/platform/galaxy/pkg/component/cmd/v1"
 	"code.xxxxx.cn/platform/galaxy/pkg/component/storage/filedb"
 	model "code.xxxxx.cn/platform/galaxy/pkg/manager/model/configserver"
+	"code.xxxxx.cn/platform/galaxy/pkg/manager/outbox"
 )
 
 /* All Import from Image Const */
@@ -42,6 +45,7 @@ const (
 
 type configManager struct {
 	cmdServer cmd.Server
+	outbox    outbox.Manager
 	storage   *filedb.FileDB
 }
 
@@ -59,9 +63,10 @@ var formatMap = map[string]model.ConfigFormat{
 }
 
 // NewConfigManager create a new config manager
-func NewConfigManager(dataDir string, cmdServer cmd.Server, stopCh <-chan struct{}) (Manager, *filedb.FileDB) {
+func NewConfigManager(dataDir string, cmdServer cmd.Server, outbox outbox.Manager, stopCh <-chan struct{}) (Manager, *filedb.FileDB) {
 	m := &configManager{
 		cmdServer: cmdServer,
+		outbox:    outbox,
 	}
 	m.addCmdHandlers()
 	m.newFsDb(dataDir)
@@ -299,8 +304,27 @@ func (cm *configManager) UpdateConfig(config *model.ConfigInfo) error {
 	return nil
 }
 
+// detachedContext keep the values of parent context, but never cancelled or timeout with it
+type detachedContext struct {
+	context.Context
+}
+
+// detach return a context with values of ctx for the work outlives ctx
+func detach(ctx context.Context) context.Context {
+	return detachedContext{Context: ctx}
+}
+
+// Deadline implements context.Context
+func (detachedContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+
+// Done implements context.Context
+func (detachedContext) Done() <-chan struct{} { return nil }
+
+// Err implements context.Context
+func (detachedContext) Err() error { return nil }
+
 // ReleaseConfig release a config
-func (cm *configManager) ReleaseConfig(id uint64, desc, creator string) error {
+func (cm *configManager) ReleaseConfig(ctx context.Context, id uint64, desc, creator string) error {
 
 	// begin transaction
 	tx := db.NewTransaction()
@@ -332,26 +356,17 @@ func (cm *configManager) ReleaseConfig(id uint64, desc, creator string) error {
 		"filename":  configVersion.Name,
 		"version":   fmt.Sprintf("%v", configVersion.Version),
 	}
-	executor, err := cm.getConnKeyFromSiteID(configInfo.SiteID)
-	if err != nil {
-		alog.Errorf("ReleaseConfig: get executor by site id err: %v ", err)
+	target := outbox.SiteTarget(configInfo.SiteID)
+	if _, err := cm.outbox.Enqueue(target, &cmd.Req{Name: cmd.CmdNSFileHandler, Args: args}, creator, tx); err != nil {
+		alog.Errorf("ReleaseConfig: enqueue cmd %s err: %v ", cmd.CmdNSFileHandler, err)
 		tx.Rollback()
 		return err
 	}
-	c := cm.cmdServer.NewCmdReq(cmd.CmdNSFileHandler, args, executor)
-	resp, err := cm.cmdServer.SendSync(c, 3)
-	if err != nil {
-		alog.Errorf("Send Cmd %s failed: %v ", cmd.CmdNSFileHandler, err)
-		tx.Rollback()
-		return err
-	}
-	if resp.Code == apis.FailCode {
-		alog.Errorf("Send Cmd %s failed: %v ", cmd.CmdNSFileHandler, resp.Msg)
-		tx.Rollback()
-		return fmt.Errorf(resp.Msg)
-	}
 
 	tx.Commit()
+	// deliver in background if agent is connected, or it will be delivered when agent connected,
+	// never block the release by a slow agent, nor cancel it when the request finished
+	go cm.outbox.Deliver(detach(ctx), target)
 	return nil
 }
 
@@ -368,7 +383,7 @@ func (cm *configManager) ReleaseConfigDetail(id uint64) (string, []*model.Config
 }
 
 // ReleaseNamespace release configs of namespace
-func (cm *configManager) ReleaseNamespace(siteID string, ns string, desc, creator string) error {
+func (cm *configManager) ReleaseNamespace(ctx context.Context, siteID string, ns string, desc, creator string) error {
 
 	query := fmt.Sprintf("site_id=%q AND namespace=%q AND status IN ('created', 'updated')", siteID, ns)
 
@@ -411,30 +426,23 @@ func (cm *configManager) ReleaseNamespace(siteID string, ns string, desc, creato
 		return err
 	}
 	// 4. notify agent
-	args := cmd.Args{
-		"namespace": ns,
-		"digest":    digest,
-	}
-	executor, err := cm.getConnKeyFromSiteID(siteID)
-	if err != nil {
-		alog.Errorf("ReleaseNamespace: get executor by site id err: %v ", err)
+	req := &cmd.Req{Name: cmd.CmdNSPackageHandler}
+	if err := cmd.SetNSPackagePayload(req, &pb.NSPackagePayload{Namespace: ns, Digest: digest}); err != nil {
+		alog.Errorf("ReleaseNamespace: set payload of cmd %s err: %v ", cmd.CmdNSPackageHandler, err)
 		tx.Rollback()
 		return err
 	}
-	c := cm.cmdServer.NewCmdReq(cmd.CmdNSPackageHandler, args, executor)
-	resp, err := cm.cmdServer.SendSync(c, 3)
-	if err != nil {
-		alog.Errorf("Send Cmd %s failed: %v ", cmd.CmdNSPackageHandler, err)
+	target := outbox.SiteTarget(siteID)
+	if _, err := cm.outbox.Enqueue(target, req, creator, tx); err != nil {
+		alog.Errorf("ReleaseNamespace: enqueue cmd %s err: %v ", cmd.CmdNSPackageHandler, err)
 		tx.Rollback()
 		return err
 	}
-	if resp.Code == apis.FailCode {
-		alog.Errorf("Send Cmd %s failed: %v ", cmd.CmdNSPackageHandler, resp.Msg)
-		tx.Rollback()
-		return fmt.Errorf(resp.Msg)
-	}
 
 	tx.Commit()
+	// deliver in background if agent is connected, or it will be delivered when agent connected,
+	// never block the release by a slow agent, nor cancel it when the request finished
+	go cm.outbox.Deliver(detach(ctx), target)
 	return nil
 }
 
@@ -2079,16 +2087,3 @@ func (cm *configManager) getSiteIDFromConnKey(connKey string) (string, error) {
 
 	return connInfos[0], nil
 }
-
-func (cm *configManager) getConnKeyFromSiteID(siteID string) (string, error) {
-
-	cluster, err := model2.GetClusterBySiteID(siteID)
-	if err != nil {
-		return "", err
-	}
-	if cluster.ConnKey == "" {
-		return "", fmt.Errorf("cluster miss")
-	}
-
-	return cluster.ConnKey, nil
-}
@@ -1,6 +1,7 @@
 package configserver
 
 import (
+	"context"
 	"mime/multipart"
 
 	model "code.xxxxx.cn/platform/galaxy/pkg/manager/model/configserver"
@@ -20,12 +21,12 @@ type Manager interface {
 	ListConfigs(query string, orders []string, offset, limit int) ([]*model.ConfigInfo, error)
 	// UpdateConfig update a config
 	UpdateConfig(info *model.ConfigInfo) error
-	// ReleaseConfig release a config
-	ReleaseConfig(id uint64, desc, creator string) error
+	// ReleaseConfig release a config, agent is notified by outbox in background
+	ReleaseConfig(ctx context.Context, id uint64, desc, creator string) error
 	// ReleaseConfigDetail get release config detail
 	ReleaseConfigDetail(id uint64) (string, []*model.ConfigInstance, error)
-	// ReleaseNamespace
-	ReleaseNamespace(siteID string, ns string, desc, creator string) error
+	// ReleaseNamespace release configs of namespace, agent is notified by outbox in background
+	ReleaseNamespace(ctx context.Context, siteID string, ns string, desc, creator string) error
 	// ReleaseNamespaceDetail get release ns detail
 	ReleaseNamespaceDetail(siteID string, ns string) ([]*model.ConfigAndInstance, error)
 	// RollbackConfig rollback a config
@@ -16,12 +16,15 @@ limitations under the License.
 
 package log
 
-import "io"
+import (
+	"context"
+	"io"
+)
 
 // Manager is controller of training task log
 type Manager interface {
 	// GetLog return logs matched by params
 	GetLog(params map[string]string) ([]string, error)
-	// GetLogStream return logs stream
-	GetLogStream(params map[string]string, executor string) (io.ReadCloser, error)
+	// GetLogStream return logs stream, the stream will be closed when ctx done
+	GetLogStream(ctx context.Context, params map[string]string, executor string) (io.ReadCloser, error)
 }
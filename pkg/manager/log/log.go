@@ -90,9 +90,9 @@ func (m logManager) GetLog(params map[string]string) ([]string, error) {
 }
 
 // GetLogStream return stream of log
-func (m logManager) GetLogStream(params map[string]string, executor string) (io.ReadCloser, error) {
+func (m logManager) GetLogStream(ctx context.Context, params map[string]string, executor string) (io.ReadCloser, error) {
 	req := m.cmdServer.NewCmdReq(cmd.GetContainerLog, params, executor)
-	resp, err := m.cmdServer.SendSync(req, 0)
+	resp, err := m.cmdServer.SendSyncContext(ctx, req)
 	if err != nil {
 		return nil, err
 	}
@@ -101,6 +101,12 @@ func UpdateClusterStatus(connKey string, status ClusterStatus) error {
 	})
 }
 
+// UpdateClusterHeartbeat update heartbeat time of the cluster connected by connKey, and mark it Ready
+func UpdateClusterHeartbeat(connKey string, heartbeatAt time.Time) error {
+	return db.Get().Model(&Cluster{}).Where("conn_key = ? AND status != 'deleted'", connKey).
+		Updates(Cluster{HeartbeatAt: &heartbeatAt, Status: ClusterStatusReady}).Error
+}
+
 // ListCluster get page of AppInfo list
 func ListCluster(query string, orders []string, offset int, limit int) ([]*Cluster, error) {
 	clusters := []*Cluster{}
@@ -134,6 +140,15 @@ func GetClusterBySiteID(siteID string) (*Cluster, error) {
 	return cluster, nil
 }
 
+// GetClusterByID get the cluster by id
+func GetClusterByID(id uint64) (*Cluster, error) {
+	cluster := &Cluster{}
+	if err := db.Get().Model(&Cluster{}).Where("id = ?", id).First(cluster).Error; err != nil {
+		return nil, err
+	}
+	return cluster, nil
+}
+
 // DeleteCluster delete a cluster
 func DeleteCluster(id uint64) error {
 	err := db.Get().First(&Cluster{}, "id = ?", id).Error
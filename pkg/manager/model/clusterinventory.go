@@ -0,0 +1,51 @@
+package model
+
+import (
+	"time"
+
+	"code.xxxxx.cn/platform/galaxy/pkg/manager/db"
+
+	"gorm.io/gorm"
+)
+
+func init() {
+	db.RegisterDBTable(&ClusterInventory{})
+}
+
+// ClusterInventory is the latest kubernetes workload inventory reported by agent of a cluster
+type ClusterInventory struct {
+	ID        uint64    `gorm:"primary_key" json:"id,omitempty" description:"唯一id（不填）"`
+	CreatedAt time.Time `json:"created_at,omitempty" description:"创建时间（不填）"`
+	UpdatedAt time.Time `json:"-"`
+
+	SiteID     string    `gorm:"type:varchar(100);unique;not null" json:"site_id" description:"项目ID"`
+	ConnKey    string    `gorm:"type:varchar(100);not null" json:"conn_key" description:"上报的agent connection key"`
+	ReportedAt time.Time `json:"reported_at" description:"agent上报时间"`
+	Inventory  string    `gorm:"type:longtext" json:"inventory" description:"节点、命名空间、deployment及pod概要的json串"`
+}
+
+// SaveClusterInventory create or update the inventory of the site
+func SaveClusterInventory(inventory *ClusterInventory) error {
+	old := &ClusterInventory{}
+	err := db.Get().Where("site_id = ?", inventory.SiteID).First(old).Error
+	if err == gorm.ErrRecordNotFound {
+		return db.Get().Create(inventory).Error
+	}
+	if err != nil {
+		return err
+	}
+	return db.Get().Model(&ClusterInventory{}).Where("id = ?", old.ID).Updates(map[string]interface{}{
+		"conn_key":    inventory.ConnKey,
+		"reported_at": inventory.ReportedAt,
+		"inventory":   inventory.Inventory,
+	}).Error
+}
+
+// GetClusterInventoryBySiteID get the latest inventory of the site
+func GetClusterInventoryBySiteID(siteID string) (*ClusterInventory, error) {
+	inventory := &ClusterInventory{}
+	if err := db.Get().Where("site_id = ?", siteID).First(inventory).Error; err != nil {
+		return nil, err
+	}
+	return inventory, nil
+}
@@ -23,6 +23,7 @@ type ConfigInstance struct {
 	Hostname string `gorm:"type:varchar(100);uniqueIndex:Name_SiteID_Hostname_ConfigInfoID_ConnKey;not null" json:"hostname" description:"主机名"`
 	IP       string `gorm:"type:varchar(100);not null" json:"ip" description:"主机IP"`
 	Digest   string `gorm:"type:varchar(100);not null" json:"digest" description:"当前文件Digest"`
+	Error    string `gorm:"type:varchar(512)" json:"error,omitempty" description:"最近一次更新失败原因，成功时为空"`
 
 	ConfigInfoID uint64 `gorm:"type:bigint;uniqueIndex:Name_SiteID_Hostname_ConfigInfoID_ConnKey;not null" json:"-"`
 	IsSync       bool   `gorm:"-" json:"is_sync" description:"是否是最新"`
@@ -138,8 +139,10 @@ func SaveConfigInstance(configInstance *ConfigInstance, tx *gorm.DB) error {
 
 	cur.IP = configInstance.IP
 	cur.Digest = configInstance.Digest
+	cur.Error = configInstance.Error
 
-	return tx.Model(&ConfigInstance{}).Where(&ConfigInstance{ID: cur.ID}).Updates(cur).Error
+	// select the fields to clear the error of former failure
+	return tx.Model(&ConfigInstance{}).Where(&ConfigInstance{ID: cur.ID}).Select("ip", "digest", "error").Updates(cur).Error
 }
 
 // DeleteConfigInstance .
@@ -0,0 +1,133 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+
+	"code.xxxxx.cn/platform/galaxy/pkg/manager/db"
+)
+
+func init() {
+	db.RegisterDBTable(&CmdOutbox{})
+}
+
+// CmdOutbox is a cmd waiting to deliver to an agent, it is delivered in order of id when the agent connected
+type CmdOutbox struct {
+	ID        uint64    `gorm:"primary_key" json:"id,omitempty" description:"唯一id（不填）"`
+	CreatedAt time.Time `json:"created_at,omitempty" description:"创建时间（不填）"`
+	UpdatedAt time.Time `json:"updated_at,omitempty" description:"更新时间（不填）"`
+
+	SiteID      string       `gorm:"type:varchar(100);index" json:"site_id" description:"目标项目ID，发送给该项目当前连接的agent"`
+	Executor    string       `gorm:"type:varchar(100);index" json:"executor" description:"目标agent connection key，SiteID为空时使用"`
+	Name        string       `gorm:"type:varchar(100);not null" json:"name" description:"命令名称"`
+	UUID        string       `gorm:"type:varchar(64)" json:"uuid" description:"命令UUID，重试投递时复用，agent对同一UUID最多执行一次"`
+	Args        string       `gorm:"type:text" json:"args" description:"命令参数json字串"`
+	Payload     []byte       `gorm:"type:blob" json:"payload" description:"命令类型化参数protobuf编码，旧版agent使用Args"`
+	TypeURL     string       `gorm:"type:varchar(255)" json:"type_url" description:"命令类型化参数类型"`
+	Status      OutboxStatus `gorm:"type:varchar(20);index;not null" json:"status" description:"投递状态"`
+	Attempts    int          `gorm:"not null" json:"attempts" description:"已投递次数"`
+	LastError   string       `gorm:"type:varchar(1024)" json:"last_error" description:"最近一次投递错误"`
+	RespCode    int          `json:"resp_code" description:"agent响应码"`
+	RespMsg     string       `gorm:"type:varchar(1024)" json:"resp_msg" description:"agent响应消息"`
+	NextRetryAt time.Time    `json:"next_retry_at" description:"下次投递时间"`
+	ExpireAt    time.Time    `gorm:"index" json:"expire_at" description:"过期时间，过期后不再投递"`
+	DeliveredAt *time.Time   `json:"delivered_at" description:"投递时间"`
+	DeliveredTo string       `gorm:"type:varchar(100)" json:"delivered_to" description:"投递的agent connection key"`
+	CreatedBy   string       `gorm:"type:varchar(100)" json:"created_by" description:"创建者"`
+}
+
+// OutboxStatus the type of outbox cmd status
+type OutboxStatus string
+
+/** all outbox cmd status */
+const (
+	// OutboxStatusPending waiting to deliver
+	OutboxStatusPending OutboxStatus = "Pending"
+	// OutboxStatusDelivered delivered and agent response succeed
+	OutboxStatusDelivered OutboxStatus = "Delivered"
+	// OutboxStatusFailed the cmd is invalid to deliver, will not retry
+	OutboxStatusFailed OutboxStatus = "Failed"
+	// OutboxStatusExpired not delivered before expire time
+	OutboxStatusExpired OutboxStatus = "Expired"
+)
+
+// CreateCmdOutbox create a new outbox cmd
+func CreateCmdOutbox(outbox *CmdOutbox, tx *gorm.DB) (*CmdOutbox, error) {
+	if tx == nil {
+		tx = db.Get()
+	}
+	dbResult := tx.Create(outbox)
+
+	return outbox, dbResult.Error
+}
+
+// UpdateCmdOutbox update the delivery status of outbox cmd
+func UpdateCmdOutbox(outbox *CmdOutbox) error {
+	return db.Get().Model(&CmdOutbox{}).Where("id = ?", outbox.ID).Select(
+		"uuid", "status", "attempts", "last_error", "resp_code", "resp_msg", "next_retry_at", "expire_at", "delivered_at", "delivered_to").
+		Updates(outbox).Error
+}
+
+// GetCmdOutboxByID get the outbox cmd by id
+func GetCmdOutboxByID(id uint64) (*CmdOutbox, error) {
+	outbox := &CmdOutbox{}
+	if err := db.Get().Model(&CmdOutbox{}).Where("id = ?", id).First(outbox).Error; err != nil {
+		return nil, err
+	}
+	return outbox, nil
+}
+
+// ListCmdOutbox get page of outbox cmd list
+func ListCmdOutbox(query string, orders []string, offset int, limit int) ([]*CmdOutbox, error) {
+	outboxes := []*CmdOutbox{}
+	db := db.Get().Where(query).Offset(offset).Limit(limit)
+	for _, order := range orders {
+		db = db.Order(order)
+	}
+	if err := db.Find(&outboxes).Error; err != nil {
+		return nil, err
+	}
+	return outboxes, nil
+}
+
+// CountCmdOutbox get total size of outbox cmds
+func CountCmdOutbox(query string) (int64, error) {
+	var count int64
+	if err := db.Get().Model(&CmdOutbox{}).Where(query).Count(&count).Error; err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// ListPendingCmdOutbox get all pending outbox cmds of site or executor in order of id
+func ListPendingCmdOutbox(siteID, executor string) ([]*CmdOutbox, error) {
+	outboxes := []*CmdOutbox{}
+	db := db.Get().Where("status = ?", OutboxStatusPending)
+	if siteID != "" {
+		db = db.Where("site_id = ?", siteID)
+	} else {
+		db = db.Where("site_id = '' AND executor = ?", executor)
+	}
+	if err := db.Order("id asc").Find(&outboxes).Error; err != nil {
+		return nil, err
+	}
+	return outboxes, nil
+}
+
+// ListDueCmdOutboxTargets get distinct site and executor of pending outbox cmds need to retry before the time
+func ListDueCmdOutboxTargets(before time.Time) ([]*CmdOutbox, error) {
+	outboxes := []*CmdOutbox{}
+	if err := db.Get().Model(&CmdOutbox{}).Distinct("site_id", "executor").
+		Where("status = ? AND next_retry_at <= ?", OutboxStatusPending, before).Find(&outboxes).Error; err != nil {
+		return nil, err
+	}
+	return outboxes, nil
+}
+
+// ExpireCmdOutbox mark all pending outbox cmds expired before the time, return the number expired
+func ExpireCmdOutbox(before time.Time) (int64, error) {
+	dbResult := db.Get().Model(&CmdOutbox{}).Where("status = ? AND expire_at <= ?", OutboxStatusPending, before).
+		Update("status", OutboxStatusExpired)
+	return dbResult.RowsAffected, dbResult.Error
+}
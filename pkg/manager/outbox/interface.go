@@ -0,0 +1,53 @@
+package outbox
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+
+	"code.xxxxx.cn/platform/galaxy/pkg/component/cmd"
+	"code.xxxxx.cn/platform/galaxy/pkg/manager/model"
+)
+
+// Manager define the manager of durable cmd outbox, cmds in outbox are delivered to agents in order,
+// retried with backoff until delivered or expired
+type Manager interface {
+	// Enqueue save the name, args and payload of req to outbox of target site or executor in tx,
+	// call Deliver after tx committed
+	Enqueue(target Target, req *cmd.Req, creator string, tx *gorm.DB) (*model.CmdOutbox, error)
+	// Deliver try to deliver all pending cmds of target in order now, failed cmds will be retried later
+	Deliver(ctx context.Context, target Target)
+	// Retry reset a failed or expired cmd to pending and deliver it again
+	Retry(id uint64) (*model.CmdOutbox, error)
+	// GetCmd get the delivery status of a cmd in outbox
+	GetCmd(id uint64) (*model.CmdOutbox, error)
+	// CountCmds count cmds in outbox matched query
+	CountCmds(query string) (int64, error)
+	// ListCmds get cmds in outbox matched query, and order by orders, select a page by offset, limit
+	ListCmds(query string, orders []string, offset, limit int) ([]*model.CmdOutbox, error)
+}
+
+// Target is the receiver of outbox cmd, SiteID is preferred, the cmd will be sent to the agent currently
+// connected of the site, Executor is the connection key of executor used when SiteID is empty
+type Target struct {
+	SiteID   string
+	Executor string
+}
+
+// SiteTarget build a target of site
+func SiteTarget(siteID string) Target {
+	return Target{SiteID: siteID}
+}
+
+// ExecutorTarget build a target of executor connection key
+func ExecutorTarget(executor string) Target {
+	return Target{Executor: executor}
+}
+
+// key return the unique key of target
+func (t Target) key() string {
+	if t.SiteID != "" {
+		return "site/" + t.SiteID
+	}
+	return "executor/" + t.Executor
+}
@@ -0,0 +1,318 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+
+	"code.xxxxx.cn/platform/galaxy/pkg/apis"
+	"code.xxxxx.cn/platform/galaxy/pkg/component/cmd"
+	"code.xxxxx.cn/platform/galaxy/pkg/component/conns"
+	"code.xxxxx.cn/platform/galaxy/pkg/manager/model"
+	"code.xxxxx.cn/platform/galaxy/pkg/util/alog"
+	"code.xxxxx.cn/platform/galaxy/pkg/util/uuid"
+)
+
+const (
+	// DefaultTTL default max time to keep a cmd in outbox before delivered
+	DefaultTTL = 24 * time.Hour
+	// deliverTimeout max time to wait for agent response of every delivery
+	deliverTimeout = 10 * time.Second
+	// retryInterval interval to check expired and due cmds
+	retryInterval = 10 * time.Second
+	// minBackoff and maxBackoff bound the delay before retrying a failed delivery
+	minBackoff = 5 * time.Second
+	maxBackoff = 5 * time.Minute
+)
+
+type manager struct {
+	cmdServer cmd.Server
+	store     store
+	ttl       time.Duration
+	// lock protect targetLocks
+	lock sync.Mutex
+	// targetLocks serialize delivery of every target to keep cmds in order
+	targetLocks map[string]*sync.Mutex
+}
+
+// NewManager create a new outbox manager, deliver pending cmds when agents connected and retry them in background
+func NewManager(cmdServer cmd.Server, ttl time.Duration, stopCh <-chan struct{}) Manager {
+	if ttl <= 0 {
+		ttl = DefaultTTL
+	}
+	m := &manager{
+		cmdServer:   cmdServer,
+		store:       modelStore{},
+		ttl:         ttl,
+		targetLocks: make(map[string]*sync.Mutex),
+	}
+
+	m.cmdServer.GetConnManager().OnReady(m.onReady)
+	go m.retryLoop(stopCh)
+	return m
+}
+
+// Enqueue save a cmd to outbox in tx, the uuid and executor of req are set when delivered
+func (m *manager) Enqueue(target Target, req *cmd.Req, creator string, tx *gorm.DB) (*model.CmdOutbox, error) {
+	if target.SiteID == "" && target.Executor == "" {
+		return nil, fmt.Errorf("outbox target of cmd %s can't be empty", req.Name)
+	}
+	data, err := json.Marshal(req.Args)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	return m.store.create(&model.CmdOutbox{
+		SiteID:      target.SiteID,
+		Executor:    target.Executor,
+		Name:        string(req.Name),
+		UUID:        uuid.NewUUID(),
+		Args:        string(data),
+		Payload:     req.Payload,
+		TypeURL:     req.TypeURL,
+		Status:      model.OutboxStatusPending,
+		NextRetryAt: now,
+		ExpireAt:    now.Add(m.ttl),
+		CreatedBy:   creator,
+	}, tx)
+}
+
+// Deliver deliver pending cmds of target in order, stop at the first cmd not delivered
+func (m *manager) Deliver(ctx context.Context, target Target) {
+	m.deliver(ctx, target, true)
+}
+
+// Retry reset a failed or expired cmd to pending and deliver it again
+func (m *manager) Retry(id uint64) (*model.CmdOutbox, error) {
+	outbox, err := m.store.get(id)
+	if err != nil {
+		return nil, err
+	}
+	if outbox.Status == model.OutboxStatusDelivered {
+		return nil, fmt.Errorf("outbox cmd %d is already delivered", id)
+	}
+	now := time.Now()
+	// keep the uuid, agent replays the response succeed even if it was cancelled, the failed cmd is executed again
+	outbox.Status = model.OutboxStatusPending
+	outbox.NextRetryAt = now
+	if outbox.ExpireAt.Before(now.Add(m.ttl)) {
+		outbox.ExpireAt = now.Add(m.ttl)
+	}
+	if err := m.store.update(outbox); err != nil {
+		return nil, err
+	}
+	go m.Deliver(context.Background(), Target{SiteID: outbox.SiteID, Executor: outbox.Executor})
+	return outbox, nil
+}
+
+// GetCmd get the delivery status of a cmd in outbox
+func (m *manager) GetCmd(id uint64) (*model.CmdOutbox, error) {
+	return m.store.get(id)
+}
+
+// CountCmds count cmds in outbox matched query
+func (m *manager) CountCmds(query string) (int64, error) {
+	return model.CountCmdOutbox(query)
+}
+
+// ListCmds get cmds in outbox matched query, and order by orders, select a page by offset, limit
+func (m *manager) ListCmds(query string, orders []string, offset, limit int) ([]*model.CmdOutbox, error) {
+	return model.ListCmdOutbox(query, orders, offset, limit)
+}
+
+// onReady deliver pending cmds of the site or executor when agent connected
+func (m *manager) onReady(conn *conns.Conn) {
+	ctx := context.Background()
+	if connInfos := strings.Split(conn.Key, apis.ConnectionSplit); len(connInfos) == 2 {
+		m.deliver(ctx, SiteTarget(connInfos[0]), true)
+	}
+	m.deliver(ctx, ExecutorTarget(conn.Key), true)
+}
+
+// retryLoop expire outdated cmds and retry due cmds periodically until stopped
+func (m *manager) retryLoop(stopCh <-chan struct{}) {
+	ticker := time.NewTicker(retryInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C:
+		}
+
+		now := time.Now()
+		if expired, err := m.store.expire(now); err != nil {
+			alog.Errorf("Expire outbox cmds failed: %v", err)
+		} else if expired > 0 {
+			alog.Warningf("Expired %d outbox cmds not delivered before %v", expired, now)
+		}
+
+		targets, err := m.store.listDueTargets(now)
+		if err != nil {
+			alog.Errorf("List due outbox cmds failed: %v", err)
+			continue
+		}
+		for _, t := range targets {
+			m.deliver(context.Background(), Target{SiteID: t.SiteID, Executor: t.Executor}, false)
+		}
+	}
+}
+
+// deliver send pending cmds of target in order, force deliver the first cmd even if its retry time not arrived
+func (m *manager) deliver(ctx context.Context, target Target, force bool) {
+	lock := m.targetLock(target)
+	lock.Lock()
+	defer lock.Unlock()
+
+	outboxes, err := m.store.listPending(target.SiteID, target.Executor)
+	if err != nil {
+		alog.Errorf("List pending outbox cmds of %s failed: %v", target.key(), err)
+		return
+	}
+	if len(outboxes) == 0 {
+		return
+	}
+	if !force && outboxes[0].NextRetryAt.After(time.Now()) {
+		return
+	}
+	executor, ok := m.resolveExecutor(target)
+	if !ok {
+		alog.V(4).Infof("Target %s is not connected, %d outbox cmds keep pending", target.key(), len(outboxes))
+		return
+	}
+	for _, outbox := range outboxes {
+		if !m.deliverOne(ctx, outbox, executor) {
+			// keep the order, later cmds wait until this one delivered or expired
+			return
+		}
+	}
+}
+
+// deliverOne send a cmd to executor and save the result, return false if it should be retried later
+func (m *manager) deliverOne(ctx context.Context, outbox *model.CmdOutbox, executor string) bool {
+	now := time.Now()
+	if !outbox.ExpireAt.After(now) {
+		outbox.Status = model.OutboxStatusExpired
+		m.save(outbox)
+		return true
+	}
+
+	args := cmd.Args{}
+	if err := json.Unmarshal([]byte(outbox.Args), &args); err != nil {
+		outbox.Status = model.OutboxStatusFailed
+		outbox.LastError = fmt.Sprintf("invalid args: %v", err)
+		m.save(outbox)
+		return true
+	}
+
+	if c, err := m.cmdServer.Capabilities(executor); err == nil && !c.Supports(cmd.Name(outbox.Name)) {
+		// the agent is too old to exec the cmd, keep it and the later ones pending until the agent upgraded,
+		// it is delivered again when the agent registers again
+		outbox.LastError = fmt.Sprintf("cmd %s is not supported by executor %s of version %s", outbox.Name, executor, c.Version)
+		outbox.NextRetryAt = now.Add(maxBackoff)
+		alog.Warningf("Outbox cmd %d is pending until executor upgraded: %s", outbox.ID, outbox.LastError)
+		m.save(outbox)
+		return false
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, deliverTimeout)
+	defer cancel()
+	outbox.Attempts++
+	req := m.cmdServer.NewCmdReq(cmd.Name(outbox.Name), args, executor)
+	// the typed payload is sent with the legacy args, older agents read the args
+	req.Payload, req.TypeURL = outbox.Payload, outbox.TypeURL
+	if outbox.UUID != "" {
+		// reuse the uuid in every delivery, agent replays the response if it executed the cmd
+		req.UUID = outbox.UUID
+	}
+	resp, err := m.cmdServer.SendSyncContext(ctx, req)
+	if err == nil && resp.IsStream() {
+		if err := resp.Close(); err != nil {
+			alog.Warningf("Close stream resp of outbox cmd %d failed: %v", outbox.ID, err)
+		}
+	}
+	if err == nil && resp.Code != cmd.SuccessCode {
+		// agent is still executing it or failed, the failed cmd is executed again by the retry,
+		// the later cmds wait until it succeed or expired, as they may depend on it
+		outbox.RespCode, outbox.RespMsg = resp.Code, resp.Msg
+		err = fmt.Errorf("executor %s response code %d: %s", executor, resp.Code, resp.Msg)
+	}
+	if err != nil {
+		outbox.LastError = err.Error()
+		outbox.NextRetryAt = now.Add(backoff(outbox.Attempts))
+		alog.Warningf("Deliver outbox cmd %d %s to %s failed, retry at %v: %v",
+			outbox.ID, outbox.Name, executor, outbox.NextRetryAt, err)
+		m.save(outbox)
+		return false
+	}
+
+	deliveredAt := time.Now()
+	outbox.RespCode, outbox.RespMsg = resp.Code, resp.Msg
+	outbox.DeliveredAt, outbox.DeliveredTo = &deliveredAt, executor
+	outbox.LastError = ""
+	outbox.Status = model.OutboxStatusDelivered
+	m.save(outbox)
+	return true
+}
+
+// save update delivery status of outbox cmd
+func (m *manager) save(outbox *model.CmdOutbox) {
+	if err := m.store.update(outbox); err != nil {
+		alog.Errorf("Update outbox cmd %d to %s failed: %v", outbox.ID, outbox.Status, err)
+	}
+}
+
+// resolveExecutor find the connection key of target currently connected
+func (m *manager) resolveExecutor(target Target) (string, bool) {
+	connManager := m.cmdServer.GetConnManager()
+	if target.SiteID == "" {
+		_, err := connManager.GetConnValue(target.Executor)
+		return target.Executor, err == nil
+	}
+
+	prefix := target.SiteID + apis.ConnectionSplit
+	connected := connManager.ListConns(func(conn *conns.Conn) bool {
+		return strings.HasPrefix(conn.Key, prefix)
+	})
+	if len(connected) == 0 {
+		return "", false
+	}
+	// prefer the connection recorded in cluster if the site has several agents connected
+	if connKey, err := m.store.clusterConnKey(target.SiteID); err == nil {
+		for _, conn := range connected {
+			if conn.Key == connKey {
+				return conn.Key, true
+			}
+		}
+	}
+	return connected[0].Key, true
+}
+
+// targetLock get the delivery lock of target
+func (m *manager) targetLock(target Target) *sync.Mutex {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	lock, ok := m.targetLocks[target.key()]
+	if !ok {
+		lock = &sync.Mutex{}
+		m.targetLocks[target.key()] = lock
+	}
+	return lock
+}
+
+// backoff return the delay before next retry, doubled by every attempt
+func backoff(attempts int) time.Duration {
+	delay := minBackoff
+	for i := 1; i < attempts && delay < maxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > maxBackoff {
+		delay = maxBackoff
+	}
+	return delay
+}
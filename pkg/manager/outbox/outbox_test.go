@@ -0,0 +1,309 @@
+package outbox
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+
+	"code.xxxxx.cn/platform/galaxy/pkg/component/cmd"
+	"code.xxxxx.cn/platform/galaxy/pkg/component/cmd/cmdtest"
+	pb "code.xxxxx.cn/platform/galaxy/pkg/component/cmd/v1"
+	"code.xxxxx.cn/platform/galaxy/pkg/manager/model"
+)
+
+// memStore is a store in memory instead of db
+type memStore struct {
+	lock     sync.Mutex
+	next     uint64
+	outboxes map[uint64]model.CmdOutbox
+}
+
+func newMemStore() *memStore {
+	return &memStore{outboxes: make(map[uint64]model.CmdOutbox)}
+}
+
+func (s *memStore) create(outbox *model.CmdOutbox, tx *gorm.DB) (*model.CmdOutbox, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.next++
+	outbox.ID = s.next
+	s.outboxes[outbox.ID] = *outbox
+	return outbox, nil
+}
+
+func (s *memStore) update(outbox *model.CmdOutbox) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.outboxes[outbox.ID] = *outbox
+	return nil
+}
+
+func (s *memStore) get(id uint64) (*model.CmdOutbox, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	outbox, ok := s.outboxes[id]
+	if !ok {
+		return nil, fmt.Errorf("outbox cmd %d not found", id)
+	}
+	return &outbox, nil
+}
+
+func (s *memStore) listPending(siteID, executor string) ([]*model.CmdOutbox, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	var list []*model.CmdOutbox
+	for _, outbox := range s.outboxes {
+		if outbox.Status == model.OutboxStatusPending && outbox.SiteID == siteID && (siteID != "" || outbox.Executor == executor) {
+			o := outbox
+			list = append(list, &o)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list, nil
+}
+
+func (s *memStore) listDueTargets(before time.Time) ([]*model.CmdOutbox, error) {
+	return nil, nil
+}
+
+func (s *memStore) expire(before time.Time) (int64, error) {
+	return 0, nil
+}
+
+func (s *memStore) clusterConnKey(siteID string) (string, error) {
+	return "", fmt.Errorf("cluster of site %s not found", siteID)
+}
+
+func newTestManager(h *cmdtest.Harness) (*manager, *memStore) {
+	s := newMemStore()
+	return &manager{
+		cmdServer:   h.Server,
+		store:       s,
+		ttl:         DefaultTTL,
+		targetLocks: make(map[string]*sync.Mutex),
+	}, s
+}
+
+func TestDeliverInOrder(t *testing.T) {
+	h := cmdtest.New(t)
+	defer h.Close()
+
+	handler := cmdtest.NewFakeHandler(nil)
+	executor := cmdtest.NewClientName("outbox")
+	h.AddExecutor(executor, map[cmd.Name]*cmdtest.FakeHandler{"release": handler})
+	m, s := newTestManager(h)
+
+	target := ExecutorTarget(executor)
+	for i := 0; i < 3; i++ {
+		if _, err := m.Enqueue(target, &cmd.Req{Name: "release", Args: cmd.Args{"seq": fmt.Sprint(i)}}, "test", nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	m.Deliver(context.Background(), target)
+
+	reqs := handler.Reqs()
+	if len(reqs) != 3 {
+		t.Fatalf("expect 3 cmds delivered, got %d", len(reqs))
+	}
+	for i, req := range reqs {
+		if req.Args.Get("seq") != fmt.Sprint(i) {
+			t.Errorf("expect cmd %d delivered in order, got %s", i, req.Args.Get("seq"))
+		}
+	}
+	for id := uint64(1); id <= 3; id++ {
+		if outbox, _ := s.get(id); outbox.Status != model.OutboxStatusDelivered || outbox.DeliveredTo != executor {
+			t.Errorf("expect cmd %d delivered to %s, got %+v", id, executor, outbox)
+		}
+	}
+}
+
+func TestDeliverBackoff(t *testing.T) {
+	h := cmdtest.New(t)
+	defer h.Close()
+
+	handler := cmdtest.NewFakeHandler(nil)
+	executor := cmdtest.NewClientName("outbox")
+	h.AddExecutor(executor, map[cmd.Name]*cmdtest.FakeHandler{"release": handler})
+	m, s := newTestManager(h)
+
+	target := ExecutorTarget(executor)
+	first, _ := m.Enqueue(target, &cmd.Req{Name: "release"}, "test", nil)
+	second, _ := m.Enqueue(target, &cmd.Req{Name: "release"}, "test", nil)
+
+	// the agent never responses, the first cmd is retried later and blocks the second one
+	h.Drop(cmdtest.And(cmdtest.ByName("release"), cmdtest.ByDirection(cmdtest.ToServer)))
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	m.Deliver(ctx, target)
+	cancel()
+	failed, _ := s.get(first.ID)
+	if failed.Status != model.OutboxStatusPending || failed.Attempts != 1 || failed.LastError == "" {
+		t.Fatalf("expect first cmd pending to retry, got %+v", failed)
+	}
+	if delay := failed.NextRetryAt.Sub(time.Now()); delay <= 0 || delay > minBackoff {
+		t.Errorf("expect first cmd retried after %v, got %v", minBackoff, delay)
+	}
+	if blocked, _ := s.get(second.ID); blocked.Status != model.OutboxStatusPending || blocked.Attempts != 0 {
+		t.Errorf("expect second cmd not delivered before first one, got %+v", blocked)
+	}
+
+	// the retry loop never delivers before the retry time
+	h.ResetDrops()
+	m.deliver(context.Background(), target, false)
+	if reqs := handler.Reqs(); len(reqs) != 1 {
+		t.Errorf("expect no delivery before retry time, got %d", len(reqs))
+	}
+
+	// retried with the same uuid, the agent replays the response instead of executing it again
+	m.Deliver(context.Background(), target)
+	if delivered, _ := s.get(first.ID); delivered.Status != model.OutboxStatusDelivered || delivered.Attempts != 2 {
+		t.Errorf("expect first cmd delivered by retry, got %+v", delivered)
+	}
+	if delivered, _ := s.get(second.ID); delivered.Status != model.OutboxStatusDelivered {
+		t.Errorf("expect second cmd delivered, got %+v", delivered)
+	}
+	if reqs := handler.Reqs(); len(reqs) != 2 || reqs[0].UUID != failed.UUID {
+		t.Errorf("expect first cmd executed once, got %d reqs", len(reqs))
+	}
+
+	for attempts, expect := range map[int]time.Duration{1: minBackoff, 2: 2 * minBackoff, 100: maxBackoff} {
+		if delay := backoff(attempts); delay != expect {
+			t.Errorf("expect backoff of %d attempts %v, got %v", attempts, expect, delay)
+		}
+	}
+}
+
+func TestDeliverExpired(t *testing.T) {
+	h := cmdtest.New(t)
+	defer h.Close()
+
+	handler := cmdtest.NewFakeHandler(nil)
+	executor := cmdtest.NewClientName("outbox")
+	h.AddExecutor(executor, map[cmd.Name]*cmdtest.FakeHandler{"release": handler})
+	m, s := newTestManager(h)
+
+	target := ExecutorTarget(executor)
+	expired, _ := m.Enqueue(target, &cmd.Req{Name: "release", Args: cmd.Args{"seq": "0"}}, "test", nil)
+	expired.ExpireAt = time.Now().Add(-time.Second)
+	s.update(expired)
+	m.Enqueue(target, &cmd.Req{Name: "release", Args: cmd.Args{"seq": "1"}}, "test", nil)
+
+	// the expired cmd is never delivered, and never blocks the later ones
+	m.Deliver(context.Background(), target)
+	if outbox, _ := s.get(expired.ID); outbox.Status != model.OutboxStatusExpired || outbox.Attempts != 0 {
+		t.Errorf("expect cmd expired without delivery, got %+v", outbox)
+	}
+	if reqs := handler.Reqs(); len(reqs) != 1 || reqs[0].Args.Get("seq") != "1" {
+		t.Errorf("expect only cmd not expired delivered, got %d", len(reqs))
+	}
+
+	// an expired cmd is delivered again once retried
+	if _, err := m.Retry(expired.ID); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(cmdtest.DefaultTimeout)
+	for time.Now().Before(deadline) {
+		if outbox, _ := s.get(expired.ID); outbox.Status == model.OutboxStatusDelivered {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Errorf("expect expired cmd delivered after retried")
+}
+
+func TestDeliverUnsupported(t *testing.T) {
+	h := cmdtest.New(t)
+	defer h.Close()
+
+	executor := cmdtest.NewClientName("outbox")
+	h.AddExecutor(executor, map[cmd.Name]*cmdtest.FakeHandler{"other": cmdtest.NewFakeHandler(nil)})
+	m, s := newTestManager(h)
+
+	target := ExecutorTarget(executor)
+	unsupported, _ := m.Enqueue(target, &cmd.Req{Name: "release"}, "test", nil)
+	later, _ := m.Enqueue(target, &cmd.Req{Name: "other"}, "test", nil)
+
+	// the cmd not supported keeps pending, and blocks the later ones until the agent upgraded
+	m.Deliver(context.Background(), target)
+	if outbox, _ := s.get(unsupported.ID); outbox.Status != model.OutboxStatusPending || outbox.Attempts != 0 || outbox.LastError == "" {
+		t.Errorf("expect cmd not supported pending, got %+v", outbox)
+	}
+	if outbox, _ := s.get(later.ID); outbox.Status != model.OutboxStatusPending || outbox.Attempts != 0 {
+		t.Errorf("expect later cmd not delivered, got %+v", outbox)
+	}
+}
+
+func TestDeliverRespFailed(t *testing.T) {
+	h := cmdtest.New(t)
+	defer h.Close()
+
+	count := 0
+	handler := cmdtest.NewFakeHandler(func(req *cmd.Req) *cmd.Resp {
+		count++
+		if count == 1 {
+			return cmd.RespFailed()
+		}
+		return cmd.RespSucceed("")
+	})
+	executor := cmdtest.NewClientName("outbox")
+	h.AddExecutor(executor, map[cmd.Name]*cmdtest.FakeHandler{"release": handler})
+	m, s := newTestManager(h)
+
+	target := ExecutorTarget(executor)
+	first, _ := m.Enqueue(target, &cmd.Req{Name: "release", Args: cmd.Args{"seq": "0"}}, "test", nil)
+	second, _ := m.Enqueue(target, &cmd.Req{Name: "release", Args: cmd.Args{"seq": "1"}}, "test", nil)
+
+	// the cmd failed at agent is retried later, and blocks the later ones
+	m.Deliver(context.Background(), target)
+	failed, _ := s.get(first.ID)
+	if failed.Status != model.OutboxStatusPending || failed.RespCode != cmd.FailCode || failed.LastError == "" {
+		t.Fatalf("expect cmd failed pending to retry, got %+v", failed)
+	}
+	if outbox, _ := s.get(second.ID); outbox.Status != model.OutboxStatusPending || outbox.Attempts != 0 {
+		t.Errorf("expect later cmd not delivered, got %+v", outbox)
+	}
+
+	// the failed cmd is executed again by the retry
+	m.Deliver(context.Background(), target)
+	for _, id := range []uint64{first.ID, second.ID} {
+		if outbox, _ := s.get(id); outbox.Status != model.OutboxStatusDelivered {
+			t.Errorf("expect cmd %d delivered, got %+v", id, outbox)
+		}
+	}
+	if reqs := handler.Reqs(); len(reqs) != 3 || reqs[0].UUID != reqs[1].UUID {
+		t.Errorf("expect failed cmd executed again with the same uuid, got %d reqs", len(reqs))
+	}
+}
+
+func TestDeliverPayload(t *testing.T) {
+	h := cmdtest.New(t)
+	defer h.Close()
+
+	handler := cmdtest.NewFakeHandler(nil)
+	executor := cmdtest.NewClientName("outbox")
+	h.AddExecutor(executor, map[cmd.Name]*cmdtest.FakeHandler{cmd.CmdNSPackageHandler: handler})
+	m, _ := newTestManager(h)
+
+	target := ExecutorTarget(executor)
+	req := &cmd.Req{Name: cmd.CmdNSPackageHandler}
+	if err := cmd.SetNSPackagePayload(req, &pb.NSPackagePayload{Namespace: "ns", Digest: "digest"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Enqueue(target, req, "test", nil); err != nil {
+		t.Fatal(err)
+	}
+	m.Deliver(context.Background(), target)
+
+	// the typed payload is delivered with the legacy args
+	reqs := handler.Reqs()
+	if len(reqs) != 1 || !reqs[0].HasPayload() || reqs[0].Args.Get("namespace") != "ns" {
+		t.Fatalf("expect cmd delivered with payload and args, got %+v", reqs)
+	}
+	if p, err := cmd.GetNSPackagePayload(reqs[0]); err != nil || p.Namespace != "ns" || p.Digest != "digest" {
+		t.Errorf("unexpected payload %+v: %v", p, err)
+	}
+}
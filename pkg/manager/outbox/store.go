@@ -0,0 +1,59 @@
+package outbox
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+
+	"code.xxxxx.cn/platform/galaxy/pkg/manager/model"
+)
+
+// store persist the outbox cmds to deliver, it is backed by model in manager
+type store interface {
+	create(outbox *model.CmdOutbox, tx *gorm.DB) (*model.CmdOutbox, error)
+	update(outbox *model.CmdOutbox) error
+	get(id uint64) (*model.CmdOutbox, error)
+	// listPending get pending cmds of site or executor in order of id
+	listPending(siteID, executor string) ([]*model.CmdOutbox, error)
+	// listDueTargets get distinct targets of pending cmds need to retry before the time
+	listDueTargets(before time.Time) ([]*model.CmdOutbox, error)
+	// expire mark pending cmds expired before the time, return the number expired
+	expire(before time.Time) (int64, error)
+	// clusterConnKey get the connection key recorded in cluster of site
+	clusterConnKey(siteID string) (string, error)
+}
+
+// modelStore is the store backed by db tables of model
+type modelStore struct{}
+
+func (modelStore) create(outbox *model.CmdOutbox, tx *gorm.DB) (*model.CmdOutbox, error) {
+	return model.CreateCmdOutbox(outbox, tx)
+}
+
+func (modelStore) update(outbox *model.CmdOutbox) error {
+	return model.UpdateCmdOutbox(outbox)
+}
+
+func (modelStore) get(id uint64) (*model.CmdOutbox, error) {
+	return model.GetCmdOutboxByID(id)
+}
+
+func (modelStore) listPending(siteID, executor string) ([]*model.CmdOutbox, error) {
+	return model.ListPendingCmdOutbox(siteID, executor)
+}
+
+func (modelStore) listDueTargets(before time.Time) ([]*model.CmdOutbox, error) {
+	return model.ListDueCmdOutboxTargets(before)
+}
+
+func (modelStore) expire(before time.Time) (int64, error) {
+	return model.ExpireCmdOutbox(before)
+}
+
+func (modelStore) clusterConnKey(siteID string) (string, error) {
+	cluster, err := model.GetClusterBySiteID(siteID)
+	if err != nil {
+		return "", err
+	}
+	return cluster.ConnKey, nil
+}
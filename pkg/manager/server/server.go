@@ -1,9 +1,7 @@
 package server
 
 import (
-	"crypto/rand"
-	"crypto/tls"
-	"crypto/x509"
+	"fmt"
 	"io/ioutil"
 	"log"
 	"net"
@@ -21,6 +19,7 @@ import (
 	grpc_prometheus "github.com/grpc-ecosystem/go-grpc-prometheus"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials"
+	"gopkg.in/yaml.v2"
 )
 
 // Server hold all to build a server provide services, contains grpc services, restful services, and websocket services
@@ -42,8 +41,20 @@ type Server struct {
 // NewServer init a server to listen and serve
 func NewServer(cfg *config.ManagerConfiguration, stopCh <-chan struct{}) *Server {
 	webServer := restful.NewContainer()
-	cmdServer := cmd.NewCmdServer(stopCh)
-	grpcServer := newGRPCServer(cfg.GRPCInsecure, cfg.CertFile, cfg.KeyFile, cfg.CAFile, cmdServer.GetConnManager())
+	cmdOpts := []cmd.Option{
+		cmd.WithInterceptors(cmd.DefaultInterceptors()...),
+		cmd.WithHeartbeat(cmd.DefaultHeartbeatInterval, cmd.DefaultHeartbeatMaxMisses),
+	}
+	if cfg.SiteIdentityFile != "" {
+		sites, err := loadSiteIdentities(cfg.SiteIdentityFile)
+		if err != nil {
+			alog.Fatalf("Load site identities failed: %v", err)
+		}
+		cmdOpts = append(cmdOpts, cmd.WithIdentityAuthorizer(cmd.SiteIdentityAuthorizer(sites)))
+	}
+	cmdServer := cmd.NewCmdServer(stopCh, cmdOpts...)
+	keepaliveOpts := conns.ServerKeepaliveOptions(cfg.GRPCKeepaliveMinTime, cfg.GRPCKeepaliveTime, cfg.GRPCKeepaliveTimeout)
+	grpcServer := newGRPCServer(cfg.GRPCInsecure, cfg.CertFile, cfg.KeyFile, cfg.CAFile, cmdServer.GetConnManager(), stopCh, keepaliveOpts...)
 	tokenManager := auth.NewJwtTokenManager(cfg.PMPSecret, cfg.AuthTokenTTL)
 	authSDK := auth.NewAuthSDK(cfg.AuthClientID, cfg.AuthClientSecret, cfg.AuthAddr)
 	authManager := auth.NewAuthManager(webServer, tokenManager, authSDK, cfg.AuthSkip)
@@ -75,56 +86,39 @@ func (s *Server) StartManagerServer() {
 	go s.startMetricServer(s.config.MetricServerAddr)
 }
 
-func newGRPCServer(insecure bool, certFile, keyFile, caFile string, connManager *conns.ConnManager) *grpc.Server {
-	// FIXME NOW EXPERIMENTAL， make configurable?
-	//var kaep = keepalive.EnforcementPolicy{
-	//	MinTime:             5 * time.Second, // If a client pings more than once every 5 seconds, terminate the connection
-	//	PermitWithoutStream: true,            // Allow pings even when there are no active streams
-	//}
-	//
-	//var kasp = keepalive.ServerParameters{
-	//	MaxConnectionIdle:     15 * time.Second, // If a client is idle for 15 seconds, send a GOAWAY
-	//	MaxConnectionAge:      30 * time.Second, // If any connection is alive for more than 30 seconds, send a GOAWAY
-	//	MaxConnectionAgeGrace: 5 * time.Second,  // Allow 5 seconds for pending RPCs to complete before forcibly closing connections
-	//	Time:                  5 * time.Second,  // Ping the client if it is idle for 5 seconds to ensure the connection is still active
-	//	Timeout:               1 * time.Second,  // Wait 1 second for the ping ack before assuming the connection is dead
-	//}
+// loadSiteIdentities load the yaml file maps identity of agent certificate to site ids
+func loadSiteIdentities(file string) (map[string][]string, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	sites := make(map[string][]string)
+	if err := yaml.Unmarshal(data, &sites); err != nil {
+		return nil, fmt.Errorf("parse site identity file %s failed: %v", file, err)
+	}
+	return sites, nil
+}
 
+// newGRPCServer build grpc server, keepaliveOpts enforce the keepalive policy of agents, the cert, key and ca
+// files are reloaded when modified until stopCh closed
+func newGRPCServer(insecure bool, certFile, keyFile, caFile string, connManager *conns.ConnManager, stopCh <-chan struct{}, keepaliveOpts ...grpc.ServerOption) *grpc.Server {
 	opts := []grpc.ServerOption{
 		grpc.StatsHandler(connManager),
 		grpc.StreamInterceptor(grpc_prometheus.StreamServerInterceptor),
 		grpc.UnaryInterceptor(grpc_prometheus.UnaryServerInterceptor),
-		//grpc.KeepaliveEnforcementPolicy(kaep),
-		//grpc.KeepaliveParams(kasp),
 	}
+	opts = append(opts, keepaliveOpts...)
 	if insecure {
 		alog.V(4).Infof("Use insecure grpc server without tls")
 	} else {
 		alog.V(4).Infof("Use secure grpc server with tls")
-		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		reloader, err := conns.NewKeyPairReloader(certFile, keyFile, caFile)
 		if err != nil {
 			alog.Fatalf("Load keys and certs failed: %s", err)
 		}
+		go reloader.Watch(conns.DefaultCertReloadPeriod, stopCh)
 
-		tlsConfig := &tls.Config{
-			ClientAuth:         tls.RequireAndVerifyClientCert,
-			Certificates:       []tls.Certificate{cert},
-			InsecureSkipVerify: false,
-			Rand:               rand.Reader,
-			ServerName:         conns.ManagerAddrDN,
-		}
-
-		if caFile != "" {
-			certPool := x509.NewCertPool()
-			caCrt, err := ioutil.ReadFile(caFile)
-			if err != nil {
-				alog.Fatalf("Read ca file failed: %v", err)
-			}
-			certPool.AppendCertsFromPEM(caCrt)
-			tlsConfig.ClientCAs = certPool
-		}
-
-		creds := credentials.NewTLS(tlsConfig)
+		creds := credentials.NewTLS(reloader.ServerTLSConfig(conns.ManagerAddrDN))
 		opts = append(opts, grpc.Creds(creds))
 	}
 
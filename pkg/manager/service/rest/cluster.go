@@ -81,6 +81,12 @@ func (as *clusterService) addRoutes(ws *restful.WebService, tags []string) {
 		Param(ws.PathParameter("id", "获取集群唯一id")).
 		Reads(model.Cluster{}, "需要改变的env json字串").
 		Writes(apis.RespEntity{}))
+
+	ws.Route(ws.GET("/{id}/resources").To(as.getClusterResources).
+		Doc("获取agent上报的集群k8s资源概要，包括节点、命名空间、deployment及pod").
+		Metadata(restfulSpec.KeyOpenAPITags, tags).
+		Param(ws.PathParameter("id", "获取集群唯一id")).
+		Writes(apis.ClusterInventory{}))
 }
 
 // 添加集群
@@ -242,3 +248,18 @@ func (as *clusterService) updateClusterEnvs(req *restful.Request, resp *restful.
 	}
 	apis.RespAPI(resp, apis.NewRespSucceed(cluster.Env))
 }
+
+// 获取集群k8s资源概要
+func (as *clusterService) getClusterResources(req *restful.Request, resp *restful.Response) {
+	id, err := checkNumberParam(req, "id", true)
+	if err != nil {
+		apis.RespAPI(resp, apis.NewRespErr(apis.ErrReqInvalid, err))
+		return
+	}
+	inventory, err := as.clusterManager.GetClusterResources(uint64(id))
+	if err != nil {
+		apis.RespAPI(resp, apis.NewRespErr(apis.ErrDataNotFound, err))
+		return
+	}
+	apis.RespAPI(resp, apis.NewRespSucceed(inventory))
+}
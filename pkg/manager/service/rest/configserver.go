@@ -381,7 +381,7 @@ func (cs *configService) releaseConfig(req *restful.Request, resp *restful.Respo
 
 	desc := strings.TrimSpace(req.QueryParameter("desc"))
 
-	if err := cs.configManager.ReleaseConfig(uint64(id), desc, creator); err != nil {
+	if err := cs.configManager.ReleaseConfig(req.Request.Context(), uint64(id), desc, creator); err != nil {
 		apis.RespAPI(resp, apis.NewRespErr(apis.ErrDBOpsFailed, err))
 		return
 	}
@@ -432,7 +432,7 @@ func (cs *configService) releaseNamespace(req *restful.Request, resp *restful.Re
 
 	desc := strings.TrimSpace(req.QueryParameter("desc"))
 
-	if err := cs.configManager.ReleaseNamespace(siteID, namespace, desc, creator); err != nil {
+	if err := cs.configManager.ReleaseNamespace(req.Request.Context(), siteID, namespace, desc, creator); err != nil {
 		apis.RespAPI(resp, apis.NewRespErr(apis.ErrSvcFailed, err))
 		return
 	}
@@ -0,0 +1,152 @@
+package rest
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"code.xxxxx.cn/platform/galaxy/pkg/apis"
+	"code.xxxxx.cn/platform/galaxy/pkg/component/cmd"
+	"code.xxxxx.cn/platform/galaxy/pkg/component/conns"
+	"code.xxxxx.cn/platform/galaxy/pkg/util/alog"
+	"github.com/emicklei/go-restful"
+	restfulSpec "github.com/emicklei/go-restful-openapi"
+)
+
+type connectionService struct {
+	cmdServer cmd.Server
+}
+
+// connection is the view of a live agent tunnel
+type connection struct {
+	Key          string            `json:"key"`
+	Info         map[string]string `json:"info"`
+	RemoteAddr   string            `json:"remote_addr"`
+	ConnectedAt  time.Time         `json:"connected_at"`
+	RegisteredAt time.Time         `json:"registered_at"`
+	LastActive   time.Time         `json:"last_active"`
+	// liveness measured by heartbeat cmds, empty if no heartbeat replied yet
+	RTT      string    `json:"rtt,omitempty"`
+	LastSeen time.Time `json:"last_seen"`
+	Misses   int       `json:"heartbeat_misses"`
+	Stale    bool      `json:"stale"`
+}
+
+// NewConnectionService build a connection inventory rest service
+func NewConnectionService(cmdServer cmd.Server) RestfulService {
+	return &connectionService{
+		cmdServer: cmdServer,
+	}
+}
+
+// RestfulService init a connection service instance
+func (s *connectionService) RestfulService() *restful.WebService {
+	ws := new(restful.WebService)
+	tags := []string{"连接管理"}
+	ws.Path("/api/v1/connections").Produces(restful.MIME_JSON)
+	// register routes
+	s.addRoutes(ws, tags)
+	return ws
+}
+
+// 定义连接管理路由
+func (s *connectionService) addRoutes(ws *restful.WebService, tags []string) {
+
+	ws.Route(ws.GET("/").To(s.listConnections).
+		Doc("获取在线agent连接列表").
+		Metadata(restfulSpec.KeyOpenAPITags, tags).
+		Param(ws.QueryParameter("site_id", "匹配项目ID")).
+		Param(ws.QueryParameter("business_line", "匹配业务线")).
+		Param(ws.QueryParameter("labels", "匹配连接标签，格式：eg. 'version=v1.2.0,identity=agent-a'")).
+		Param(ws.QueryParameter("key", "模糊匹配agent connection key")).
+		Writes([]connection{}))
+
+	ws.Route(ws.GET("/{key}").To(s.getConnection).
+		Doc("获取agent连接详情").
+		Metadata(restfulSpec.KeyOpenAPITags, tags).
+		Param(ws.PathParameter("key", "agent connection key")).
+		Writes(connection{}))
+
+	ws.Route(ws.DELETE("/{key}").To(s.disconnect).
+		Doc("强制断开agent连接，agent会自动重连").
+		Metadata(restfulSpec.KeyOpenAPITags, tags).
+		Param(ws.PathParameter("key", "agent connection key")))
+}
+
+// 查询在线agent连接列表
+func (s *connectionService) listConnections(req *restful.Request, resp *restful.Response) {
+	labels, err := buildLabelParams(req)
+	if err != nil {
+		apis.RespAPI(resp, apis.NewRespErr(apis.ErrReqInvalid, err))
+		return
+	}
+	key := strings.TrimSpace(req.QueryParameter("key"))
+
+	list := make([]*connection, 0)
+	for _, conn := range s.cmdServer.GetConnManager().ListConnsByLabels(labels) {
+		if key != "" && !strings.Contains(conn.Key, key) {
+			continue
+		}
+		list = append(list, s.buildConnection(conn))
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Key < list[j].Key
+	})
+	apis.RespAPI(resp, apis.NewRespSucceed(list))
+}
+
+// 查询agent连接详情
+func (s *connectionService) getConnection(req *restful.Request, resp *restful.Response) {
+	conn, err := s.cmdServer.GetConnManager().GetConn(req.PathParameter("key"))
+	if err != nil {
+		apis.RespAPI(resp, apis.NewRespErr(apis.ErrDataNotFound, err))
+		return
+	}
+	apis.RespAPI(resp, apis.NewRespSucceed(s.buildConnection(conn)))
+}
+
+// 强制断开agent连接
+func (s *connectionService) disconnect(req *restful.Request, resp *restful.Response) {
+	key := req.PathParameter("key")
+	if err := s.cmdServer.GetConnManager().Disconnect(key); err != nil {
+		apis.RespAPI(resp, apis.NewRespErr(apis.ErrDataNotFound, err))
+		return
+	}
+	alog.Infof("Connection %s disconnected by api", key)
+	apis.RespAPI(resp, apis.NewRespSucceed(nil))
+}
+
+// buildConnection build the view of conn with its heartbeat liveness
+func (s *connectionService) buildConnection(conn *conns.Conn) *connection {
+	c := &connection{
+		Key:          conn.Key,
+		Info:         conn.Info,
+		RemoteAddr:   conn.RemoteAddr,
+		ConnectedAt:  conn.ConnectedAt,
+		RegisteredAt: conn.RegisteredAt,
+		LastActive:   conn.LastActive(),
+	}
+	if l, err := s.cmdServer.Liveness(conn.Key); err == nil {
+		c.RTT, c.LastSeen, c.Misses, c.Stale = l.RTT.String(), l.LastSeen, l.Misses, l.Stale
+	}
+	return c
+}
+
+// buildLabelParams build the labels to match from query params site_id, business_line and labels
+func buildLabelParams(req *restful.Request) (map[string]string, error) {
+	labels := make(map[string]string)
+	for _, label := range buildArrayParams("labels", req) {
+		kv := strings.SplitN(label, "=", 2)
+		if len(kv) != 2 || strings.TrimSpace(kv[0]) == "" {
+			return nil, fmt.Errorf("invalid label %q, must be key=value", label)
+		}
+		labels[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+	}
+	for _, k := range []string{apis.LabelSiteID, apis.LabelBusinessLine} {
+		if v := strings.TrimSpace(req.QueryParameter(k)); v != "" {
+			labels[k] = v
+		}
+	}
+	return labels, nil
+}
@@ -72,7 +72,8 @@ func (ls *logService) getContainerLog(req *restful.Request, resp *restful.Respon
 	}
 
 	reqCmd := ls.cmdServer.NewCmdReq(cmd.GetContainerLog, args, req.QueryParameter("cluster"))
-	respCmd, err := ls.cmdServer.SendSync(reqCmd, 0)
+	// stop the remote cmd when the browser disconnect before response
+	respCmd, err := ls.cmdServer.SendSyncContext(req.Request.Context(), reqCmd)
 	if err != nil {
 		apis.RespWebsocket(resp, req, err.Error(), nil)
 		alog.Errorf("Send err: %v", err)
@@ -0,0 +1,137 @@
+package rest
+
+import (
+	"fmt"
+	"strings"
+
+	"code.xxxxx.cn/platform/galaxy/pkg/apis"
+	"code.xxxxx.cn/platform/galaxy/pkg/manager/model"
+	"code.xxxxx.cn/platform/galaxy/pkg/manager/outbox"
+	"code.xxxxx.cn/platform/galaxy/pkg/manager/util/pagination"
+	"github.com/emicklei/go-restful"
+	restfulSpec "github.com/emicklei/go-restful-openapi"
+)
+
+type outboxService struct {
+	outboxManager outbox.Manager
+}
+
+// NewOutboxService build a cmd outbox rest service
+func NewOutboxService(outboxManager outbox.Manager) RestfulService {
+	return &outboxService{
+		outboxManager: outboxManager,
+	}
+}
+
+// RestfulService init a outbox service instance
+func (s *outboxService) RestfulService() *restful.WebService {
+	ws := new(restful.WebService)
+	tags := []string{"命令投递"}
+	ws.Path("/api/v1/outbox").Produces(restful.MIME_JSON)
+	// register routes
+	s.addRoutes(ws, tags)
+	return ws
+}
+
+// 定义命令投递路由
+func (s *outboxService) addRoutes(ws *restful.WebService, tags []string) {
+
+	ws.Route(ws.GET("/").To(s.listCmds).
+		Doc("获取待投递命令列表").
+		Metadata(restfulSpec.KeyOpenAPITags, tags).
+		Param(ws.QueryParameter("current_page", "当前页码，必须大于零，否则设为默认值1")).
+		Param(ws.QueryParameter("page_size", "每页条数，正常区间(0,1000]，否则设为默认值10")).
+		Param(ws.QueryParameter("sorts", "排序参数，用于数据排序，支持多字段同时排序，格式：eg. 'created_at asc,name desc'， asc表示升序，desc表示降序")).
+		Param(ws.QueryParameter("site_id", "匹配项目ID")).
+		Param(ws.QueryParameter("executor", "匹配agent connection key")).
+		Param(ws.QueryParameter("name", "匹配命令名称")).
+		Param(ws.QueryParameter("status", "匹配投递状态：Pending, Delivered, Failed, Expired")).
+		Writes(apis.Page{}))
+
+	ws.Route(ws.GET("/{id}").To(s.getCmd).
+		Doc("获取命令投递状态").
+		Metadata(restfulSpec.KeyOpenAPITags, tags).
+		Param(ws.PathParameter("id", "命令唯一id")).
+		Writes(model.CmdOutbox{}))
+
+	ws.Route(ws.POST("/{id}/retry").To(s.retryCmd).
+		Doc("重新投递失败或过期的命令").
+		Metadata(restfulSpec.KeyOpenAPITags, tags).
+		Param(ws.PathParameter("id", "命令唯一id")).
+		Writes(model.CmdOutbox{}))
+}
+
+// 分页查询待投递命令列表
+func (s *outboxService) listCmds(req *restful.Request, resp *restful.Response) {
+	// check page param
+	pageSize, _, err := checkPageParams(req)
+	if err != nil {
+		apis.RespAPI(resp, apis.NewRespErr(apis.ErrReqInvalid, err))
+		return
+	}
+
+	// build search filter
+	query := s.buildFilters(req)
+	orders := buildArrayParams("sorts", req)
+	if len(orders) == 0 {
+		orders = append(orders, "id desc") // default id desc
+	}
+
+	// build pagination
+	count, err := s.outboxManager.CountCmds(query)
+	if err != nil {
+		apis.RespAPI(resp, apis.NewRespErr(apis.ErrReqInvalid, err))
+		return
+	}
+	pn := pagination.SetPaginator(req, pageSize, count)
+
+	// get data
+	list, err := s.outboxManager.ListCmds(query, orders, pn.Offset(), pageSize)
+	if err != nil {
+		apis.RespAPI(resp, apis.NewRespErr(apis.ErrDBOpsFailed, err))
+		return
+	}
+	page := apis.NewPage(pn, list)
+	apis.RespAPI(resp, apis.NewRespSucceed(page))
+}
+
+// 构造查询的参数
+func (s *outboxService) buildFilters(req *restful.Request) string {
+	var filters []string
+	for _, key := range []string{"site_id", "executor", "name", "status"} {
+		if value := strings.TrimSpace(req.QueryParameter(key)); len(value) > 0 {
+			filters = append(filters, fmt.Sprintf("%s = %q", key, value))
+		}
+	}
+	return strings.Join(filters, " AND ")
+}
+
+// 获取命令投递状态
+func (s *outboxService) getCmd(req *restful.Request, resp *restful.Response) {
+	id, err := checkNumberParam(req, "id", true)
+	if err != nil {
+		apis.RespAPI(resp, apis.NewRespErr(apis.ErrReqInvalid, err))
+		return
+	}
+	outboxCmd, err := s.outboxManager.GetCmd(uint64(id))
+	if err != nil {
+		apis.RespAPI(resp, apis.NewRespErr(apis.ErrDBOpsFailed, err))
+		return
+	}
+	apis.RespAPI(resp, apis.NewRespSucceed(outboxCmd))
+}
+
+// 重新投递命令
+func (s *outboxService) retryCmd(req *restful.Request, resp *restful.Response) {
+	id, err := checkNumberParam(req, "id", true)
+	if err != nil {
+		apis.RespAPI(resp, apis.NewRespErr(apis.ErrReqInvalid, err))
+		return
+	}
+	outboxCmd, err := s.outboxManager.Retry(uint64(id))
+	if err != nil {
+		apis.RespAPI(resp, apis.NewRespErr(apis.ErrDBOpsFailed, err))
+		return
+	}
+	apis.RespAPI(resp, apis.NewRespSucceed(outboxCmd))
+}
@@ -11,6 +11,7 @@ import (
 	"code.xxxxx.cn/platform/galaxy/pkg/manager/configserver"
 	"code.xxxxx.cn/platform/galaxy/pkg/manager/log"
 	"code.xxxxx.cn/platform/galaxy/pkg/manager/notifier"
+	"code.xxxxx.cn/platform/galaxy/pkg/manager/outbox"
 	"code.xxxxx.cn/platform/galaxy/pkg/manager/provider"
 	"code.xxxxx.cn/platform/galaxy/pkg/manager/service/rest"
 	"code.xxxxx.cn/platform/galaxy/pkg/util/alog"
@@ -30,6 +31,7 @@ type Manager struct {
 	providerManager provider.Manager
 	notifier        notifier.Manager
 	configManager   configserver.Manager
+	outboxManager   outbox.Manager
 	appManager      application.Manager
 	clusterManager  cluster.Manager
 	stopWorld       <-chan struct{}
@@ -41,7 +43,8 @@ func NewServiceManager(cfg *config.ManagerConfiguration, grpcServer *grpc.Server
 
 	notifierManager := notifier.NewManager()
 	logManager := log.NewManager(cfg.ESURL, cs)
-	configManager, fdb := configserver.NewConfigManager(cfg.DataDir, cs, stopCh)
+	outboxManager := outbox.NewManager(cs, cfg.OutboxTTL, stopCh)
+	configManager, fdb := configserver.NewConfigManager(cfg.DataDir, cs, outboxManager, stopCh)
 	providerManager := provider.NewProvider(fdb, stopCh)
 	appManager := application.NewManager(cs, stopCh)
 	clusterManager := cluster.NewManager(cs, cfg.ResourceManagerAPI, cfg.ResourceManagerSecret, stopCh)
@@ -54,6 +57,7 @@ func NewServiceManager(cfg *config.ManagerConfiguration, grpcServer *grpc.Server
 		authManager:     authManager,
 		logManager:      logManager,
 		configManager:   configManager,
+		outboxManager:   outboxManager,
 		providerManager: providerManager,
 		appManager:      appManager,
 		clusterManager:  clusterManager,
@@ -76,6 +80,8 @@ func (sm *Manager) registerWebServices() {
 	sm.webServer.Add(rest.NewClusterService(sm.clusterManager).RestfulService())
 	sm.webServer.Add(rest.NewLogService(sm.cmdServer).RestfulService())
 	sm.webServer.Add(rest.NewProviderService(sm.providerManager).RestfulService())
+	sm.webServer.Add(rest.NewOutboxService(sm.outboxManager).RestfulService())
+	sm.webServer.Add(rest.NewConnectionService(sm.cmdServer).RestfulService())
 
 	// add error handler
 	sm.webServer.ServiceErrorHandler(func(serviceError restful.ServiceError, request *restful.Request, response *restful.Response) {